@@ -0,0 +1,197 @@
+// Package bird generates the BIRD 2 configuration of the route servers of
+// the IXPs using the bird daemon.
+package bird
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/project"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// families of the routes, with the suffix of the BIRD keywords
+var families = []struct {
+	name string
+	v4   bool
+}{
+	{"ipv4", true},
+	{"ipv6", false},
+}
+
+var invalidChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// member is a client of the route server
+type member struct {
+	name string
+	asn  int
+	ip   string
+	nbr  *project.BGPNbr
+}
+
+// WriteAll writes the configuration of the BIRD route servers in the
+// configuration directory, using the same file names as the FRR ones so
+// that the containers are started the same way
+func WriteAll(p *project.Project) {
+	genDir := utils.GetDirectoryFromKey("ConfigDir", "")
+	for i := range p.IXPs {
+		ixp := &p.IXPs[i]
+		if ixp.Daemon != project.RSDaemonBird {
+			continue
+		}
+		for j, rs := range ixp.RouteServers {
+			filename := fmt.Sprintf("%s/conf_%d_%s", genDir, ixp.ASN, rs.Hostname)
+			if config.VFlag {
+				fmt.Println("writing", filename)
+			}
+			dst := &strings.Builder{}
+			GenerateConfig(dst, p, ixp, j)
+			if err := ioutil.WriteFile(filename, []byte(dst.String()), 0644); err != nil {
+				utils.Fatalln(err)
+			}
+		}
+	}
+}
+
+// GenerateConfig writes the configuration of the idx-th route server of the
+// IXP: one table, BGP protocol and pipe per member, the pipes applying the
+// import and export filters of the member
+func GenerateConfig(dst io.Writer, p *project.Project, ixp *project.IXP, idx int) {
+	rs := ixp.RouteServers[idx]
+	local := ixp.Links[idx].Interface.IP.IP.String()
+
+	fmt.Fprintln(dst, "# Route server", rs.Hostname, "of IXP", ixp.ASN)
+	for _, addr := range rs.InterfaceAddresses() {
+		fmt.Fprintln(dst, "# address", addr)
+	}
+	fmt.Fprintln(dst, `log "/var/log/bird.log" { warning, error, fatal, bug };`)
+	fmt.Fprintf(dst, "router id %s;\n", rs.RouterID(ixp.ASN))
+	fmt.Fprintln(dst)
+	fmt.Fprintln(dst, "protocol device {\n}")
+
+	members := make([]member, 0, len(ixp.Members()))
+	inUse := make(map[bool]bool, 2)
+	for _, lnk := range ixp.Members() {
+		ip := lnk.Interface.IP.IP.String()
+		nbr, ok := rs.Neighbors[ip]
+		if !ok {
+			continue
+		}
+		members = append(members, member{
+			name: invalidChars.ReplaceAllString(fmt.Sprintf("AS%d_%s", lnk.ASN, lnk.Router.Hostname), "_"),
+			asn:  lnk.ASN,
+			ip:   ip,
+			nbr:  nbr,
+		})
+		inUse[true] = inUse[true] || nbr.AF.IPv4
+		inUse[false] = inUse[false] || nbr.AF.IPv6
+	}
+
+	writeRPKI(dst, p.RPKI, ixp.RPKI, inUse)
+	writeFilters(dst, ixp, members, inUse)
+
+	for _, m := range members {
+		fmt.Fprintln(dst)
+		for _, f := range families {
+			if hasFamily(m.nbr, f.v4) {
+				fmt.Fprintf(dst, "%s table t_%s_%s;\n", f.name, f.name, m.name)
+			}
+		}
+		writeProtocol(dst, ixp, m, local)
+		for _, f := range families {
+			if hasFamily(m.nbr, f.v4) {
+				writePipe(dst, ixp, m, f.name, f.v4)
+			}
+		}
+	}
+}
+
+func hasFamily(nbr *project.BGPNbr, v4 bool) bool {
+	if v4 {
+		return nbr.AF.IPv4
+	}
+	return nbr.AF.IPv6
+}
+
+// writeRPKI writes the ROA tables and the RTR sessions used by the import
+// filters
+func writeRPKI(dst io.Writer, servers map[string]project.RPKIServer, selected []string, inUse map[bool]bool) {
+	if len(selected) == 0 {
+		return
+	}
+	fmt.Fprintln(dst)
+	for _, f := range families {
+		if inUse[f.v4] {
+			fmt.Fprintf(dst, "roa%s table rpki%s;\n", f.name[3:], f.name[3:])
+		}
+	}
+	for idx, s := range selected {
+		srv, ok := servers[s]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(dst, "\nprotocol rpki rpki%d {\n", idx+1)
+		for _, f := range families {
+			if inUse[f.v4] {
+				fmt.Fprintf(dst, "\troa%s { table rpki%s; };\n", f.name[3:], f.name[3:])
+			}
+		}
+		fmt.Fprintf(dst, "\tremote %s port %d;\n", srv.IP, srv.Port)
+		fmt.Fprintln(dst, "}")
+	}
+}
+
+// writeProtocol writes the BGP session with a member, exchanging the routes
+// of its tables
+func writeProtocol(dst io.Writer, ixp *project.IXP, m member, local string) {
+	nbr := m.nbr
+	fmt.Fprintf(dst, "\nprotocol bgp %s {\n", m.name)
+	fmt.Fprintf(dst, "\tlocal %s as %d;\n", local, ixp.ASN)
+	fmt.Fprintf(dst, "\tneighbor %s as %d;\n", m.ip, nbr.RemoteAS)
+	fmt.Fprintln(dst, "\trs client;")
+	if nbr.Password != "" {
+		fmt.Fprintf(dst, "\tpassword \"%s\";\n", nbr.Password)
+	}
+	if nbr.Hold > 0 {
+		fmt.Fprintf(dst, "\thold time %d;\n", nbr.Hold)
+		fmt.Fprintf(dst, "\tkeepalive time %d;\n", nbr.Keepalive)
+	}
+	for _, f := range families {
+		if !hasFamily(nbr, f.v4) {
+			continue
+		}
+		fmt.Fprintf(dst, "\t%s {\n", f.name)
+		fmt.Fprintf(dst, "\t\ttable t_%s_%s;\n", f.name, m.name)
+		fmt.Fprintln(dst, "\t\timport all;")
+		if nbr.MaxPrefix > 0 {
+			fmt.Fprintf(dst, "\t\timport limit %d action restart;\n", nbr.MaxPrefix)
+		}
+		fmt.Fprintln(dst, "\t\texport all;")
+		fmt.Fprintln(dst, "\t};")
+	}
+	fmt.Fprintln(dst, "}")
+}
+
+// writePipe connects the table of a member to the master table, the routes
+// of the member being imported through its import filter and the other
+// routes exported through its export filter
+func writePipe(dst io.Writer, ixp *project.IXP, m member, family string, v4 bool) {
+	fmt.Fprintf(dst, "\nprotocol pipe p_%s_%s {\n", family, m.name)
+	fmt.Fprintf(dst, "\ttable master%s;\n", family[3:])
+	fmt.Fprintf(dst, "\tpeer table t_%s_%s;\n", family, m.name)
+	if ixp.Filter || len(ixp.RPKI) > 0 {
+		fmt.Fprintf(dst, "\timport filter %s;\n", importFilter(m.asn, v4))
+	} else {
+		fmt.Fprintln(dst, "\timport all;")
+	}
+	if ixp.Communities {
+		fmt.Fprintf(dst, "\texport filter %s;\n", exportFilter(m.asn))
+	} else {
+		fmt.Fprintln(dst, "\texport all;")
+	}
+	fmt.Fprintln(dst, "}")
+}
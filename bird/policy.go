@@ -0,0 +1,130 @@
+package bird
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+func importFilter(asn int, v4 bool) string {
+	if v4 {
+		return fmt.Sprintf("rs_in4_%d", asn)
+	}
+	return fmt.Sprintf("rs_in6_%d", asn)
+}
+
+func exportFilter(asn int) string {
+	return fmt.Sprintf("rs_out_%d", asn)
+}
+
+// writeFilters writes the filters of the members, with the same semantics
+// as the route-maps of the FRR route servers:
+//   - the import filters drop the RPKI invalid routes and the prefixes not
+//     originated by the customer cone of the member
+//   - the export filters apply the action communities: 0:<ASN> (do not
+//     announce to the member), 0:<RS> (do not announce) and <RS>:<ASN>
+//     (announce only to the members listed), and remove them
+func writeFilters(dst io.Writer, ixp *project.IXP, members []member, inUse map[bool]bool) {
+	asns := make([]int, 0, len(members))
+	seen := make(map[int]bool, len(members))
+	for _, m := range members {
+		if !seen[m.asn] {
+			seen[m.asn] = true
+			asns = append(asns, m.asn)
+		}
+	}
+	sort.Ints(asns)
+
+	if ixp.Filter || len(ixp.RPKI) > 0 {
+		for _, asn := range asns {
+			for _, f := range families {
+				if inUse[f.v4] {
+					writeImportFilter(dst, ixp, asn, f.v4)
+				}
+			}
+		}
+	}
+	if !ixp.Communities {
+		return
+	}
+
+	targets := make([]string, 0, len(asns))
+	actions := []string{fmt.Sprintf("(0, %d)", ixp.ASN)}
+	for _, asn := range asns {
+		if asn > 0xffff {
+			continue
+		}
+		targets = append(targets, fmt.Sprintf("(%d, %d)", ixp.ASN, asn))
+		actions = append(actions, fmt.Sprintf("(0, %d)", asn), fmt.Sprintf("(%d, %d)", ixp.ASN, asn))
+	}
+	fmt.Fprintf(dst, "\ndefine RS_ACTIONS = [ %s ];\n", strings.Join(actions, ", "))
+	if len(targets) > 0 {
+		fmt.Fprintf(dst, "define RS_TO_ANY = [ %s ];\n", strings.Join(targets, ", "))
+	}
+
+	for _, asn := range asns {
+		fmt.Fprintf(dst, "\nfilter %s {\n", exportFilter(asn))
+		if asn <= 0xffff {
+			fmt.Fprintf(dst, "\tif (0, %d) ~ bgp_community || (0, %d) ~ bgp_community then reject;\n", ixp.ASN, asn)
+			fmt.Fprintf(dst, "\tif (%d, %d) ~ bgp_community then {\n", ixp.ASN, asn)
+			fmt.Fprintln(dst, "\t\tbgp_community.delete(RS_ACTIONS);")
+			fmt.Fprintln(dst, "\t\taccept;")
+			fmt.Fprintln(dst, "\t}")
+		} else {
+			fmt.Fprintf(dst, "\tif (0, %d) ~ bgp_community then reject;\n", ixp.ASN)
+		}
+		if len(targets) > 0 {
+			fmt.Fprintln(dst, "\tif bgp_community ~ RS_TO_ANY then reject;")
+		}
+		fmt.Fprintln(dst, "\tbgp_community.delete(RS_ACTIONS);")
+		fmt.Fprintln(dst, "\taccept;")
+		fmt.Fprintln(dst, "}")
+	}
+}
+
+// writeImportFilter writes the import filter of a member for a family
+func writeImportFilter(dst io.Writer, ixp *project.IXP, asn int, v4 bool) {
+	fmt.Fprintf(dst, "\nfilter %s {\n", importFilter(asn, v4))
+	if len(ixp.RPKI) > 0 {
+		table := "rpki6"
+		if v4 {
+			table = "rpki4"
+		}
+		fmt.Fprintf(dst, "\tif roa_check(%s, net, bgp_path.last) = ROA_INVALID then reject;\n", table)
+	}
+	if !ixp.Filter {
+		fmt.Fprintln(dst, "\taccept;")
+		fmt.Fprintln(dst, "}")
+		return
+	}
+
+	prefixes := ixp.MemberPrefixes(asn, v4)
+	items := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		items = append(items, prefixPattern(prefix))
+	}
+	if len(items) > 0 {
+		fmt.Fprintf(dst, "\tif net ~ [ %s ] then accept;\n", strings.Join(items, ", "))
+	}
+	fmt.Fprintln(dst, "\treject;")
+	fmt.Fprintln(dst, "}")
+}
+
+// prefixPattern converts a prefix-list entry ("<prefix> [le <length>]") to
+// a BIRD prefix pattern
+func prefixPattern(entry string) string {
+	fields := strings.Fields(entry)
+	if len(fields) != 3 || fields[1] != "le" {
+		return fields[0]
+	}
+	_, n, err := net.ParseCIDR(fields[0])
+	if err != nil {
+		return fields[0]
+	}
+	ones, _ := n.Mask.Size()
+	return fmt.Sprintf("%s{%d,%s}", fields[0], ones, fields[2])
+}
@@ -0,0 +1,459 @@
+package bird
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/project"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Backend runs BIRD in the router containers
+type Backend struct{}
+
+func init() {
+	project.RegisterBackend(project.DaemonBIRD, Backend{})
+}
+
+// Names of the static protocols originating the prefixes of the router and
+// routing the eBGP neighbors
+const (
+	networksProtocol = "networks"
+	peersProtocol    = "peers"
+)
+
+// protocolName returns the name of the BGP protocol of a neighbor, its
+// prefix telling if the session is external
+func protocolName(ip string, ebgp bool) string {
+	prefix := "ibgp_"
+	if ebgp {
+		prefix = "ebgp_"
+	}
+	return prefix + invalidChars.ReplaceAllString(ip, "_")
+}
+
+// Render writes the BIRD configuration of a router: its interfaces, OSPF if
+// used by the AS, the BGP sessions and the relations filters
+func (Backend) Render(dst io.Writer, p *project.Project, as *project.AutonomousSystem, r *project.Router) {
+	is4 := as.Network.IPNet == nil || as.Network.IPNet.IP.To4() != nil
+
+	fmt.Fprintf(dst, "# AS%d %s\n", as.ASN, r.Hostname)
+	for _, addr := range r.InterfaceAddresses() {
+		fmt.Fprintln(dst, "# address", addr)
+	}
+	fmt.Fprintln(dst, `log "/var/log/bird.log" { warning, error, fatal, bug };`)
+	fmt.Fprintf(dst, "router id %s;\n", r.RouterID(as.ASN))
+
+	// families of the sessions and of the AS
+	inUse := map[bool]bool{is4: true}
+	for _, nbr := range r.Neighbors {
+		inUse[true] = inUse[true] || nbr.AF.IPv4
+		inUse[false] = inUse[false] || nbr.AF.IPv6
+	}
+
+	fmt.Fprintln(dst, "\nprotocol device {\n}")
+	fmt.Fprintln(dst, "\nprotocol direct {")
+	for _, f := range families {
+		if inUse[f.v4] {
+			fmt.Fprintf(dst, "\t%s;\n", f.name)
+		}
+	}
+	fmt.Fprintln(dst, "}")
+
+	// routes installed in the kernel
+	for _, f := range families {
+		if inUse[f.v4] {
+			fmt.Fprintln(dst, "\nprotocol kernel {")
+			fmt.Fprintf(dst, "\t%s { export where source ~ [ RTS_BGP, RTS_OSPF, RTS_OSPF_IA, RTS_OSPF_EXT1, RTS_OSPF_EXT2 ] || proto = \"%s\"; };\n",
+				f.name, familyProtocol(peersProtocol, f.v4))
+			fmt.Fprintln(dst, "}")
+		}
+	}
+
+	writePeerRoutes(dst, p.PeerRoutes(as, r))
+	writeNetworks(dst, as, r)
+	if as.IGPType() == project.IGPOSPF {
+		writeOSPF(dst, as, r, is4)
+	}
+	writeRelationsFilters(dst, as)
+
+	ips := make([]string, 0, len(r.Neighbors))
+	for ip := range r.Neighbors {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	for _, ip := range ips {
+		writeNeighbor(dst, as, r, ip, r.Neighbors[ip])
+	}
+}
+
+// familyProtocol returns the name of the static protocol of a family
+func familyProtocol(name string, v4 bool) string {
+	if v4 {
+		return name
+	}
+	return name + "6"
+}
+
+// writePeerRoutes writes the static routes to the eBGP neighbors reached
+// through a link but not on its subnet
+func writePeerRoutes(dst io.Writer, routes []project.PeerRoute) {
+	for _, f := range families {
+		first := true
+		for _, route := range routes {
+			if (!strings.Contains(route.Prefix, ":")) != f.v4 {
+				continue
+			}
+			if first {
+				fmt.Fprintf(dst, "\nprotocol static %s {\n", familyProtocol(peersProtocol, f.v4))
+				fmt.Fprintf(dst, "\t%s;\n", f.name)
+				first = false
+			}
+			if route.Gateway != nil {
+				fmt.Fprintf(dst, "\troute %s via %s;\n", route.Prefix, route.Gateway)
+			} else {
+				fmt.Fprintf(dst, "\troute %s via \"%s\";\n", route.Prefix, route.IfName)
+			}
+		}
+		if !first {
+			fmt.Fprintln(dst, "}")
+		}
+	}
+}
+
+// writeNetworks writes the static routes of the prefixes announced by the
+// router, and the prefixes of the AS whose connected subnets are announced
+func writeNetworks(dst io.Writer, as *project.AutonomousSystem, r *project.Router) {
+	own := map[bool][]string{}
+	if n := as.Network.IPNet; n != nil {
+		ones, bits := n.Mask.Size()
+		own[n.IP.To4() != nil] = []string{fmt.Sprintf("%s{%d,%d}", n, ones, bits)}
+	}
+	for _, f := range families {
+		if len(own[f.v4]) > 0 {
+			fmt.Fprintf(dst, "\ndefine OWN%s = [ %s ];\n", f.name[3:], strings.Join(own[f.v4], ", "))
+		}
+	}
+
+	// connected subnets are announced if they belong to the AS prefix
+	fmt.Fprintln(dst, "\nfunction own_route()\n{")
+	fmt.Fprintf(dst, "\tif proto = \"%s\" || proto = \"%s\" then return true;\n",
+		familyProtocol(networksProtocol, true), familyProtocol(networksProtocol, false))
+	if as.BGP.RedistributeIGP && as.IGPType() == project.IGPOSPF {
+		fmt.Fprintln(dst, "\tif source ~ [ RTS_OSPF, RTS_OSPF_IA, RTS_OSPF_EXT1, RTS_OSPF_EXT2 ] then return true;")
+	}
+	fmt.Fprintln(dst, "\tif source != RTS_DEVICE then return false;")
+	for _, f := range families {
+		if len(own[f.v4]) > 0 {
+			fmt.Fprintf(dst, "\tif net.type = NET_IP%s then return net ~ OWN%s;\n", f.name[3:], f.name[3:])
+		}
+	}
+	fmt.Fprintln(dst, "\treturn false;\n}")
+
+	announced := map[bool][]net.IPNet{}
+	for _, n := range as.Announced(r) {
+		v4 := n.IP.To4() != nil
+		announced[v4] = append(announced[v4], n)
+	}
+	for _, f := range families {
+		if len(announced[f.v4]) == 0 {
+			continue
+		}
+		fmt.Fprintf(dst, "\nprotocol static %s {\n", familyProtocol(networksProtocol, f.v4))
+		fmt.Fprintf(dst, "\t%s;\n", f.name)
+		for _, n := range announced[f.v4] {
+			fmt.Fprintf(dst, "\troute %s blackhole;\n", n.String())
+		}
+		fmt.Fprintln(dst, "}")
+	}
+}
+
+// writeOSPF writes the OSPF instance of the router, OSPFv3 being used by
+// IPv6 AS
+func writeOSPF(dst io.Writer, as *project.AutonomousSystem, r *project.Router, is4 bool) {
+	// without custom networks, all the internal interfaces are in area 0
+	custom := r.IGP.OSPF != nil && is4
+	area := func(ip net.IP) (int, bool) {
+		if !custom {
+			return 0, true
+		}
+		for _, n := range r.IGP.OSPF {
+			if _, prefix, err := net.ParseCIDR(n.Prefix); err == nil && prefix.Contains(ip) {
+				return n.Area, true
+			}
+		}
+		return 0, false
+	}
+
+	areas := make(map[int][]string, 1)
+	lo := 0
+	if custom {
+		// the loopback is added in the first area of the router
+		lo = r.IGP.OSPF[0].Area
+	}
+	areas[lo] = append(areas[lo], "\t\tinterface \"lo\" { stub yes; };")
+	for _, iface := range r.Links {
+		if iface.External || iface.VRF != "" {
+			continue
+		}
+		a, ok := area(iface.IP.IP)
+		if !ok {
+			continue
+		}
+		opts := make([]string, 0, 3)
+		if iface.Cost > 0 {
+			opts = append(opts, fmt.Sprintf("cost %d;", iface.Cost))
+		}
+		if iface.IGP.Priority > 0 {
+			opts = append(opts, fmt.Sprintf("priority %d;", iface.IGP.Priority))
+		}
+		if iface.IGP.Passive {
+			opts = append(opts, "stub yes;")
+		}
+		areas[a] = append(areas[a], fmt.Sprintf("\t\tinterface \"%s\" { %s };", iface.IfName, strings.Join(opts, " ")))
+	}
+
+	ids := make([]int, 0, len(areas))
+	for id := range areas {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	version, family := "v2", "ipv4"
+	if !is4 {
+		version, family = "v3", "ipv6"
+	}
+	fmt.Fprintf(dst, "\nprotocol ospf %s {\n", version)
+	fmt.Fprintf(dst, "\t%s { import all; export none; };\n", family)
+	for _, id := range ids {
+		fmt.Fprintf(dst, "\tarea %d {\n", id)
+		if as.IsOSPFStub(id) {
+			fmt.Fprintln(dst, "\t\tstub yes;")
+		}
+		for _, line := range areas[id] {
+			fmt.Fprintln(dst, line)
+		}
+		fmt.Fprintln(dst, "\t};")
+	}
+	fmt.Fprintln(dst, "}")
+}
+
+// writeRelationsFilters writes the filters of the eBGP sessions, with the
+// semantics of the relations route-maps of FRR
+func writeRelationsFilters(dst io.Writer, as *project.AutonomousSystem) {
+	bgp := config.DefaultBGPSettings
+	comm := func(c int) string {
+		return fmt.Sprintf("(%d, %d)", as.ASN, c)
+	}
+	in := func(name string, rel config.BGPRelationConfig) {
+		fmt.Fprintf(dst, "\nfilter %s {\n", name)
+		fmt.Fprintf(dst, "\tbgp_community.add(%s);\n", comm(rel.Community))
+		fmt.Fprintf(dst, "\tbgp_local_pref = %d;\n", rel.LocalPref)
+		fmt.Fprintln(dst, "\taccept;\n}")
+	}
+	out := func(name string, upstream bool) {
+		fmt.Fprintf(dst, "\nfilter %s {\n", name)
+		fmt.Fprintln(dst, "\tif own_route() then accept;")
+		fmt.Fprintln(dst, "\tif source != RTS_BGP then reject;")
+		if upstream {
+			fmt.Fprintf(dst, "\tif %s ~ bgp_community || %s ~ bgp_community then reject;\n",
+				comm(bgp.Provider.Community), comm(bgp.Peer.Community))
+		}
+		fmt.Fprintln(dst, "\taccept;\n}")
+	}
+
+	in("PROVIDER_IN", bgp.Provider)
+	in("PEER_IN", bgp.Peer)
+	in("CUSTOMER_IN", bgp.Customer)
+	out("PROVIDER_OUT", true)
+	out("PEER_OUT", true)
+	out("CUSTOMER_OUT", false)
+	out("ALLOW_ALL", false)
+}
+
+// writeNeighbor writes the BGP protocol of a session
+func writeNeighbor(dst io.Writer, as *project.AutonomousSystem, r *project.Router, ip string, nbr *project.BGPNbr) {
+	ebgp := nbr.RemoteAS != as.ASN
+	peer := net.ParseIP(ip)
+	fmt.Fprintf(dst, "\nprotocol bgp %s {\n", protocolName(ip, ebgp))
+
+	localAS := as.ASN
+	if nbr.LocalAS > 0 {
+		localAS = nbr.LocalAS
+	}
+	local := ""
+	if nbr.UpdateSource == "lo" {
+		for _, lo := range r.Loopback {
+			if (lo.IP.To4() != nil) == (peer.To4() != nil) {
+				local = lo.IP.String() + " "
+				break
+			}
+		}
+	}
+	fmt.Fprintf(dst, "\tlocal %sas %d;\n", local, localAS)
+	fmt.Fprintf(dst, "\tneighbor %s as %d;\n", ip, nbr.RemoteAS)
+	if ebgp && nbr.EBGPMultihop > 0 {
+		fmt.Fprintf(dst, "\tmultihop %d;\n", nbr.EBGPMultihop)
+	} else if ebgp && !nbr.ConnCheck {
+		// neighbor reached through a link but not on its subnet
+		fmt.Fprintln(dst, "\tmultihop 1;")
+	}
+	if nbr.RRClient {
+		fmt.Fprintln(dst, "\trr client;")
+		if r.ClusterID != "" {
+			fmt.Fprintf(dst, "\trr cluster id %s;\n", r.ClusterID)
+		}
+	}
+	if nbr.RSClient {
+		fmt.Fprintln(dst, "\trs client;")
+	}
+	if nbr.Password != "" {
+		fmt.Fprintf(dst, "\tpassword \"%s\";\n", nbr.Password)
+	}
+	if nbr.Hold > 0 {
+		fmt.Fprintf(dst, "\thold time %d;\n", nbr.Hold)
+		fmt.Fprintf(dst, "\tkeepalive time %d;\n", nbr.Keepalive)
+	}
+	if nbr.AllowASIn > 0 {
+		fmt.Fprintf(dst, "\tallow local as %d;\n", nbr.AllowASIn)
+	}
+
+	importFilter, exportFilter := "all", "filter ALLOW_ALL"
+	if ebgp && len(nbr.RouteMapsIn) > 0 && nbr.RouteMapsIn[0] != "ALLOW_ALL" {
+		importFilter = "filter " + nbr.RouteMapsIn[0]
+	}
+	if ebgp && len(nbr.RouteMapsOut) > 0 {
+		exportFilter = "filter " + nbr.RouteMapsOut[0]
+	}
+	for _, f := range families {
+		if !hasFamily(nbr, f.v4) {
+			continue
+		}
+		fmt.Fprintf(dst, "\t%s {\n", f.name)
+		fmt.Fprintf(dst, "\t\timport %s;\n", importFilter)
+		if nbr.MaxPrefix > 0 {
+			fmt.Fprintf(dst, "\t\timport limit %d action restart;\n", nbr.MaxPrefix)
+		}
+		fmt.Fprintf(dst, "\t\texport %s;\n", exportFilter)
+		if nbr.NextHopSelf {
+			fmt.Fprintln(dst, "\t\tnext hop self;")
+		}
+		fmt.Fprintln(dst, "\t};")
+	}
+	fmt.Fprintln(dst, "}")
+}
+
+// Start runs the init script of the image, which configures the addresses
+// listed in the configuration and starts BIRD
+func (Backend) Start(r *project.Router) error {
+	utils.StartFrr(r.ContainerName)
+	return nil
+}
+
+// Reload runs the reload action of the init script of the image
+func (Backend) Reload(r *project.Router) error {
+	return utils.ReloadFrr(r.ContainerName)
+}
+
+// birdc runs a command of the BIRD client in the router container
+func birdc(r *project.Router, args ...string) ([]byte, error) {
+	out, err := exec.Command("docker", append([]string{"exec", r.ContainerName, "birdc"}, args...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", r.ContainerName, err)
+	}
+	return out, nil
+}
+
+// route header in the output of "show route", the prefix being omitted for
+// the other routes of the same prefix
+var routeRegex = regexp.MustCompile(`^(\S*)\s+\w+ \[(\w+) [^\]]*\]( \*)?`)
+
+// RIB returns the BGP routes and the routes of the prefixes originated by
+// the router, which have an empty AS path
+func (Backend) RIB(r *project.Router) ([]project.BGPRoute, error) {
+	out, err := birdc(r, "show", "route", "all")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]project.BGPRoute, 0, 64)
+	var cur *project.BGPRoute
+	prefix := ""
+	flush := func() {
+		if cur != nil {
+			res = append(res, *cur)
+			cur = nil
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := routeRegex.FindStringSubmatch(line); m != nil {
+			flush()
+			if m[1] != "" {
+				prefix = m[1]
+			}
+			proto := m[2]
+			if !strings.HasPrefix(proto, "ebgp_") && !strings.HasPrefix(proto, "ibgp_") &&
+				!strings.HasPrefix(proto, networksProtocol) {
+				continue
+			}
+			cur = &project.BGPRoute{
+				Prefix:   prefix,
+				Best:     m[3] != "",
+				Valid:    true,
+				External: strings.HasPrefix(proto, "ebgp_"),
+			}
+			continue
+		}
+		if cur != nil {
+			if f := strings.TrimSpace(line); strings.HasPrefix(f, "BGP.as_path:") {
+				cur.Path = strings.TrimSpace(strings.TrimPrefix(f, "BGP.as_path:"))
+			}
+		}
+	}
+	flush()
+	return res, nil
+}
+
+// Sessions returns the state of the BGP protocols, read from "show
+// protocols"
+func (Backend) Sessions(r *project.Router) (map[string]project.BGPPeerState, error) {
+	out, err := birdc(r, "show", "protocols")
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(r.Neighbors))
+	for ip := range r.Neighbors {
+		names[protocolName(ip, false)] = ip
+		names[protocolName(ip, true)] = ip
+	}
+	res := make(map[string]project.BGPPeerState, len(r.Neighbors))
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[1] != "BGP" {
+			continue
+		}
+		ip, ok := names[fields[0]]
+		if !ok {
+			continue
+		}
+		state := fields[3]
+		if len(fields) > 5 {
+			state = fields[5]
+		}
+		res[ip] = project.BGPPeerState{
+			RemoteAS: r.Neighbors[ip].RemoteAS,
+			State:    state,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// aspaCmd represents the aspa command
+var aspaCmd = &cobra.Command{
+	Use:   "aspa",
+	Short: "Verify the AS paths of a running topology using ASPA",
+	Long: `Verify the AS paths of the routes learned using eBGP by all the routers
+against the ASPA objects derived from the external links relations (or the
+ones of the file given with --aspa). Exits with status 1 if invalid paths are
+found.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		aspaFile, _ := cmd.Flags().GetString("aspa")
+		newConf := getConfig(cmd, args)
+		if newConf.VerifyASPA(aspaFile) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aspaCmd)
+	aspaCmd.Flags().StringP("project", "p", "", "Project name")
+	aspaCmd.Flags().String("aspa", "", "ASPA file (aspa.json format)")
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Show the state of the BGP and BFD sessions of a running topology",
+	Run: func(cmd *cobra.Command, args []string) {
+		newConf := getConfig(cmd, args)
+		newConf.Check()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().StringP("project", "p", "", "Project name")
+}
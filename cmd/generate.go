@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"github.com/rahveiz/topomate/bird"
 	"github.com/rahveiz/topomate/frr"
+	_ "github.com/rahveiz/topomate/gobgp" // registers the GoBGP backend
 	"github.com/rahveiz/topomate/project"
 	"github.com/rahveiz/topomate/utils"
 	"github.com/spf13/cobra"
@@ -38,4 +40,6 @@ func setConfigDir(dirname string) {
 func generateConfigs(p *project.Project) {
 	foo := frr.GenerateConfig(p)
 	frr.WriteAll(foo)
+	bird.WriteAll(p)
+	p.WriteBackendConfigs()
 }
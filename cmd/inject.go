@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"net"
+
+	"github.com/rahveiz/topomate/internal/injector"
+	"github.com/rahveiz/topomate/utils"
+	"github.com/spf13/cobra"
+)
+
+// injectCmd represents the inject command
+var injectCmd = &cobra.Command{
+	Use:   "inject",
+	Short: "Replay a MRT file over an eBGP session",
+	Long: `Establish an eBGP session with a router and replay the routes of a MRT
+file (TABLE_DUMP_V2 RIB dump or BGP4MP updates, optionally compressed with
+gzip or bzip2). This is the command run by the injector hosts.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := cmd.Flags()
+		cfg := injector.Config{}
+		cfg.File, _ = flags.GetString("file")
+		cfg.LocalAS, _ = flags.GetUint32("asn")
+		cfg.PeerAS, _ = flags.GetUint32("peer-as")
+		cfg.Rate, _ = flags.GetInt("rate")
+		cfg.Limit, _ = flags.GetInt("limit")
+		cfg.PeerIndex, _ = flags.GetInt("peer-index")
+
+		peer, _ := flags.GetString("peer")
+		if cfg.Peer = net.ParseIP(peer); cfg.Peer == nil {
+			utils.Fatalln("Invalid peer address", peer)
+		}
+		if id, _ := flags.GetString("id"); id != "" {
+			if cfg.RouterID = net.ParseIP(id); cfg.RouterID == nil {
+				utils.Fatalln("Invalid router-id", id)
+			}
+		}
+
+		var err error
+		asMap, _ := flags.GetString("as-map")
+		if cfg.ASMap, err = injector.ParseASMap(asMap); err != nil {
+			utils.Fatalln(err)
+		}
+		prefixMap, _ := flags.GetString("prefix-map")
+		if cfg.PrefixMap, err = injector.ParsePrefixMap(prefixMap); err != nil {
+			utils.Fatalln(err)
+		}
+
+		if err := injector.Run(cfg); err != nil {
+			utils.Fatalln(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(injectCmd)
+	injectCmd.Flags().StringP("file", "f", "", "MRT file")
+	injectCmd.Flags().Uint32("asn", 0, "Local AS number")
+	injectCmd.Flags().String("id", "", "Router-id (default is the local address)")
+	injectCmd.Flags().String("peer", "", "Address of the peer")
+	injectCmd.Flags().Uint32("peer-as", 0, "AS number of the peer (not checked if 0)")
+	injectCmd.Flags().Int("rate", 0, "Maximum number of updates per second (0 for no limit)")
+	injectCmd.Flags().Int("limit", 0, "Maximum number of updates sent (0 for no limit)")
+	injectCmd.Flags().Int("peer-index", -1, "Peer index of the RIB entries (first entry if -1)")
+	injectCmd.Flags().String("as-map", "", "AS rewrites (old=new,...)")
+	injectCmd.Flags().String("prefix-map", "", "Prefix rewrites (old/len=new/len,...)")
+	injectCmd.MarkFlagRequired("file")
+	injectCmd.MarkFlagRequired("asn")
+	injectCmd.MarkFlagRequired("peer")
+}
@@ -71,5 +71,33 @@ func restartContainer(name string) {
 		d.Portname = strings.TrimSuffix(v.HostIface, "_l")
 		d.AddPort(v.Bridge, v.ContainerIface, v.Settings, nil, true)
 	}
-	utils.StartFrr(name)
+	applyVNIs(name, readVNIs()[name])
+	if !ovsdocker.IsHost(m[name]) {
+		utils.StartFrr(name)
+	}
+}
+
+// readVNIs reads the VNIs saved when the links were applied (the file does
+// not exist if the project has no EVPN)
+func readVNIs() ovsdocker.VNIBulk {
+	vnis := ovsdocker.VNIBulk{}
+	content, err := ioutil.ReadFile(utils.GetDirectoryFromKey("MainDir", "") + "/vnis.json")
+	if err != nil {
+		return vnis
+	}
+	if err := json.Unmarshal(content, &vnis); err != nil {
+		utils.Fatalln(err)
+	}
+	return vnis
+}
+
+// applyVNIs recreates the VXLAN devices of a container, once its ports are
+// attached
+func applyVNIs(name string, vnis []ovsdocker.VNISettings) {
+	d := ovsdocker.New(name)
+	for _, settings := range vnis {
+		if err := d.AddVNI(settings); err != nil {
+			utils.Fatalln(err)
+		}
+	}
 }
@@ -60,6 +60,7 @@ func resumeContainers(name string) {
 	ctx := context.Background()
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	utils.Check(err)
+	vnis := readVNIs()
 
 	// Start container(s)
 
@@ -73,7 +74,10 @@ func resumeContainers(name string) {
 			d.Portname = strings.TrimSuffix(v.HostIface, "_l")
 			d.AddPort(v.Bridge, v.ContainerIface, v.Settings, nil, true)
 		}
-		utils.StartFrr(name)
+		applyVNIs(name, vnis[name])
+		if !ovsdocker.IsHost(m[name]) {
+			utils.StartFrr(name)
+		}
 	} else { // Name not specified, start all the containers
 		wg := sync.WaitGroup{}
 		for cName, lks := range m {
@@ -87,7 +91,10 @@ func resumeContainers(name string) {
 					d.Portname = strings.TrimSuffix(v.HostIface, "_l")
 					d.AddPort(v.Bridge, v.ContainerIface, v.Settings, nil, true)
 				}
-				utils.StartFrr(name)
+				applyVNIs(name, vnis[name])
+				if !ovsdocker.IsHost(links) {
+					utils.StartFrr(name)
+				}
 				w.Done()
 			}(&wg, &ctx, cName, lks)
 		}
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"os"
+
+	"github.com/rahveiz/topomate/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -17,6 +20,13 @@ to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		newConf := getConfig(cmd, args)
 		newConf.Print()
+		mismatches := newConf.MTUMismatches()
+		for _, m := range mismatches {
+			utils.PrintError(m)
+		}
+		if len(mismatches) > 0 {
+			os.Exit(1)
+		}
 	},
 	// Args: cobra.ExactArgs(),
 }
@@ -1,5 +1,7 @@
 package config
 
+import "fmt"
+
 func getOrDefaultInt(val, def int) int {
 	if val == 0 {
 		return def
@@ -63,3 +65,16 @@ func (c *ISISConfig) CheckArea(routerID int) int {
 	}
 	return 1
 }
+
+// UnmarshalYAML reads either a list of ROAs or "auto"
+func (l *ROAList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		if s != "auto" {
+			return fmt.Errorf("invalid roas value: %s", s)
+		}
+		l.Auto = true
+		return nil
+	}
+	return unmarshal(&l.Entries)
+}
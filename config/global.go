@@ -7,7 +7,11 @@ var ConfigDir string
 var DefaultBGPSettings GlobalBGPConfig
 
 const (
-	DockerRouterImage = "topomate/router"
-	DockerRSImage     = "topomate/route-server"
-	DockerRTRImage    = "topomate/rtr"
+	DockerRouterImage   = "topomate/router"
+	DockerRSImage       = "topomate/route-server"
+	DockerBirdImage     = "topomate/bird"
+	DockerGoBGPImage    = "topomate/gobgp"
+	DockerRTRImage      = "topomate/rtr"
+	DockerHostImage     = "alpine"
+	DockerInjectorImage = "topomate/injector"
 )
@@ -14,6 +14,28 @@ type BaseConfig struct {
 	External     []ExternalLink        `yaml:"external_links"`
 	IXPs         []IXPConfig           `yaml:"ixps"`
 	RPKI         map[string]RPKIConfig `yaml:"rpki"`
+	Hijacks      []HijackConfig        `yaml:"hijacks"`
+	Leaks        []LeakConfig          `yaml:"leaks"`
+}
+
+// HijackConfig makes a router of an AS originate a prefix of another AS.
+// Prefix defaults to the prefix of the victim, and can be a more-specific of
+// it. RouterID defaults to the first router.
+type HijackConfig struct {
+	ASN      int    `yaml:"asn"`
+	RouterID int    `yaml:"router_id"`
+	Victim   int    `yaml:"victim"`
+	Prefix   string `yaml:"prefix"`
+}
+
+// LeakConfig makes an AS announce the routes learned from From (all the
+// routes if 0) to To, bypassing the relations filters. If RouterID is not
+// set, all the routers of the AS having a session with To leak the routes.
+type LeakConfig struct {
+	ASN      int `yaml:"asn"`
+	RouterID int `yaml:"router_id"`
+	From     int `yaml:"from"`
+	To       int `yaml:"to"`
 }
 
 type GlobalConfig struct {
@@ -31,46 +53,203 @@ type BGPRelationConfig struct {
 	LocalPref int `yaml:"local_pref,omitempty"`
 }
 
+// ASConfig describes an AS. Daemon is the routing daemon of its routers,
+// frr (default), bird or gobgp, RouterDaemons overriding it per router ID.
 type ASConfig struct {
-	ASN          int           `yaml:"asn,omitempty"`
-	NumRouters   int           `yaml:"routers,omitempty"`
-	IGP          string        `yaml:"igp,omitempty"`
-	ISIS         ISISConfig    `yaml:"isis"`
-	OSPF         OSPFConfig    `yaml:"ospf"`
-	Prefix       string        `yaml:"prefix,omitempty"`
-	SubnetLength int           `yaml:"subnet_length"`
-	LoRange      string        `yaml:"loopback_start,omitempty"`
-	BGP          BGPConfig     `yaml:"bgp"`
-	Links        InternalLinks `yaml:"links,omitempty"`
-	MPLS         bool          `yaml:"mpls,omitempty"`
-	VPN          []VPNConfig
-	RPKI         struct {
+	ASN           int            `yaml:"asn,omitempty"`
+	NumRouters    int            `yaml:"routers,omitempty"`
+	Daemon        string         `yaml:"daemon"`
+	RouterDaemons map[int]string `yaml:"router_daemons"`
+	IGP           string         `yaml:"igp,omitempty"`
+	ISIS          ISISConfig     `yaml:"isis"`
+	OSPF          OSPFConfig     `yaml:"ospf"`
+	Prefix        string         `yaml:"prefix,omitempty"`
+	SubnetLength  int            `yaml:"subnet_length"`
+	LoRange       string         `yaml:"loopback_start,omitempty"`
+	BGP           BGPConfig      `yaml:"bgp"`
+	Links         InternalLinks  `yaml:"links,omitempty"`
+	MPLS          bool           `yaml:"mpls,omitempty"`
+	MTU           int            `yaml:"mtu,omitempty"`
+	BFD           BFDConfig      `yaml:"bfd"`
+	SR            SRConfig       `yaml:"segment_routing"`
+	EVPN          EVPNConfig     `yaml:"evpn"`
+	Hosts         []HostConfig   `yaml:"hosts"`
+	VPN           []VPNConfig
+	RPKI          struct {
 		Servers []string `yaml:"servers"`
+		// off, tag, prefer-valid or drop-invalid
+		Policy string `yaml:"policy"`
+		// Tag adds a community with the validation state of the routes
+		Tag bool `yaml:"tag"`
 	} `yaml:"rpki"`
 }
 
+// BFDConfig enables BFD on the IGP adjacencies and iBGP sessions of an AS.
+// Intervals are in milliseconds.
+type BFDConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	RxInterval int  `yaml:"rx_interval"`
+	TxInterval int  `yaml:"tx_interval"`
+	Multiplier int  `yaml:"multiplier"`
+	Echo       bool `yaml:"echo"`
+}
+
 // type IBGPConfig struct {
 // 	File string `yaml:"file"`
 // }
 
+// IBGPConfig describes the iBGP sessions of an AS. Route reflectors can be
+// clients of other reflectors, and reflectors sharing a ClusterID form a
+// redundant cluster. If RRFullMesh is set, the top-level reflectors are
+// connected in a full mesh.
 type IBGPConfig struct {
 	Manual bool
-	RR     []struct {
-		Router  int   `yaml:"router"`
-		Clients []int `yaml:"clients,flow"`
+	// Mode is used when Manual is not set: full-mesh, route-reflectors,
+	// adjacent (sessions between routers sharing a link) or empty (full mesh,
+	// or route reflectors for large AS)
+	Mode string `yaml:"mode"`
+	RR   []struct {
+		Router    int    `yaml:"router"`
+		Clients   []int  `yaml:"clients,flow"`
+		ClusterID string `yaml:"cluster_id"`
 	} `yaml:"route_reflectors"`
-	Cliques [][]int `yaml:"cliques,flow"`
+	Cliques    [][]int `yaml:"cliques,flow"`
+	RRFullMesh bool    `yaml:"rr_full_mesh"`
 }
 
 type BGPConfig struct {
-	IBGP            IBGPConfig `yaml:"ibgp"`
-	Disabled        bool       `yaml:"disabled"`
-	RedistributeIGP bool       `yaml:"redistribute_igp"`
+	IBGP             IBGPConfig `yaml:"ibgp"`
+	Disabled         bool       `yaml:"disabled"`
+	RedistributeIGP  bool       `yaml:"redistribute_igp"`
+	MaximumPaths     int        `yaml:"maximum_paths"`
+	MaximumPathsIBGP int        `yaml:"maximum_paths_ibgp"`
+	MultipathRelax   bool       `yaml:"multipath_relax"`
+	// Settings applied to all the sessions of the AS. local_as and password
+	// only apply to the eBGP sessions over external links and IXPs.
+	Session       BGPSessionConfig     `yaml:",inline"`
+	Confederation *ConfederationConfig `yaml:"confederation"`
+	Originate     *OriginateConfig     `yaml:"originate"`
+}
+
+// OriginateConfig describes additional prefixes originated by the AS, given
+// as a list and/or generated as Count subnets of length Length of Parent
+// (which must not overlap the AS prefix). Method is network (default) or redistribute
+// (static blackhole routes redistributed in BGP). Routers default to all
+// the routers of the AS.
+type OriginateConfig struct {
+	Prefixes []string `yaml:"prefixes"`
+	Generate *struct {
+		Count  int    `yaml:"count"`
+		Parent string `yaml:"parent"`
+		Length int    `yaml:"length"`
+	} `yaml:"generate"`
+	Method      string   `yaml:"method"`
+	Routers     []int    `yaml:"routers"`
+	Communities []string `yaml:"communities"`
+	MED         *int     `yaml:"med"`
+}
+
+// ConfederationConfig splits an AS in sub-AS. Members maps each sub-AS
+// number to the IDs of its routers. The confederation identifier is the
+// number of the AS, so ID can be omitted.
+type ConfederationConfig struct {
+	ID      int           `yaml:"id"`
+	Members map[int][]int `yaml:"members"`
+}
+
+// BGPSessionConfig contains the settings of BGP sessions. They can be set in
+// the bgp block of an AS, on external links (or one of their ends) and on IXP
+// peers, the most specific value being used. Timers are in seconds.
+type BGPSessionConfig struct {
+	Keepalive       int    `yaml:"keepalive"`
+	Hold            int    `yaml:"hold"`
+	MaximumPrefix   int    `yaml:"maximum_prefix"`
+	EBGPMultihop    int    `yaml:"ebgp_multihop"`
+	Password        string `yaml:"password"`
+	LocalAS         int    `yaml:"local_as"`
+	AllowASIn       int    `yaml:"allowas_in"`
+	RemovePrivateAS bool   `yaml:"remove_private_as"`
+	// standard, extended, large, all or none
+	SendCommunity string `yaml:"send_community"`
+}
+
+type SRConfig struct {
+	Enabled     bool             `yaml:"enabled"`
+	GlobalBlock []int            `yaml:"global_block,flow"`
+	Policies    []SRPolicyConfig `yaml:"policies"`
+}
+
+type SRPolicyConfig struct {
+	Name         string `yaml:"name"`
+	Headend      string `yaml:"headend"`
+	Endpoint     string `yaml:"endpoint"`
+	Color        int    `yaml:"color"`
+	BindingSID   int    `yaml:"binding_sid,omitempty"`
+	ColorRoutes  bool   `yaml:"color_routes"`
+	SegmentLists []struct {
+		Name       string   `yaml:"name"`
+		Preference int      `yaml:"preference"`
+		Hops       []string `yaml:"hops,flow"`
+	} `yaml:"segment_lists"`
+}
+
+// HostConfig describes an end host attached to a router (or to a LAN) of the
+// AS. IP is the host address (with prefix length), Gateway the router one.
+type HostConfig struct {
+	Name    string `yaml:"name"`
+	Image   string `yaml:"image"`
+	Command string `yaml:"command"`
+	Files   []struct {
+		Src string `yaml:"src"`
+		Dst string `yaml:"dst"`
+	} `yaml:"files"`
+	Router  string `yaml:"router"`
+	LAN     string `yaml:"lan"`
+	IP      string `yaml:"ip"`
+	Gateway string `yaml:"gateway"`
+	// VNI attaches the host to the access segment of a L2VNI on its router
+	VNI int `yaml:"vni"`
+	// Injector makes the host replay a MRT file to its router
+	Injector *InjectorConfig `yaml:"injector"`
+}
+
+// InjectorConfig describes the eBGP session of an injector host and the
+// rewriting of the routes of its MRT file (RIB dump or updates). Relation is
+// the role of the injector for the AS (provider by default).
+type InjectorConfig struct {
+	File      string            `yaml:"file"`
+	ASN       int               `yaml:"asn"`
+	RouterID  string            `yaml:"router_id"`
+	Relation  string            `yaml:"relation"`
+	Rate      int               `yaml:"rate"`
+	Limit     int               `yaml:"limit"`
+	PeerIndex *int              `yaml:"peer_index"`
+	ASMap     map[uint32]uint32 `yaml:"as_map"`
+	PrefixMap map[string]string `yaml:"prefix_map"`
+}
+
+// EVPNConfig describes the VXLAN overlay of an AS. Routers are given as
+// router numbers or hostnames.
+type EVPNConfig struct {
+	L2VNIs []struct {
+		VNI     int      `yaml:"vni"`
+		VRF     string   `yaml:"vrf"`
+		Gateway string   `yaml:"gateway"`
+		Routers []string `yaml:"routers,flow"`
+	} `yaml:"l2vnis"`
+	L3VNIs []struct {
+		VNI     int      `yaml:"vni"`
+		VRF     string   `yaml:"vrf"`
+		Routers []string `yaml:"routers,flow"`
+	} `yaml:"l3vnis"`
 }
 
 type VPNConfig struct {
-	VRF       string `yaml:"vrf"`
-	HubMode   bool   `yaml:"hub_and_spoke"`
+	VRF       string   `yaml:"vrf"`
+	HubMode   bool     `yaml:"hub_and_spoke"`
+	RD        string   `yaml:"rd"`
+	ImportRT  []string `yaml:"import_rt,flow"`
+	ExportRT  []string `yaml:"export_rt,flow"`
 	Customers []struct {
 		Hostname     string `yaml:"hostname"`
 		Loopback     string `yaml:"loopback"`
@@ -79,18 +258,37 @@ type VPNConfig struct {
 		SubnetDown   string `yaml:"downstream_subnet"`
 		Parent       int    `yaml:"parent"`
 		Hub          bool
+		Routing      string `yaml:"routing"`
+		ASN          int    `yaml:"asn"`
+		ASOverride   bool   `yaml:"as_override"`
+		AllowASIn    int    `yaml:"allowas_in"`
 	} `yaml:"customers"`
 }
 
 type ExternalLinkItem struct {
-	ASN      int `yaml:"asn"`
-	RouterID int `yaml:"router_id"`
+	ASN      int              `yaml:"asn"`
+	RouterID int              `yaml:"router_id"`
+	BGP      BGPSessionConfig `yaml:"bgp"`
 }
 
 type ExternalLink struct {
-	From         ExternalLinkItem `yaml:"from"`
-	To           ExternalLinkItem `yaml:"to"`
-	Relationship string           `yaml:"rel"`
+	From         ExternalLinkItem  `yaml:"from"`
+	To           ExternalLinkItem  `yaml:"to"`
+	Relationship string            `yaml:"rel"`
+	MTU          int               `yaml:"mtu,omitempty"`
+	BFD          bool              `yaml:"bfd,omitempty"`
+	BGP          BGPSessionConfig  `yaml:"bgp"`
+	VPN          *InterASVPNConfig `yaml:"vpn,omitempty"`
+}
+
+// InterASVPNConfig describes how VPNs are extended over an external link.
+// VRFs is used by option A, FromRR and ToRR (router numbers of the route
+// reflectors or PEs exchanging VPN routes) by option C.
+type InterASVPNConfig struct {
+	Option string   `yaml:"option"`
+	VRFs   []string `yaml:"vrfs,flow"`
+	FromRR int      `yaml:"from_rr"`
+	ToRR   int      `yaml:"to_rr"`
 }
 
 type InternalLinks struct {
@@ -100,13 +298,47 @@ type InternalLinks struct {
 	Filepath string              `yaml:"file"`
 	Speed    int                 `yaml:"speed"`
 	Cost     int                 `yaml:"cost"`
+	MTU      int                 `yaml:"mtu"`
+	LANs     []LANConfig         `yaml:"lans,omitempty"`
+}
+
+// LANConfig describes a broadcast segment shared by several routers (and
+// hosts, attached using their lan key). If Prefix is not set, a subnet of
+// PrefixLength is taken from the AS prefix.
+type LANConfig struct {
+	Name         string   `yaml:"name"`
+	Routers      []string `yaml:"routers,flow"`
+	Prefix       string   `yaml:"prefix"`
+	PrefixLength int      `yaml:"prefix_length"`
+	Speed        int      `yaml:"speed"`
+	Cost         int      `yaml:"cost"`
+	DR           string   `yaml:"dr"`
+	MTU          int      `yaml:"mtu"`
 }
 
+// IXPConfig describes an IXP and its route server. BGP is applied to the
+// sessions of all the peers, PeersBGP to the sessions of a single peer
+// (using the same <ASN>.<Router_ID> key as in Peers).
+// Filter is none (default) or auto (import filters built from the prefixes
+// of the customer cone of each member), Communities enables the action
+// communities of the route servers and RPKI lists the RTR servers used to
+// drop invalid routes. RouteServers is 1 (default) or 2.
+// Bilateral lists the direct sessions between members over the peering LAN
+// as "<ASN>.<Router_ID> <ASN>.<Router_ID> [p2p|p2c|c2p]" (p2p by default).
+// RSDaemon is the routing daemon of the route servers, frr (default) or bird.
 type IXPConfig struct {
-	ASN      int      `yaml:"asn"`
-	Peers    []string `yaml:"peers,flow"`
-	Prefix   string   `yaml:"prefix"`
-	Loopback string   `yaml:"loopback"`
+	ASN          int                         `yaml:"asn"`
+	Peers        []string                    `yaml:"peers,flow"`
+	Prefix       string                      `yaml:"prefix"`
+	Loopback     string                      `yaml:"loopback"`
+	BGP          BGPSessionConfig            `yaml:"bgp"`
+	PeersBGP     map[string]BGPSessionConfig `yaml:"peers_bgp"`
+	Filter       string                      `yaml:"filter"`
+	Communities  bool                        `yaml:"communities"`
+	RPKI         []string                    `yaml:"rpki"`
+	RouteServers int                         `yaml:"route_servers"`
+	Bilateral    []string                    `yaml:"bilateral"`
+	RSDaemon     string                      `yaml:"rs_daemon"`
 }
 
 type ISISConfig struct {
@@ -142,10 +374,31 @@ type RPKIConfig struct {
 	// ASN        int      `yaml:"asn"`
 	Address string `yaml:"server_address"`
 	// NeighborAS []string `yaml:"neighbors_as,flow"`
+	// RouterLink is a router, or the peering LAN of an IXP
 	RouterLink struct {
 		ASN      int `yaml:"asn"`
 		RouterID int `yaml:"router_id"`
+		IXP      int `yaml:"ixp"`
 	} `yaml:"linked_to"`
-	CacheFile string `yaml:"cache_file"`
-	ROAs      []ROA  `yaml:"roas"`
+	CacheFile string  `yaml:"cache_file"`
+	ROAs      ROAList `yaml:"roas"`
+	// Settings of the ROAs generated with roas: auto. MaxLength defaults to
+	// the length of the AS prefix.
+	MaxLength int           `yaml:"max_length"`
+	Overrides []ROAOverride `yaml:"overrides"`
+}
+
+// ROAList is a list of ROAs, or "auto" to generate one ROA per AS prefix
+type ROAList struct {
+	Auto    bool
+	Entries []ROA
+}
+
+// ROAOverride changes the generated ROA of an AS: Missing removes it, Origin
+// replaces its origin AS (making the announcements of the AS invalid).
+type ROAOverride struct {
+	ASN       int  `yaml:"asn"`
+	Missing   bool `yaml:"missing"`
+	Origin    int  `yaml:"origin"`
+	MaxLength int  `yaml:"max_length"`
 }
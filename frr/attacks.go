@@ -0,0 +1,70 @@
+package frr
+
+import (
+	"fmt"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+// setupAttacks announces the prefixes hijacked by r, using blackhole routes
+// so the network statements are valid, and replaces the outbound route-maps
+// of the neighbors receiving leaked routes
+func (c *FRRConfig) setupAttacks(r *project.Router) {
+	for _, prefix := range r.Hijacked {
+		if prefix.IP.To4() != nil {
+			c.BGP.Networks.V4 = append(c.BGP.Networks.V4, prefix.String())
+		} else {
+			c.BGP.Networks.V6 = append(c.BGP.Networks.V6, prefix.String())
+		}
+		c.StaticRoutes.addNet(prefix, "Null0")
+	}
+
+	created := make(map[string]bool, 2)
+	for ip, nbr := range c.BGP.Neighbors {
+		if len(nbr.LeakFrom) == 0 {
+			continue
+		}
+		out := ""
+		if len(nbr.RouteMapsOut) > 0 {
+			out = nbr.RouteMapsOut[len(nbr.RouteMapsOut)-1]
+		}
+		nbr.RouteMapsOut = []string{c.leakRouteMap(nbr.RemoteAS, nbr.LeakFrom, out, created)}
+		c.BGP.Neighbors[ip] = nbr
+	}
+}
+
+// leakRouteMap creates the route-map permitting the routes learned from the
+// AS of leakFrom (all the routes for 0), the other ones being filtered by the
+// out route-map. It returns its name.
+func (c *FRRConfig) leakRouteMap(to int, leakFrom []int, out string, created map[string]bool) string {
+	name := fmt.Sprintf("LEAK_%d", to)
+	if created[name] {
+		return name
+	}
+	created[name] = true
+
+	for i, from := range leakFrom {
+		rm := RouteMap{
+			Name:  name,
+			Order: 10 + i,
+		}
+		if from != 0 {
+			l := ASPathList{
+				Name:  fmt.Sprintf("LEAK_FROM_%d", from),
+				Regex: fmt.Sprintf("^%d_", from),
+			}
+			if !created[l.Name] {
+				created[l.Name] = true
+				c.ASPathLists = append(c.ASPathLists, l)
+			}
+			rm.Match = &l
+		}
+		c.RouteMaps = append(c.RouteMaps, rm)
+	}
+	c.RouteMaps = append(c.RouteMaps, RouteMap{
+		Name:  name,
+		Order: 100,
+		Call:  out,
+	})
+	return name
+}
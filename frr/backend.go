@@ -0,0 +1,84 @@
+package frr
+
+import (
+	"io"
+
+	"github.com/rahveiz/topomate/project"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Backend runs FRR in the router containers, the default daemon
+type Backend struct {
+	// configurations generated for each AS, the VPN customers of an AS
+	// modifying the configuration of their PE
+	configs map[*project.AutonomousSystem][]*FRRConfig
+}
+
+func init() {
+	project.RegisterBackend(project.DaemonFRR, &Backend{
+		configs: make(map[*project.AutonomousSystem][]*FRRConfig),
+	})
+}
+
+func (b *Backend) Render(dst io.Writer, p *project.Project, as *project.AutonomousSystem, r *project.Router) {
+	configs, ok := b.configs[as]
+	if !ok {
+		configs = generateASConfigs(p, as)
+		b.configs[as] = configs
+	}
+	writeConfig(dst, *configs[r.ID-1])
+}
+
+func (*Backend) Start(r *project.Router) error {
+	r.StartFRR()
+	return nil
+}
+
+func (*Backend) Reload(r *project.Router) error {
+	return utils.ReloadFrr(r.ContainerName)
+}
+
+func (*Backend) RIB(r *project.Router) ([]project.BGPRoute, error) {
+	res := make([]project.BGPRoute, 0, 64)
+	for _, af := range []string{"ipv4", "ipv6"} {
+		var table struct {
+			Routes map[string][]struct {
+				Valid    bool   `json:"valid"`
+				Bestpath bool   `json:"bestpath"`
+				PathFrom string `json:"pathFrom"`
+				Path     string `json:"path"`
+			} `json:"routes"`
+		}
+		if err := r.VtyshJSON("show bgp "+af+" unicast", &table); err != nil {
+			return nil, err
+		}
+		for prefix, paths := range table.Routes {
+			for _, path := range paths {
+				res = append(res, project.BGPRoute{
+					Prefix:   prefix,
+					Path:     path.Path,
+					Best:     path.Bestpath,
+					Valid:    path.Valid,
+					External: path.PathFrom == "external",
+				})
+			}
+		}
+	}
+	return res, nil
+}
+
+func (*Backend) Sessions(r *project.Router) (map[string]project.BGPPeerState, error) {
+	var summary map[string]struct {
+		Peers map[string]project.BGPPeerState `json:"peers"`
+	}
+	if err := r.VtyshJSON("show bgp summary", &summary); err != nil {
+		return nil, err
+	}
+	res := make(map[string]project.BGPPeerState, len(r.Neighbors))
+	for _, af := range summary {
+		for ip, peer := range af.Peers {
+			res[ip] = peer
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,63 @@
+package frr
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+// BFDConfig contains the bfdd profiles and peers of a router
+type BFDConfig struct {
+	Profiles []*project.BFD
+	Peers    []project.BFDPeer
+}
+
+func (c *FRRConfig) setupBFD(r *project.Router) {
+	if len(r.BFDProfiles) == 0 && len(r.BFDPeers) == 0 {
+		return
+	}
+	c.BFD = &BFDConfig{
+		Profiles: make([]*project.BFD, 0, len(r.BFDProfiles)),
+		Peers:    r.BFDPeers,
+	}
+	for _, p := range r.BFDProfiles {
+		c.BFD.Profiles = append(c.BFD.Profiles, p)
+	}
+	sort.Slice(c.BFD.Profiles, func(i, j int) bool {
+		return c.BFD.Profiles[i].Profile < c.BFD.Profiles[j].Profile
+	})
+}
+
+func (c *BFDConfig) Write(dst io.Writer) {
+	if c == nil {
+		return
+	}
+	fmt.Fprintln(dst, "bfd")
+	for _, p := range c.Profiles {
+		fmt.Fprintln(dst, " profile", p.Profile)
+		fmt.Fprintln(dst, "  receive-interval", p.RxInterval)
+		fmt.Fprintln(dst, "  transmit-interval", p.TxInterval)
+		fmt.Fprintln(dst, "  detect-multiplier", p.Multiplier)
+		if p.Echo {
+			fmt.Fprintln(dst, "  echo-mode")
+		}
+		fmt.Fprintln(dst, " !")
+	}
+	for _, p := range c.Peers {
+		switch {
+		case p.Multihop && p.Local != "":
+			fmt.Fprintln(dst, " peer", p.IP, "multihop local-address", p.Local)
+		case p.IfName != "":
+			fmt.Fprintln(dst, " peer", p.IP, "interface", p.IfName)
+		default:
+			fmt.Fprintln(dst, " peer", p.IP)
+		}
+		if p.Profile != "" {
+			fmt.Fprintln(dst, "  profile", p.Profile)
+		}
+		fmt.Fprintln(dst, " !")
+	}
+	sep(dst)
+}
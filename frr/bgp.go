@@ -15,6 +15,18 @@ type BGPNbr project.BGPNbr
 type BGPNetworks struct {
 	V4 []string
 	V6 []string
+	// RouteMaps applied to some networks, indexed by prefix
+	RouteMaps map[string]string
+}
+
+func (n BGPNetworks) write(dst io.Writer, networks []string) {
+	for _, network := range networks {
+		if rm, ok := n.RouteMaps[network]; ok {
+			fmt.Fprintln(dst, "  network", network, "route-map", rm)
+		} else {
+			fmt.Fprintln(dst, "  network", network)
+		}
+	}
 }
 
 type BGPConfig struct {
@@ -24,7 +36,16 @@ type BGPConfig struct {
 	Networks     BGPNetworks
 	Redistribute RouteRedistribution
 	VRF          map[string]VRFConfig
+	AdvertiseVNI bool
 	Disabled     bool
+	// Multipath settings
+	MaximumPaths     int
+	MaximumPathsIBGP int
+	MultipathRelax   bool
+	ClusterID        string
+	// Confederation settings, ASN being the confederation identifier
+	SubAS       int
+	ConfedPeers []int
 }
 
 var genericID = net.ParseIP("10.1.1.1")
@@ -48,81 +69,91 @@ func (c *BGPConfig) setupRouterID(router *project.Router) {
 	}
 }
 
+// localAS returns the AS number used by the BGP instance, which is the
+// sub-AS for confederation members
+func (c *BGPConfig) localAS() int {
+	if c.SubAS > 0 {
+		return c.SubAS
+	}
+	return c.ASN
+}
+
 func (c *BGPConfig) Write(dst io.Writer) {
 	sep(dst)
 
 	// Here we create temp builders for address-family sections so we don't have
 	// to iterate multiple times over the map of neighbors
-	var af4, vpn4, af6, vpn6 strings.Builder
+	var af4, vpn4, af6, vpn6, lu4, evpn strings.Builder
 
-	fmt.Fprintln(dst, "router bgp", c.ASN)
+	fmt.Fprintln(dst, "router bgp", c.localAS())
 	if c.RouterID != "" {
 		fmt.Fprintln(dst, " bgp router-id", c.RouterID)
 	}
+	if c.SubAS > 0 {
+		fmt.Fprintln(dst, " bgp confederation identifier", c.ASN)
+		if len(c.ConfedPeers) > 0 {
+			fmt.Fprint(dst, " bgp confederation peers")
+			for _, m := range c.ConfedPeers {
+				fmt.Fprint(dst, " ", m)
+			}
+			fmt.Fprintln(dst)
+		}
+	}
+	if c.ClusterID != "" {
+		fmt.Fprintln(dst, " bgp cluster-id", c.ClusterID)
+	}
+	if c.MultipathRelax {
+		fmt.Fprintln(dst, " bgp bestpath as-path multipath-relax")
+	}
 	for ip, v := range c.Neighbors {
-		fmt.Fprintln(dst, " neighbor", ip, "remote-as", v.RemoteAS)
+		remoteAS := v.RemoteAS
+		if v.ConfedAS > 0 {
+			remoteAS = v.ConfedAS
+		} else if c.SubAS > 0 && v.RemoteAS == c.ASN {
+			remoteAS = c.SubAS
+		}
+		fmt.Fprintln(dst, " neighbor", ip, "remote-as", remoteAS)
 		if v.UpdateSource != "" {
 			fmt.Fprintln(dst, " neighbor", ip, "update-source", v.UpdateSource)
 		}
-		if !v.ConnCheck {
+		if v.EBGPMultihop > 0 {
+			fmt.Fprintln(dst, " neighbor", ip, "ebgp-multihop", v.EBGPMultihop)
+		} else if !v.ConnCheck {
 			fmt.Fprintln(dst, " neighbor", ip, "disable-connected-check")
 		}
+		v.writeSession(dst, ip)
 
 		// address-family ipv4 unicast
 		if v.AF.IPv4 {
-			fmt.Fprintln(&af4, "  neighbor", ip, "activate")
-			if v.NextHopSelf {
-				fmt.Fprintln(&af4, "  neighbor", ip, "next-hop-self")
-			}
-			if v.RouteMapsIn != nil {
-				for _, m := range v.RouteMapsIn {
-					fmt.Fprintln(&af4, "  neighbor", ip, "route-map", m, "in")
-				}
-			}
-			if v.RouteMapsOut != nil {
-				for _, m := range v.RouteMapsOut {
-					fmt.Fprintln(&af4, "  neighbor", ip, "route-map", m, "out")
-				}
-			}
-			if v.RRClient {
-				fmt.Fprintln(&af4, "  neighbor", ip, "route-reflector-client")
-			}
-			if v.RSClient {
-				fmt.Fprintln(&af4, "  neighbor", ip, "route-server-client")
-			}
+			v.writeAF(&af4, ip)
 		}
 
 		// address-family ipv6 unicast
 		if v.AF.IPv6 {
-			fmt.Fprintln(&af6, "  neighbor", ip, "activate")
-			if v.NextHopSelf {
-				fmt.Fprintln(&af6, "  neighbor", ip, "next-hop-self")
-			}
-			if v.RouteMapsIn != nil {
-				for _, m := range v.RouteMapsIn {
-					fmt.Fprintln(&af6, "  neighbor", ip, "route-map", m, "in")
-				}
-			}
-			if v.RouteMapsOut != nil {
-				for _, m := range v.RouteMapsOut {
-					fmt.Fprintln(&af6, "  neighbor", ip, "route-map", m, "out")
-				}
-			}
+			v.writeAF(&af6, ip)
+		}
+
+		// address-family ipv4 labeled-unicast
+		if v.AF.LabeledUnicast {
+			fmt.Fprintln(&lu4, "  neighbor", ip, "activate")
+		}
+
+		// address-family l2vpn evpn
+		if v.AF.EVPN {
+			fmt.Fprintln(&evpn, "  neighbor", ip, "activate")
 			if v.RRClient {
-				fmt.Fprintln(&af6, "  neighbor", ip, "route-reflector-client")
-			}
-			if v.RSClient {
-				fmt.Fprintln(&af6, "  neighbor", ip, "route-server-client")
+				fmt.Fprintln(&evpn, "  neighbor", ip, "route-reflector-client")
 			}
 		}
 
 		// address-family ipv4 vpn
 		if v.AF.VPNv4 {
-			fmt.Fprintln(&vpn4, "  neighbor", ip, "activate")
-			fmt.Fprintln(&vpn4, "  neighbor", ip, "send-community extended")
-			if v.RRClient {
-				fmt.Fprintln(&af4, "  neighbor", ip, "route-reflector-client")
-			}
+			v.writeVPNAF(&vpn4, ip)
+		}
+
+		// address-family ipv6 vpn
+		if v.AF.VPNv6 {
+			v.writeVPNAF(&vpn6, ip)
 		}
 	}
 
@@ -132,9 +163,8 @@ func (c *BGPConfig) Write(dst io.Writer) {
 	if af4.Len() > 0 {
 		fmt.Fprintln(dst, " address-family ipv4 unicast")
 		c.Redistribute.Write(dst, 2)
-		for _, network := range c.Networks.V4 {
-			fmt.Fprintln(dst, "  network", network)
-		}
+		c.Networks.write(dst, c.Networks.V4)
+		c.writeMultipath(dst)
 		fmt.Fprint(dst, af4.String())
 		fmt.Fprintln(dst, " exit-address-family")
 		fmt.Fprintln(dst, " !")
@@ -143,46 +173,176 @@ func (c *BGPConfig) Write(dst io.Writer) {
 	if af6.Len() > 0 {
 		fmt.Fprintln(dst, " address-family ipv6 unicast")
 		c.Redistribute.Write(dst, 2)
-		for _, network := range c.Networks.V6 {
-			fmt.Fprintln(dst, "  network", network)
-		}
+		c.Networks.write(dst, c.Networks.V6)
+		c.writeMultipath(dst)
 		fmt.Fprint(dst, af6.String())
 		fmt.Fprintln(dst, " exit-address-family")
 		fmt.Fprintln(dst, " !")
 	}
 
+	if lu4.Len() > 0 {
+		fmt.Fprintln(dst, " address-family ipv4 labeled-unicast")
+		fmt.Fprint(dst, lu4.String())
+		fmt.Fprintln(dst, " exit-address-family")
+		fmt.Fprintln(dst, " !")
+	}
+
 	if vpn4.Len() > 0 {
 		fmt.Fprintln(dst, " address-family ipv4 vpn")
 		fmt.Fprint(dst, vpn4.String())
 		fmt.Fprintln(dst, " exit-address-family")
+		fmt.Fprintln(dst, " !")
 	}
 
 	if vpn6.Len() > 0 {
 		fmt.Fprintln(dst, " address-family ipv6 vpn")
 		fmt.Fprint(dst, vpn6.String())
 		fmt.Fprintln(dst, " exit-address-family")
+		fmt.Fprintln(dst, " !")
+	}
+
+	if evpn.Len() > 0 || c.AdvertiseVNI {
+		fmt.Fprintln(dst, " address-family l2vpn evpn")
+		fmt.Fprint(dst, evpn.String())
+		if c.AdvertiseVNI {
+			fmt.Fprintln(dst, "  advertise-all-vni")
+		}
+		fmt.Fprintln(dst, " exit-address-family")
 	}
 
 	sep(dst)
 
 	for vrf, cfg := range c.VRF {
-		fmt.Fprintln(dst, "router bgp", c.ASN, "vrf", vrf)
-		fmt.Fprintln(dst, " address-family ipv4 unicast")
-		fmt.Fprintf(dst, "  rd vpn export %d:%d\n", c.ASN, cfg.RD)
-		fmt.Fprintln(dst, "  label vpn export auto")
-		if cfg.RT.In > 0 {
-			fmt.Fprintf(dst, "  rt vpn import %d:%d\n", c.ASN, cfg.RT.In)
-			fmt.Fprintln(dst, "  import vpn")
+		fmt.Fprintln(dst, "router bgp", c.localAS(), "vrf", vrf)
+		for ip, v := range cfg.Neighbors {
+			fmt.Fprintln(dst, " neighbor", ip, "remote-as", v.RemoteAS)
+			v.writeSession(dst, ip)
 		}
-		if cfg.RT.Out > 0 {
-			fmt.Fprintf(dst, "  rt vpn export %d:%d\n", c.ASN, cfg.RT.Out)
-			fmt.Fprintln(dst, "  export vpn")
+		// VRFs without explicit address family are IPv4 ones
+		if cfg.IPv4 || !cfg.IPv6 {
+			cfg.writeAF(dst, "ipv4", cfg.Redistribute)
+		}
+		if cfg.IPv6 {
+			cfg.writeAF(dst, "ipv6", cfg.Redistribute6)
+		}
+		// type-5 routes for the VRFs having a L3VNI
+		if cfg.VNI > 0 {
+			fmt.Fprintln(dst, " address-family l2vpn evpn")
+			if cfg.IPv4 || !cfg.IPv6 {
+				fmt.Fprintln(dst, "  advertise ipv4 unicast")
+			}
+			if cfg.IPv6 {
+				fmt.Fprintln(dst, "  advertise ipv6 unicast")
+			}
+			fmt.Fprintln(dst, " exit-address-family")
 		}
-		cfg.Redistribute.Write(dst, 2)
-		// fmt.Fprintln(dst, "  import vpn\n  export vpn")
-		fmt.Fprintln(dst, " exit-address-family")
 		sep(dst)
 	}
 
 	sep(dst)
 }
+
+func (cfg *VRFConfig) writeAF(dst io.Writer, af string, redistribute RouteRedistribution) {
+	fmt.Fprintln(dst, " address-family", af, "unicast")
+	// VRFs only used by EVPN are not exported to MPLS VPNs
+	if cfg.RD != "" {
+		fmt.Fprintln(dst, "  rd vpn export", cfg.RD)
+		fmt.Fprintln(dst, "  label vpn export auto")
+	}
+	if len(cfg.RT.In) > 0 {
+		fmt.Fprintln(dst, "  rt vpn import", strings.Join(cfg.RT.In, " "))
+		fmt.Fprintln(dst, "  import vpn")
+	}
+	if len(cfg.RT.Out) > 0 {
+		fmt.Fprintln(dst, "  rt vpn export", strings.Join(cfg.RT.Out, " "))
+		fmt.Fprintln(dst, "  export vpn")
+	}
+	redistribute.Write(dst, 2)
+	for ip, v := range cfg.Neighbors {
+		if (af == "ipv4" && v.AF.IPv4) || (af == "ipv6" && v.AF.IPv6) {
+			v.writeAF(dst, ip)
+		}
+	}
+	fmt.Fprintln(dst, " exit-address-family")
+}
+
+// writeMultipath writes the maximum-paths settings of an unicast
+// address-family
+func (c *BGPConfig) writeMultipath(dst io.Writer) {
+	if c.MaximumPaths > 0 {
+		fmt.Fprintln(dst, "  maximum-paths", c.MaximumPaths)
+	}
+	if c.MaximumPathsIBGP > 0 {
+		fmt.Fprintln(dst, "  maximum-paths ibgp", c.MaximumPathsIBGP)
+	}
+}
+
+// writeVPNAF writes the neighbor settings relative to a VPN address-family
+func (v *BGPNbr) writeVPNAF(dst io.Writer, ip string) {
+	fmt.Fprintln(dst, "  neighbor", ip, "activate")
+	fmt.Fprintln(dst, "  neighbor", ip, "send-community extended")
+	if v.RRClient {
+		fmt.Fprintln(dst, "  neighbor", ip, "route-reflector-client")
+	}
+	if v.NextHopSelfVPN {
+		fmt.Fprintln(dst, "  neighbor", ip, "next-hop-self")
+	}
+	if v.NextHopUnchanged {
+		fmt.Fprintln(dst, "  neighbor", ip, "attribute-unchanged next-hop")
+	}
+}
+
+// writeSession writes the session settings of the neighbor
+func (v *BGPNbr) writeSession(dst io.Writer, ip string) {
+	if v.BFD != "" {
+		fmt.Fprintln(dst, " neighbor", ip, "bfd profile", v.BFD)
+	}
+	if v.LocalAS > 0 {
+		fmt.Fprintln(dst, " neighbor", ip, "local-as", v.LocalAS)
+	}
+	if v.Password != "" {
+		fmt.Fprintln(dst, " neighbor", ip, "password", v.Password)
+	}
+	if v.Hold > 0 {
+		fmt.Fprintln(dst, " neighbor", ip, "timers", v.Keepalive, v.Hold)
+	}
+}
+
+// writeAF writes the neighbor settings relative to an unicast address-family
+func (v *BGPNbr) writeAF(dst io.Writer, ip string) {
+	fmt.Fprintln(dst, "  neighbor", ip, "activate")
+	if v.NextHopSelf {
+		fmt.Fprintln(dst, "  neighbor", ip, "next-hop-self")
+	}
+	for _, m := range v.RouteMapsIn {
+		fmt.Fprintln(dst, "  neighbor", ip, "route-map", m, "in")
+	}
+	for _, m := range v.RouteMapsOut {
+		fmt.Fprintln(dst, "  neighbor", ip, "route-map", m, "out")
+	}
+	if v.RRClient {
+		fmt.Fprintln(dst, "  neighbor", ip, "route-reflector-client")
+	}
+	if v.RSClient {
+		fmt.Fprintln(dst, "  neighbor", ip, "route-server-client")
+	}
+	if v.ASOverride {
+		fmt.Fprintln(dst, "  neighbor", ip, "as-override")
+	}
+	if v.AllowASIn > 0 {
+		fmt.Fprintln(dst, "  neighbor", ip, "allowas-in", v.AllowASIn)
+	}
+	if v.MaxPrefix > 0 {
+		fmt.Fprintln(dst, "  neighbor", ip, "maximum-prefix", v.MaxPrefix)
+	}
+	if v.RemovePrivateAS {
+		fmt.Fprintln(dst, "  neighbor", ip, "remove-private-AS")
+	}
+	switch v.SendCommunity {
+	case "":
+	case "none":
+		fmt.Fprintln(dst, "  no neighbor", ip, "send-community all")
+	default:
+		fmt.Fprintln(dst, "  neighbor", ip, "send-community", v.SendCommunity)
+	}
+}
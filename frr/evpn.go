@@ -0,0 +1,52 @@
+package frr
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+// setupEVPN configures the VNIs of a VTEP. EVPN sessions are activated on
+// the iBGP neighbors, so route reflectors only need the address-family.
+func (c *FRRConfig) setupEVPN(e *project.EVPN, r *project.Router) {
+	if !e.IsVTEP(r) {
+		return
+	}
+	c.BGP.AdvertiseVNI = true
+
+	// Gateway subnets are announced as type-5 routes in their VRF
+	gateways := make(map[string]bool, len(e.L2VNIs))
+	for _, vni := range e.L2VNIsFor(r) {
+		if len(vni.Gateway.IP) > 0 {
+			gateways[vni.VRF] = true
+		}
+	}
+
+	for _, vni := range e.L3VNIsFor(r) {
+		if c.L3VNIs == nil {
+			c.L3VNIs = make(map[string]int, 1)
+		}
+		c.L3VNIs[vni.VRF] = vni.VNI
+
+		cfg, ok := c.BGP.VRF[vni.VRF]
+		if !ok {
+			cfg = VRFConfig{IPv4: true}
+		}
+		cfg.VNI = vni.VNI
+		if gateways[vni.VRF] {
+			cfg.Redistribute.Connected = true
+		}
+		c.BGP.VRF[vni.VRF] = cfg
+	}
+}
+
+func (c *FRRConfig) writeL3VNIs(dst io.Writer) {
+	for vrf, vni := range c.L3VNIs {
+		sep(dst)
+		fmt.Fprintln(dst, "vrf", vrf)
+		fmt.Fprintln(dst, " vni", vni)
+		fmt.Fprintln(dst, "exit-vrf")
+		sep(dst)
+	}
+}
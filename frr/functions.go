@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strings"
 )
 
 func indent(w io.Writer, depth int) {
@@ -29,7 +30,11 @@ func (r RouteRedistribution) Write(w io.Writer, indent int) {
 		writeWithIndent(w, indent, "redistribute connected route-map OWN_PREFIX")
 	}
 	if r.Static {
-		writeWithIndent(w, indent, "redistribute static")
+		if r.StaticRouteMap != "" {
+			writeWithIndent(w, indent, "redistribute static route-map "+r.StaticRouteMap)
+		} else {
+			writeWithIndent(w, indent, "redistribute static")
+		}
 	}
 	if r.OSPF {
 		writeWithIndent(w, indent, "redistribute ospf")
@@ -38,7 +43,11 @@ func (r RouteRedistribution) Write(w io.Writer, indent int) {
 		writeWithIndent(w, indent, "redistribute isis")
 	}
 	if r.BGP {
-		writeWithIndent(w, indent, "redistribute bgp")
+		if r.BGPRouteMap != "" {
+			writeWithIndent(w, indent, "redistribute bgp route-map "+r.BGPRouteMap)
+		} else {
+			writeWithIndent(w, indent, "redistribute bgp")
+		}
 	}
 }
 
@@ -103,10 +112,91 @@ func (c OSPFIfConfig) Write(dst io.Writer) {
 	if c.Cost > 0 {
 		fmt.Fprintln(dst, " bandwidth", c.Cost)
 	}
+	if c.V4 && c.Broadcast {
+		fmt.Fprintln(dst, " ip ospf network broadcast")
+	}
+	if c.V4 && c.Priority > 0 {
+		fmt.Fprintln(dst, " ip ospf priority", c.Priority)
+	}
+	if c.V6 && c.Broadcast {
+		fmt.Fprintln(dst, " ipv6 ospf6 network broadcast")
+	}
+	if c.V6 && c.Priority > 0 {
+		fmt.Fprintln(dst, " ipv6 ospf6 priority", c.Priority)
+	}
+	if c.V6 && c.Passive {
+		fmt.Fprintln(dst, " ipv6 ospf6 passive")
+	}
+	if c.V4 && c.BFD != "" {
+		fmt.Fprintln(dst, " ip ospf bfd profile", c.BFD)
+	}
+	if c.V6 && c.BFD != "" {
+		fmt.Fprintln(dst, " ipv6 ospf6 bfd profile", c.BFD)
+	}
+}
+
+// is6 returns true if the prefix (possibly followed by a length range) is an
+// IPv6 prefix
+func (pl *PrefixList) is6() bool {
+	fields := strings.Fields(pl.Prefix)
+	if len(fields) == 0 {
+		return false
+	}
+	ip, _, err := net.ParseCIDR(fields[0])
+	return err == nil && ip.To4() == nil
 }
 
 func (pl *PrefixList) WriteMatch(dst io.Writer) {
-	fmt.Fprintln(dst, " match ip address prefix-list", pl.Name)
+	if pl.is6() {
+		fmt.Fprintln(dst, " match ipv6 address prefix-list", pl.Name)
+	} else {
+		fmt.Fprintln(dst, " match ip address prefix-list", pl.Name)
+	}
+}
+
+func (pl *PrefixList) Write(dst io.Writer) {
+	action := "permit"
+	if pl.Deny {
+		action = "deny"
+	}
+	if pl.is6() {
+		fmt.Fprintln(dst, "ipv6 prefix-list", pl.Name, action, pl.Prefix)
+	} else {
+		fmt.Fprintln(dst, "ip prefix-list", pl.Name, action, pl.Prefix)
+	}
+}
+
+func (l *ASPathList) WriteMatch(dst io.Writer) {
+	fmt.Fprintln(dst, " match as-path", l.Name)
+}
+
+func (l *ASPathList) Write(dst io.Writer) {
+	fmt.Fprintln(dst, "bgp as-path access-list", l.Name, "permit", l.Regex)
+}
+
+func (m *NextHopMatch) WriteMatch(dst io.Writer) {
+	fmt.Fprintln(dst, " match ip next-hop prefix-list", m.PrefixList)
+}
+
+func (rm *RouteMap) Write(dst io.Writer) {
+	action := "permit"
+	if rm.Deny {
+		action = "deny"
+	}
+	fmt.Fprintln(dst, "route-map", rm.Name, action, rm.Order)
+	if rm.Match != nil {
+		rm.Match.WriteMatch(dst)
+	}
+	for _, s := range rm.Set {
+		fmt.Fprintln(dst, " set", s)
+	}
+	if rm.Call != "" {
+		fmt.Fprintln(dst, " call", rm.Call)
+	}
+	if rm.OnMatchNext {
+		fmt.Fprintln(dst, " on-match next")
+	}
+	sep(dst)
 }
 
 func (c *FRRConfig) firstLoopback(ipv6 bool) (res net.IP, found bool) {
@@ -12,290 +12,368 @@ import (
 	"github.com/rahveiz/topomate/utils"
 )
 
-var nextRouteTarget = 1
-var nextRouteDescriptor = 1
-
 func GenerateConfig(p *project.Project) [][]*FRRConfig {
 	configs := make([][]*FRRConfig, len(p.AS)+1)
 	idx := 0
-	for i, as := range p.AS {
-		n := as.TotalContainers()
-		is4 := as.Network.IPNet.IP.To4() != nil
-
-		configs[idx] = make([]*FRRConfig, 0, n)
-		for _, r := range as.Routers {
-			c := &FRRConfig{
-				Hostname:     r.Hostname,
-				Interfaces:   make(map[string]IfConfig, n),
-				StaticRoutes: initStatic(len(r.Links)),
-				MPLS:         as.MPLS,
-				DefaultIPv6:  !is4,
-			}
+	for _, as := range p.AS {
+		configs[idx] = generateASConfigs(p, as)
+		idx++
+	}
+	configs[idx] = generateIXPConfigs(p)
+	return configs
+}
 
-			// Loopback interface
-			nbLo := len(r.Loopback)
-			if nbLo > 0 {
-				ips := make([]net.IPNet, nbLo)
-				for idx, ip := range r.Loopback {
-					ips[idx] = ip
-				}
-				c.Interfaces["lo"] = IfConfig{
-					IPs:       ips,
-					IGPConfig: make([]IGPIfConfig, 0, 5),
-				}
-			}
+// generateASConfigs returns the configurations of the routers of the AS,
+// indexed by router ID - 1 and nil for the routers using other daemons,
+// followed by the ones of its VPN customers
+func generateASConfigs(p *project.Project, as *project.AutonomousSystem) []*FRRConfig {
+	configs := make([]*FRRConfig, 0, as.TotalContainers())
+	for _, r := range as.Routers {
+		// routers using other daemons are rendered by their backend
+		if r.Daemon != project.DaemonFRR {
+			configs = append(configs, nil)
+			continue
+		}
+		configs = append(configs, generateRouterConfig(p, as, r))
+	}
 
-			// RPKI
-			tmp := strings.Builder{}
-			writeRPKI(&tmp, p.RPKI, as.RPKI.Servers)
-			c.RPKIBuffer = tmp.String()
-
-			// BGP
-			c.BGP = BGPConfig{
-				ASN:       i,
-				Neighbors: make(map[string]BGPNbr, n),
-				Disabled:  as.BGP.Disabled,
-				Redistribute: RouteRedistribution{
-					ConnectedOwn: true,
-				},
-			}
+	// VPNS
+	return append(configs, generateVPNConfig(as, configs)...)
+}
 
-			if is4 {
-				c.BGP.Networks.V4 = []string{as.Network.IPNet.String()}
-			} else {
-				c.BGP.Networks.V6 = []string{as.Network.IPNet.String()}
-			}
+// generateRouterConfig returns the configuration of a router of the AS
+func generateRouterConfig(p *project.Project, as *project.AutonomousSystem, r *project.Router) *FRRConfig {
+	n := as.TotalContainers()
+	is4 := as.Network.IPNet.IP.To4() != nil
+
+	c := &FRRConfig{
+		Hostname:     r.Hostname,
+		Interfaces:   make(map[string]IfConfig, n),
+		StaticRoutes: initStatic(len(r.Links)),
+		MPLS:         as.MPLS,
+		DefaultIPv6:  !is4,
+	}
 
-			c.BGP.setupRouterID(r)
+	// Loopback interface
+	nbLo := len(r.Loopback)
+	if nbLo > 0 {
+		ips := make([]net.IPNet, nbLo)
+		for idx, ip := range r.Loopback {
+			ips[idx] = ip
+		}
+		c.Interfaces["lo"] = IfConfig{
+			IPs:       ips,
+			IGPConfig: make([]IGPIfConfig, 0, 5),
+		}
+	}
 
-			// IGP
-			igp := strings.ToUpper(as.IGP)
-			switch igp {
-			case "OSPF":
-				if as.BGP.RedistributeIGP {
-					c.BGP.Redistribute.OSPF = true
-				}
-				// Check if we need to setup OSPFv2 or OSPFv3
-				if !is4 {
-					c.IGP = append(c.IGP, getOSPF6Config(c.BGP.RouterID))
-				}
+	// RPKI
+	tmp := strings.Builder{}
+	writeRPKI(&tmp, p.RPKI, as.RPKI.Servers)
+	c.RPKIBuffer = tmp.String()
+
+	// BGP
+	c.BGP = BGPConfig{
+		ASN:       as.ASN,
+		Neighbors: make(map[string]BGPNbr, n),
+		Disabled:  as.BGP.Disabled,
+		Redistribute: RouteRedistribution{
+			ConnectedOwn: true,
+		},
+		MaximumPaths:     as.BGP.MaximumPaths,
+		MaximumPathsIBGP: as.BGP.MaximumPathsIBGP,
+		MultipathRelax:   as.BGP.MultipathRelax,
+		ClusterID:        r.ClusterID,
+		SubAS:            r.SubAS,
+		ConfedPeers:      as.ConfederationPeers(r),
+	}
 
-				oCfg := getOSPFConfig(c.BGP.RouterID, 0)
+	if is4 {
+		c.BGP.Networks.V4 = []string{as.Network.IPNet.String()}
+	} else {
+		c.BGP.Networks.V6 = []string{as.Network.IPNet.String()}
+	}
 
-				// No custom config or OSPFv3 (areas not supported)
-				if r.IGP.OSPF == nil || !is4 {
-					c.IGP = append(c.IGP, oCfg)
-					break
-				}
+	c.BGP.setupRouterID(r)
 
-				for _, oNet := range r.IGP.OSPF {
-					oCfg.Networks = append(oCfg.Networks, oNet)
-					if as.IsOSPFStub(oNet.Area) {
-						oCfg.Stubs[oNet.Area] = true
-					}
-				}
-				// add loopback in the first area specified
-				oCfg.Networks = append(oCfg.Networks, project.OSPFNet{
-					Area:   oCfg.Networks[0].Area,
-					Prefix: r.Loopback[0].String(),
-				})
-				c.IGP = append(c.IGP, oCfg)
+	// IGP
+	igp := strings.ToUpper(as.IGP)
+	switch igp {
+	case "OSPF":
+		if as.BGP.RedistributeIGP {
+			c.BGP.Redistribute.OSPF = true
+		}
+		// Check if we need to setup OSPFv2 or OSPFv3
+		if !is4 {
+			c.IGP = append(c.IGP, getOSPF6Config(c.BGP.RouterID))
+		}
 
-				break
-			case "IS-IS", "ISIS":
-				if as.BGP.RedistributeIGP {
-					c.BGP.Redistribute.ISIS = true
-				}
-				// Default level is 2
-				lvl := 2
-				if r.IGP.ISIS.Level != 0 {
-					lvl = r.IGP.ISIS.Level
-				}
-				c.IGP = append(c.IGP, c.getISISConfig(
-					r.IGP.ISIS.Area, lvl, RouteRedistribution{}))
-				break
-			default:
-				break
-			}
+		oCfg := getOSPFConfig(c.BGP.RouterID, 0)
+		if is4 {
+			oCfg.SR = getSRIGPConfig(&as.SR, r)
+		}
 
-			// Interfaces
-			for _, iface := range r.Links {
-				ifCfg := IfConfig{
-					IPs:         []net.IPNet{iface.IP},
-					Description: iface.Description,
-					Speed:       iface.Speed,
-					External:    iface.External,
-					IGPConfig:   make([]IGPIfConfig, 0, 5),
-				}
-				if !iface.External {
-					ip4, ip6 := ifCfg.GetIPType()
-
-					switch igp {
-					case "OSPF":
-						if r.IGP.OSPF == nil {
-							ifCfg.IGPConfig =
-								append(ifCfg.IGPConfig, OSPFIfConfig{
-									V4:        ip4,
-									V6:        ip6,
-									Cost:      iface.Cost,
-									ProcessID: 0,
-									Area:      0,
-								})
-						}
-					case "ISIS", "IS-IS":
-						// Default circuit-type is 2
-						circuit := iface.IGP.ISIS.Circuit
-						if circuit == 0 {
-							circuit = 2
-						}
-
-						ifCfg.IGPConfig =
-							append(ifCfg.IGPConfig, ISISIfConfig{
-								V4:          ip4,
-								V6:          ip6,
-								ProcessName: isisDefaultProcess,
-								Cost:        iface.Cost,
-								Passive:     iface.IGP.ISIS.Passive,
-								CircuitType: circuit,
-							})
-
-						break
-					}
-				}
-				c.Interfaces[iface.IfName] = ifCfg
+		// No custom config or OSPFv3 (areas not supported)
+		if r.IGP.OSPF == nil || !is4 {
+			c.IGP = append(c.IGP, oCfg)
+			break
+		}
+
+		for _, oNet := range r.IGP.OSPF {
+			oCfg.Networks = append(oCfg.Networks, oNet)
+			if as.IsOSPFStub(oNet.Area) {
+				oCfg.Stubs[oNet.Area] = true
 			}
+		}
+		// add loopback in the first area specified
+		oCfg.Networks = append(oCfg.Networks, project.OSPFNet{
+			Area:   oCfg.Networks[0].Area,
+			Prefix: r.Loopback[0].String(),
+		})
+		c.IGP = append(c.IGP, oCfg)
+
+		break
+	case "IS-IS", "ISIS":
+		if as.BGP.RedistributeIGP {
+			c.BGP.Redistribute.ISIS = true
+		}
+		// Default level is 2
+		lvl := 2
+		if r.IGP.ISIS.Level != 0 {
+			lvl = r.IGP.ISIS.Level
+		}
+		isisCfg := c.getISISConfig(
+			r.IGP.ISIS.Area, lvl, RouteRedistribution{})
+		isisCfg.SR = getSRIGPConfig(&as.SR, r)
+		isisCfg.LSPMTU = isisLSPMTU(r)
+		c.IGP = append(c.IGP, isisCfg)
+		break
+	default:
+		break
+	}
 
-			// Also add IGP config for loopback interface
-			if nbLo > 0 {
-				ifCfg := c.Interfaces["lo"]
-				ip4, ip6 := ifCfg.GetIPType()
-				switch igp {
-				case "OSPF":
-					if r.IGP.OSPF == nil {
-						ifCfg.IGPConfig =
-							append(ifCfg.IGPConfig, OSPFIfConfig{
-								V4:        ip4,
-								V6:        ip6,
-								ProcessID: 0,
-								Area:      0,
-							})
-					}
-				case "ISIS", "IS-IS":
+	// Interfaces
+	for _, iface := range r.Links {
+		ifCfg := IfConfig{
+			IPs:         []net.IPNet{iface.IP},
+			Description: iface.Description,
+			Speed:       iface.Speed,
+			External:    iface.External,
+			IGPConfig:   make([]IGPIfConfig, 0, 5),
+			VRF:         iface.VRF,
+			MPLSBGP:     iface.MPLSBGP,
+		}
+		if !iface.External {
+			ip4, ip6 := ifCfg.GetIPType()
+
+			switch igp {
+			case "OSPF":
+				if r.IGP.OSPF == nil {
 					ifCfg.IGPConfig =
-						append(ifCfg.IGPConfig, ISISIfConfig{
-							V4:          ip4,
-							V6:          ip6,
-							ProcessName: isisDefaultProcess,
-							Passive:     true,
+						append(ifCfg.IGPConfig, OSPFIfConfig{
+							V4:        ip4,
+							V6:        ip6,
+							Cost:      iface.Cost,
+							ProcessID: 0,
+							Area:      0,
+							Broadcast: iface.IGP.Broadcast,
+							Priority:  iface.IGP.Priority,
+							Passive:   iface.IGP.Passive,
+							BFD:       iface.IGP.BFD,
 						})
-					break
 				}
-				c.Interfaces["lo"] = ifCfg
+			case "ISIS", "IS-IS":
+				// Default circuit-type is 2
+				circuit := iface.IGP.ISIS.Circuit
+				if circuit == 0 {
+					circuit = 2
+				}
+
+				ifCfg.IGPConfig =
+					append(ifCfg.IGPConfig, ISISIfConfig{
+						V4:          ip4,
+						V6:          ip6,
+						ProcessName: isisDefaultProcess,
+						Cost:        iface.Cost,
+						Passive:     iface.IGP.ISIS.Passive,
+						CircuitType: circuit,
+						Priority:    iface.IGP.Priority,
+						BFD:         iface.IGP.BFD,
+					})
+
+				break
 			}
+		}
+		c.Interfaces[iface.IfName] = ifCfg
+	}
 
-			// Add static entries for BGP neighbors
-			for ip, nbr := range r.Neighbors {
-				c.BGP.Neighbors[ip] = BGPNbr(*nbr)
-				if nbr.RemoteAS != as.ASN {
-					// use IP instead of interface name if found (IPv6 only)
-					gw := nbr.IfName
-					found := false
-					for _, lnk := range r.Links {
-						if lnk.IfName == nbr.IfName {
-							remoteLink := p.FindMatchingExtLink(lnk)
-							if remoteLink != nil && remoteLink.IP.IP.To4() == nil {
-								gw = remoteLink.IP.IP.String()
-								c.StaticRoutes.add6(ip, nbr.Mask, gw)
-								found = true
-							}
-						}
-					}
+	// Also add IGP config for loopback interface
+	if nbLo > 0 {
+		ifCfg := c.Interfaces["lo"]
+		ip4, ip6 := ifCfg.GetIPType()
+		switch igp {
+		case "OSPF":
+			if r.IGP.OSPF == nil {
+				ifCfg.IGPConfig =
+					append(ifCfg.IGPConfig, OSPFIfConfig{
+						V4:        ip4,
+						V6:        ip6,
+						ProcessID: 0,
+						Area:      0,
+					})
+			}
+		case "ISIS", "IS-IS":
+			ifCfg.IGPConfig =
+				append(ifCfg.IGPConfig, ISISIfConfig{
+					V4:          ip4,
+					V6:          ip6,
+					ProcessName: isisDefaultProcess,
+					Passive:     true,
+				})
+			break
+		}
+		c.Interfaces["lo"] = ifCfg
+	}
 
-					if !found {
-						c.StaticRoutes.add(ip, nbr.Mask, gw)
+	// Add static entries for BGP neighbors
+	for ip, nbr := range r.Neighbors {
+		c.BGP.Neighbors[ip] = BGPNbr(*nbr)
+		// directly connected and multihop sessions do not need a route
+		if nbr.RemoteAS != as.ASN && !nbr.ConnCheck && nbr.IfName != "" {
+			// use IP instead of interface name if found (IPv6 only)
+			gw := nbr.IfName
+			found := false
+			for _, lnk := range r.Links {
+				if lnk.IfName == nbr.IfName {
+					remoteLink := p.FindMatchingExtLink(lnk)
+					if remoteLink != nil && remoteLink.IP.IP.To4() == nil {
+						gw = remoteLink.IP.IP.String()
+						c.StaticRoutes.add6(ip, nbr.Mask, gw)
+						found = true
 					}
 				}
 			}
 
-			c.BGP.VRF = make(map[string]VRFConfig, 5)
-			configs[idx] = append(configs[idx], c)
+			if !found {
+				c.StaticRoutes.add(ip, nbr.Mask, gw)
+			}
 		}
+	}
 
-		// VPNS
-		configs[idx] = append(configs[idx], generateVPNConfig(as, configs[idx])...)
-		idx++
-		// Reset RD / RT values for the next AS
-		nextRouteTarget = 1
-		nextRouteDescriptor = 1
+	// SR-TE policies (headend only)
+	c.setupSRTE(&as.SR, r)
+
+	c.setupBFD(r)
+
+	// RPKI origin validation on eBGP sessions
+	c.setupRPKIPolicy(as)
+
+	// Additional prefixes
+	c.setupOriginate(as, r)
+
+	// Hijacked prefixes and leaked routes
+	c.setupAttacks(r)
+
+	c.BGP.VRF = make(map[string]VRFConfig, 5)
+
+	// Inter-AS VPNs
+	c.setupInterAS(as, r)
+
+	// EVPN
+	c.setupEVPN(&as.EVPN, r)
+
+	// Hosts and LANs addressed outside of the AS prefix
+	for _, subnet := range as.ExtraSubnets(r) {
+		if subnet.IP.To4() != nil {
+			c.BGP.Networks.V4 = append(c.BGP.Networks.V4, subnet.String())
+		} else {
+			c.BGP.Networks.V6 = append(c.BGP.Networks.V6, subnet.String())
+		}
 	}
-	configs[idx] = generateIXPConfigs(p)
-	return configs
+
+	return c
 }
 
 func generateIXPConfigs(p *project.Project) []*FRRConfig {
-	configs := make([]*FRRConfig, len(p.IXPs))
-	for idx, ixp := range p.IXPs {
-		c := &FRRConfig{
-			Hostname:     ixp.RouteServer.Hostname,
-			IXP:          true,
-			Interfaces:   make(map[string]IfConfig, 2), // to IXP brige + lo
-			StaticRoutes: initStatic(len(ixp.RouteServer.Links)),
+	configs := make([]*FRRConfig, 0, len(p.IXPs))
+	for _, ixp := range p.IXPs {
+		// BIRD route servers are configured by the bird package
+		if ixp.Daemon == project.RSDaemonBird {
+			continue
+		}
+		for _, rs := range ixp.RouteServers {
+			configs = append(configs, generateRSConfig(p, &ixp, rs))
 		}
+	}
+	return configs
+}
 
-		is4 := true
+func generateRSConfig(p *project.Project, ixp *project.IXP, rs *project.Router) *FRRConfig {
+	c := &FRRConfig{
+		Hostname:     rs.Hostname,
+		IXP:          true,
+		Interfaces:   make(map[string]IfConfig, 2), // to IXP brige + lo
+		StaticRoutes: initStatic(len(rs.Links)),
+	}
 
-		// Loopback interface
-		nbLo := len(ixp.RouteServer.Loopback)
-		if nbLo > 0 {
-			ips := make([]net.IPNet, nbLo)
-			for idx, ip := range ixp.RouteServer.Loopback {
-				ips[idx] = ip
-			}
-			c.Interfaces["lo"] = IfConfig{
-				IPs: ips,
-			}
-			is4 = ixp.RouteServer.Loopback[0].IP.To4 != nil
-		}
+	is4 := true
 
-		// BGP
-		c.BGP = BGPConfig{
-			ASN:       ixp.ASN,
-			Neighbors: make(map[string]BGPNbr),
+	// Loopback interface
+	nbLo := len(rs.Loopback)
+	if nbLo > 0 {
+		ips := make([]net.IPNet, nbLo)
+		for idx, ip := range rs.Loopback {
+			ips[idx] = ip
 		}
+		c.Interfaces["lo"] = IfConfig{
+			IPs: ips,
+		}
+		is4 = rs.Loopback[0].IP.To4() != nil
+	}
 
-		c.BGP.setupRouterID(ixp.RouteServer)
+	// BGP
+	c.BGP = BGPConfig{
+		ASN:       ixp.ASN,
+		Neighbors: make(map[string]BGPNbr),
+	}
 
-		for ip, nbr := range ixp.RouteServer.Neighbors {
-			c.BGP.Neighbors[ip] = BGPNbr(*nbr)
-			if nbr.RemoteAS != ixp.ASN {
-				if is4 {
-					c.StaticRoutes.add(ip, nbr.Mask, nbr.IfName)
-				} else {
-					c.StaticRoutes.add6(ip, nbr.Mask, nbr.IfName)
-				}
+	c.BGP.setupRouterID(rs)
+
+	for ip, nbr := range rs.Neighbors {
+		c.BGP.Neighbors[ip] = BGPNbr(*nbr)
+		if nbr.RemoteAS != ixp.ASN {
+			if is4 {
+				c.StaticRoutes.add(ip, nbr.Mask, nbr.IfName)
+			} else {
+				c.StaticRoutes.add6(ip, nbr.Mask, nbr.IfName)
 			}
 		}
+	}
 
-		// Interfaces
-		for _, iface := range ixp.RouteServer.Links {
-			ifCfg := IfConfig{
-				IPs:         []net.IPNet{iface.IP},
-				Description: iface.Description,
-				Speed:       iface.Speed,
-				External:    iface.External,
-			}
-			c.Interfaces[iface.IfName] = ifCfg
-			configs[idx] = c
+	// RPKI and members policies
+	var tmp strings.Builder
+	writeRPKI(&tmp, p.RPKI, ixp.RPKI)
+	c.RPKIBuffer = tmp.String()
+	c.setupRSPolicy(ixp)
+
+	// Interfaces
+	for _, iface := range rs.Links {
+		ifCfg := IfConfig{
+			IPs:         []net.IPNet{iface.IP},
+			Description: iface.Description,
+			Speed:       iface.Speed,
+			External:    iface.External,
 		}
+		c.Interfaces[iface.IfName] = ifCfg
 	}
-	return configs
+	return c
 }
 
 func sep(w io.Writer) {
 	fmt.Fprintln(w, "!")
 }
 
-func writeOSPF(dst io.Writer, c OSPFConfig) {
+func writeOSPF(dst io.Writer, c OSPFConfig, ifs map[string]IfConfig) {
 	sep(dst)
 
 	if c.ProcessID > 0 {
@@ -316,6 +394,21 @@ func writeOSPF(dst io.Writer, c OSPFConfig) {
 	for stub := range c.Stubs {
 		fmt.Fprintln(dst, " area", stub, "stub")
 	}
+	for n, i := range ifs {
+		if i.VRF != c.VRF {
+			continue
+		}
+		for _, e := range i.IGPConfig {
+			if o, ok := e.(OSPFIfConfig); ok && o.V4 && o.Passive && o.ProcessID == c.ProcessID {
+				fmt.Fprintln(dst, " passive-interface", n)
+			}
+		}
+	}
+	if c.SR != nil {
+		fmt.Fprintln(dst, " capability opaque")
+		fmt.Fprintln(dst, " router-info area")
+		c.SR.Write(dst)
+	}
 
 	sep(dst)
 }
@@ -359,13 +452,21 @@ func writeInterface(dst io.Writer, name string, c IfConfig) {
 		fmt.Fprintln(dst, " description", c.Description)
 	}
 	for _, ip := range c.IPs {
-		if len(ip.IP) > 0 {
+		if len(ip.IP) == 0 {
+			continue
+		}
+		if ip.IP.To4() != nil {
 			fmt.Fprintln(dst, " ip address", ip.String())
+		} else {
+			fmt.Fprintln(dst, " ipv6 address", ip.String())
 		}
 	}
 	for _, i := range c.IGPConfig {
 		i.Write(dst)
 	}
+	if c.MPLSBGP {
+		fmt.Fprintln(dst, " mpls bgp forwarding")
+	}
 
 	sep(dst)
 }
@@ -401,7 +502,7 @@ func (c *FRRConfig) writeMPLS(dst io.Writer) {
 func WriteConfig(c FRRConfig) {
 	genDir := utils.GetDirectoryFromKey("ConfigDir", "")
 	var filename string
-	if c.BGP.ASN == 0 {
+	if c.BGP.ASN == 0 || c.Customer {
 		filename = fmt.Sprintf("%s/conf_cust_%s", genDir, c.Hostname)
 	} else {
 		filename = fmt.Sprintf("%s/conf_%d_%s", genDir, c.BGP.ASN, c.Hostname)
@@ -415,6 +516,11 @@ func WriteConfig(c FRRConfig) {
 	}
 	defer file.Close()
 
+	writeConfig(file, c)
+}
+
+// writeConfig writes the FRR configuration c in w
+func writeConfig(w io.Writer, c FRRConfig) {
 	dst := &strings.Builder{}
 
 	fmt.Fprintf(dst,
@@ -431,10 +537,14 @@ password topomate
 		writeInterface(dst, name, cfg)
 	}
 
+	c.writeL3VNIs(dst)
+
 	c.StaticRoutes.Write(dst)
 
 	fmt.Fprintf(dst, c.RPKIBuffer)
 
+	c.BFD.Write(dst)
+
 	if c.BGP.ASN > 0 && !c.BGP.Disabled {
 		c.BGP.Write(dst)
 	}
@@ -442,7 +552,7 @@ password topomate
 	for _, igp := range c.IGP {
 		switch igp.(type) {
 		case OSPFConfig:
-			writeOSPF(dst, igp.(OSPFConfig))
+			writeOSPF(dst, igp.(OSPFConfig), c.Interfaces)
 			break
 		case OSPF6Config:
 			writeOSPF6(dst, igp.(OSPF6Config), c.internalIfs())
@@ -459,17 +569,23 @@ password topomate
 		c.writeMPLS(dst)
 	}
 
+	if c.SRTE != nil {
+		c.SRTE.Write(dst)
+	}
+
 	c.writeUtilities(dst)
 
 	fmt.Fprintln(dst, "line vty")
 
-	file.WriteString(dst.String())
-
+	io.WriteString(w, dst.String())
 }
 
 func WriteAll(configs [][]*FRRConfig) {
 	for _, asCfg := range configs {
 		for _, cfg := range asCfg {
+			if cfg == nil { // rendered by another backend
+				continue
+			}
 			WriteConfig(*cfg)
 		}
 	}
@@ -0,0 +1,62 @@
+package frr
+
+import (
+	"github.com/rahveiz/topomate/project"
+)
+
+// setupInterAS configures the VRFs facing another AS (inter-AS option A) and
+// the exchange of loopbacks between ASBRs (inter-AS option C)
+func (c *FRRConfig) setupInterAS(as *project.AutonomousSystem, r *project.Router) {
+	for vrf, nbrs := range r.VRFNeighbors {
+		vpn := as.FindVPN(vrf)
+		cfg := VRFConfig{
+			RD: vpn.RD,
+			RT: RouteTarget{
+				In:  vpn.ImportRT,
+				Out: vpn.ExportRT,
+			},
+			IPv4:      vpn.IPv4,
+			IPv6:      vpn.IPv6,
+			Neighbors: make(map[string]BGPNbr, len(nbrs)),
+		}
+		for ip, nbr := range nbrs {
+			cfg.Neighbors[ip] = BGPNbr(*nbr)
+		}
+		c.BGP.VRF[vrf] = cfg
+	}
+
+	if len(r.InterASLoopbacks) == 0 {
+		return
+	}
+
+	// Announce our loopbacks to the other AS, and inject its loopbacks
+	// in our IGP so the PEs can reach the remote next-hops
+	for _, lo := range as.Loopbacks() {
+		if lo.IP.To4() != nil {
+			c.BGP.Networks.V4 = append(c.BGP.Networks.V4, lo.String())
+		}
+	}
+	for _, lo := range r.InterASLoopbacks {
+		c.PrefixLists = append(c.PrefixLists, PrefixList{
+			Name:   "INTERAS_LOOPBACKS",
+			Prefix: lo.String(),
+		})
+	}
+	c.RouteMaps = append(c.RouteMaps, RouteMap{
+		Name:  "INTERAS_LOOPBACKS",
+		Order: 10,
+		Match: &PrefixList{Name: "INTERAS_LOOPBACKS"},
+	})
+	for i, igp := range c.IGP {
+		switch cfg := igp.(type) {
+		case OSPFConfig:
+			cfg.Redistribute.BGP = true
+			cfg.Redistribute.BGPRouteMap = "INTERAS_LOOPBACKS"
+			c.IGP[i] = cfg
+		case ISISConfig:
+			cfg.Redistribute.BGP = true
+			cfg.Redistribute.BGPRouteMap = "INTERAS_LOOPBACKS"
+			c.IGP[i] = cfg
+		}
+	}
+}
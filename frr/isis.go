@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/rahveiz/topomate/project"
 	"github.com/rahveiz/topomate/utils"
 )
 
@@ -13,6 +14,9 @@ type ISISConfig struct {
 	Type         int
 	Redistribute RouteRedistribution
 	VRF          string
+	SR           *SRIGPConfig
+	// LSPMTU is set when the LSPs do not fit in the interfaces MTU
+	LSPMTU int
 }
 
 type ISISIfConfig struct {
@@ -22,6 +26,8 @@ type ISISIfConfig struct {
 	CircuitType int
 	Cost        int
 	Passive     bool
+	Priority    int
+	BFD         string
 }
 
 func (c ISISConfig) writeISIS(dst io.Writer, v4, v6 bool) {
@@ -31,6 +37,9 @@ func (c ISISConfig) writeISIS(dst io.Writer, v4, v6 bool) {
 	fmt.Fprintln(dst, " net", c.ISO)
 	fmt.Fprintln(dst, " metric-style wide")
 	fmt.Fprintln(dst, " is-type", isisTypeString(c.Type))
+	if c.LSPMTU > 0 {
+		fmt.Fprintln(dst, " lsp-mtu", c.LSPMTU)
+	}
 
 	// If L1L2, we distribute a default route to the L1 neighbors
 	if c.Type == 3 {
@@ -46,6 +55,8 @@ func (c ISISConfig) writeISIS(dst io.Writer, v4, v6 bool) {
 	// Here we write the redistribution manually as ISIS syntax is not standard
 	c.writeRedistribute(dst, v4, v6)
 
+	c.SR.Write(dst)
+
 	sep(dst)
 }
 
@@ -65,6 +76,13 @@ func (c ISISIfConfig) Write(dst io.Writer) {
 	if c.Cost > 0 {
 		fmt.Fprintln(dst, " isis metric", c.Cost)
 	}
+	if c.Priority > 0 {
+		fmt.Fprintln(dst, " isis priority", c.Priority)
+	}
+	if c.BFD != "" && !c.Passive {
+		fmt.Fprintln(dst, " isis bfd")
+		fmt.Fprintln(dst, " isis bfd profile", c.BFD)
+	}
 }
 
 func (c ISISConfig) writeRedistribution(w io.Writer, af string, level string) {
@@ -78,7 +96,11 @@ func (c ISISConfig) writeRedistribution(w io.Writer, af string, level string) {
 		fmt.Fprintln(w, " redistribute", af, "ospf", level)
 	}
 	if c.Redistribute.BGP {
-		fmt.Fprintln(w, " redistribute", af, "bgp", level)
+		if c.Redistribute.BGPRouteMap != "" {
+			fmt.Fprintln(w, " redistribute", af, "bgp", level, "route-map", c.Redistribute.BGPRouteMap)
+		} else {
+			fmt.Fprintln(w, " redistribute", af, "bgp", level)
+		}
 	}
 }
 
@@ -139,3 +161,19 @@ func (c *FRRConfig) getISISConfig(area, t int, distrib RouteRedistribution) ISIS
 	cfg.ISO = iso
 	return cfg
 }
+
+// isisLSPMTU returns the LSP size fitting in the smallest MTU of the IS-IS
+// interfaces of r, or 0 if the default size can be used
+func isisLSPMTU(r *project.Router) int {
+	min := project.DefaultMTU
+	for _, iface := range r.Links {
+		if !iface.External && iface.EffectiveMTU() < min {
+			min = iface.EffectiveMTU()
+		}
+	}
+	if min == project.DefaultMTU {
+		return 0
+	}
+	// 3 bytes for the LLC header
+	return min - 3
+}
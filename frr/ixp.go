@@ -0,0 +1,175 @@
+package frr
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+type CommunityList struct {
+	Name      string
+	Community string
+}
+
+func (l *CommunityList) WriteMatch(dst io.Writer) {
+	fmt.Fprintln(dst, " match community", l.Name)
+}
+
+func (l *CommunityList) Write(dst io.Writer) {
+	fmt.Fprintln(dst, "bgp community-list standard", l.Name, "permit", l.Community)
+}
+
+// setupRSPolicy creates the import and export route-maps of the members of
+// the IXP on a route server:
+//   - RS_IN_<ASN> drops the RPKI invalid routes and the prefixes not
+//     originated by the customer cone of the member
+//   - RS_OUT_<ASN> applies the action communities: 0:<ASN> (do not announce
+//     to the member), 0:<RS> (do not announce) and <RS>:<ASN> (announce only
+//     to the members listed), and removes them
+func (c *FRRConfig) setupRSPolicy(ixp *project.IXP) {
+	asns := make([]int, 0, len(ixp.Members()))
+	seen := make(map[int]bool, len(ixp.Members()))
+	for _, lnk := range ixp.Members() {
+		if !seen[lnk.ASN] {
+			seen[lnk.ASN] = true
+			asns = append(asns, lnk.ASN)
+		}
+	}
+	sort.Ints(asns)
+
+	if ixp.Filter || len(ixp.RPKI) > 0 {
+		for _, asn := range asns {
+			c.rsImportMap(ixp, asn)
+		}
+	}
+	if !ixp.Communities {
+		return
+	}
+
+	// communities targeting a member, and all the action communities
+	targets := false
+	for _, asn := range asns {
+		if asn > 0xffff {
+			continue
+		}
+		targets = true
+		c.CommunityLists = append(c.CommunityLists, CommunityList{
+			Name:      "RS_TO_ANY",
+			Community: fmt.Sprintf("%d:%d", ixp.ASN, asn),
+		})
+	}
+	actions := []string{fmt.Sprintf("0:%d", ixp.ASN)}
+	for _, asn := range asns {
+		if asn <= 0xffff {
+			actions = append(actions, fmt.Sprintf("0:%d", asn), fmt.Sprintf("%d:%d", ixp.ASN, asn))
+		}
+	}
+	for _, comm := range actions {
+		c.CommunityLists = append(c.CommunityLists, CommunityList{
+			Name:      "RS_ACTIONS",
+			Community: comm,
+		})
+	}
+	strip := "comm-list RS_ACTIONS delete"
+
+	for _, asn := range asns {
+		name := fmt.Sprintf("RS_OUT_%d", asn)
+		noExport := CommunityList{
+			Name:      fmt.Sprintf("RS_NO_%d", asn),
+			Community: fmt.Sprintf("0:%d", ixp.ASN),
+		}
+		c.CommunityLists = append(c.CommunityLists, noExport)
+		if asn <= 0xffff {
+			c.CommunityLists = append(c.CommunityLists, CommunityList{
+				Name:      noExport.Name,
+				Community: fmt.Sprintf("0:%d", asn),
+			})
+		}
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 10,
+			Match: &noExport,
+			Deny:  true,
+		})
+		if asn <= 0xffff {
+			target := CommunityList{
+				Name:      fmt.Sprintf("RS_TO_%d", asn),
+				Community: fmt.Sprintf("%d:%d", ixp.ASN, asn),
+			}
+			c.CommunityLists = append(c.CommunityLists, target)
+			c.RouteMaps = append(c.RouteMaps, RouteMap{
+				Name:  name,
+				Order: 20,
+				Match: &target,
+				Set:   []string{strip},
+			})
+		}
+		if targets {
+			c.RouteMaps = append(c.RouteMaps, RouteMap{
+				Name:  name,
+				Order: 30,
+				Match: &CommunityList{Name: "RS_TO_ANY"},
+				Deny:  true,
+			})
+		}
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 100,
+			Set:   []string{strip},
+		})
+	}
+}
+
+// rsImportMap creates the import route-map of a member
+func (c *FRRConfig) rsImportMap(ixp *project.IXP, asn int) {
+	name := fmt.Sprintf("RS_IN_%d", asn)
+	if len(ixp.RPKI) > 0 {
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 10,
+			Match: &RPKIMatch{State: "invalid"},
+			Deny:  true,
+		})
+	}
+	if !ixp.Filter {
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 100,
+		})
+		return
+	}
+
+	// one entry per family, the routes of the other family do not match
+	lists := []PrefixList{
+		{Name: fmt.Sprintf("RS_%d", asn)},
+		{Name: fmt.Sprintf("RS6_%d", asn)},
+	}
+	order := 20
+	for i, v4 := range []bool{true, false} {
+		prefixes := ixp.MemberPrefixes(asn, v4)
+		if len(prefixes) == 0 {
+			continue
+		}
+		pl := lists[i]
+		for _, prefix := range prefixes {
+			pl.Prefix = prefix
+			c.PrefixLists = append(c.PrefixLists, pl)
+		}
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: order,
+			Match: &pl,
+		})
+		order += 10
+	}
+	if order == 20 {
+		// nothing is accepted from the member
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 20,
+			Deny:  true,
+		})
+	}
+}
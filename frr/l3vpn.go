@@ -2,13 +2,14 @@ package frr
 
 import (
 	"net"
-	"strings"
 
 	"github.com/rahveiz/topomate/project"
 )
 
+var defaultRoute4 = net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+var defaultRoute6 = net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+
 func generateVPNConfig(as *project.AutonomousSystem, ASconfigs []*FRRConfig) []*FRRConfig {
-	is4 := as.Network.Is4()
 	total := 0
 	for _, vpn := range as.VPN {
 		total += len(vpn.Customers)
@@ -16,17 +17,12 @@ func generateVPNConfig(as *project.AutonomousSystem, ASconfigs []*FRRConfig) []*
 	res := make([]*FRRConfig, 0, total)
 
 	for _, vpn := range as.VPN {
-		rtIn, rtOut := nextRouteTarget, nextRouteTarget
-
-		// if hub is set, we need a second route-target
-		if vpn.IsHubAndSpoke() {
-			rtOut++
-			nextRouteTarget++
-		}
-
 		for _, r := range vpn.Customers {
+			is4 := r.IsIPv4()
+
 			c := &FRRConfig{
 				Hostname:     r.Router.Hostname,
+				Customer:     true,
 				Interfaces:   make(map[string]IfConfig, 4),
 				StaticRoutes: initStatic(len(r.Router.Links)),
 			}
@@ -43,67 +39,77 @@ func generateVPNConfig(as *project.AutonomousSystem, ASconfigs []*FRRConfig) []*
 				}
 			}
 
-			// IGP
-			igp := strings.ToUpper(as.IGP)
 			parentCfg := ASconfigs[r.Parent.ID-1]
 
 			parentRt := RouteTarget{
-				In:  rtIn,
-				Out: rtOut,
+				In:  vpn.ImportRT,
+				Out: vpn.ExportRT,
 			}
 
 			// if we use hub-and-spoke VPN, some modifications are made on the hub
 			if vpn.IsHubAndSpoke() && r.Hub {
 				// invert the route-targets for the hub (only need to export)
 				parentRt = RouteTarget{
-					Out: rtIn,
+					Out: vpn.ImportRT,
 				}
 
 				// on the hub PE, we also add config for the downstream vrf
 				parentCfg.BGP.VRF[vpn.VRF+"_down"] = VRFConfig{
-					RD: nextRouteDescriptor,
+					RD: vpn.DownRD,
 					RT: RouteTarget{
-						In: rtOut,
+						In: vpn.ExportRT,
 					},
+					IPv4: vpn.IPv4,
+					IPv6: vpn.IPv6,
 				}
 			}
 
-			// if BGPVRF config is not present in parent, add it
-			if _, ok := parentCfg.BGP.VRF[vpn.VRF]; !ok {
-				parentCfg.BGP.VRF[vpn.VRF] = VRFConfig{
-					RD: nextRouteDescriptor,
-					RT: parentRt,
-					Redistribute: RouteRedistribution{
-						OSPF: true,
-					},
+			// if BGPVRF config is not present in parent (or only used by
+			// EVPN), add the VPN identifiers
+			vrfCfg := parentCfg.BGP.VRF[vpn.VRF]
+			if vrfCfg.RD == "" {
+				vrfCfg.RD = vpn.RD
+				vrfCfg.RT = parentRt
+			}
+			if is4 {
+				vrfCfg.IPv4 = true
+			} else {
+				vrfCfg.IPv6 = true
+			}
+			switch r.Routing {
+			case project.PECEStatic:
+				if is4 {
+					vrfCfg.Redistribute.Static = true
+				} else {
+					vrfCfg.Redistribute6.Static = true
 				}
+			case project.PECEOSPF:
+				vrfCfg.Redistribute.OSPF = true
+			case project.PECEISIS:
+				vrfCfg.Redistribute.ISIS = true
 			}
+			parentCfg.BGP.VRF[vpn.VRF] = vrfCfg
 
 			// setup IGP for CE and VRF IGP for PE
-			switch igp {
-			case "OSPF":
-				// Check if we need to setup OSPFv2 or OSPFv3
-				if is4 {
-					oCfg := getOSPFConfig(c.BGP.RouterID, 0)
-					if r.Hub {
-						oCfg.Redistribute.Static = true
-					}
-					c.IGP = append(c.IGP, oCfg)
-
-					// Add IGP on the parent side (parent index in array is
-					// its ID - 1, as usual)
-					parentIGP := getOSPFConfig(parentCfg.BGP.RouterID, 0)
-					parentIGP.Redistribute.BGP = true
-					parentIGP.VRF = vpn.VRF
-					parentCfg.IGP = append(
-						parentCfg.IGP,
-						parentIGP,
-					)
-				} else {
-					c.IGP = append(c.IGP, getOSPF6Config(c.BGP.RouterID))
+			switch r.Routing {
+			case project.PECEOSPF:
+				oCfg := getOSPFConfig(c.BGP.RouterID, 0)
+				if r.Hub {
+					oCfg.Redistribute.Static = true
 				}
+				c.IGP = append(c.IGP, oCfg)
+
+				// Add IGP on the parent side (parent index in array is
+				// its ID - 1, as usual)
+				parentIGP := getOSPFConfig(parentCfg.BGP.RouterID, 0)
+				parentIGP.Redistribute.BGP = true
+				parentIGP.VRF = vpn.VRF
+				parentCfg.IGP = append(
+					parentCfg.IGP,
+					parentIGP,
+				)
 				break
-			case "IS-IS", "ISIS":
+			case project.PECEISIS:
 				c.IGP = append(c.IGP,
 					c.getISISConfig(1, 2, RouteRedistribution{
 						// Connected: true,
@@ -118,6 +124,9 @@ func generateVPNConfig(as *project.AutonomousSystem, ASconfigs []*FRRConfig) []*
 					parentIGP,
 				)
 				break
+			case project.PECEBGP:
+				c.setupCustomerBGP(r, vpn.SpokeSubnets)
+				break
 			default:
 				break
 			}
@@ -130,73 +139,118 @@ func generateVPNConfig(as *project.AutonomousSystem, ASconfigs []*FRRConfig) []*
 					Speed:       iface.Speed,
 					IGPConfig:   make([]IGPIfConfig, 0, 5),
 				}
-				switch igp {
-				case "OSPF":
-					ifIGP := OSPFIfConfig{
-						V6:        !is4,
-						Cost:      iface.Cost,
-						ProcessID: 0,
-						Area:      0,
-					}
 
-					// find the PE interface and configure it
-					if parentIf := as.GetMatchingLink(nil, iface); parentIf != nil {
-						pIfCfg := IfConfig{
-							IPs:         []net.IPNet{parentIf.IP},
-							Description: parentIf.Description,
-							Speed:       parentIf.Speed,
-							IGPConfig:   make([]IGPIfConfig, 0, 5),
-							External:    true,
-							VRF:         parentIf.VRF,
-						}
+				// find the PE interface and configure it
+				parentIf := as.GetMatchingLink(nil, iface)
+				if parentIf == nil {
+					c.Interfaces[iface.IfName] = ifCfg
+					continue
+				}
+				pIfCfg := IfConfig{
+					IPs:         []net.IPNet{parentIf.IP},
+					Description: parentIf.Description,
+					Speed:       parentIf.Speed,
+					IGPConfig:   make([]IGPIfConfig, 0, 5),
+					External:    true,
+					VRF:         parentIf.VRF,
+				}
 
-						ifCfg.IGPConfig = append(ifCfg.IGPConfig, ifIGP)
-						pIfCfg.IGPConfig = append(pIfCfg.IGPConfig, OSPFIfConfig{
-							V6:        !is4,
-							Cost:      parentIf.Cost,
-							ProcessID: 0,
-							Area:      0,
-						})
+				switch {
+				case parentIf.IsDownstreamVRF():
+					// downstream links of the hub only use static routes
+					break
+				case r.Routing == project.PECEStatic:
+					// CE: default route towards the PE
+					if is4 {
+						c.StaticRoutes.addNet(defaultRoute4, parentIf.IP.IP.String())
+					} else {
+						c.StaticRoutes.addNet(defaultRoute6, parentIf.IP.IP.String())
+					}
 
-						// if we are in the hub side, add the static routes to the spokes
-						// we need to use the IP of the parent interface
-						if r.Hub && parentIf.IsDownstreamVRF() {
-							key := parentIf.IP.IP.String()
-							for _, subnet := range vpn.SpokeSubnets {
-								c.StaticRoutes.V4[key] =
-									append(c.StaticRoutes.V4[key], subnet.String())
-							}
+					// PE: routes towards the customer prefixes (and towards
+					// the spokes through the hub on the hub PE)
+					for _, subnet := range r.Subnets {
+						parentCfg.StaticRoutes.addVRF(parentIf.VRF, subnet, iface.IP.IP.String())
+					}
+					if r.Hub {
+						for _, subnet := range vpn.SpokeSubnets {
+							parentCfg.StaticRoutes.addVRF(parentIf.VRF, subnet, iface.IP.IP.String())
 						}
+					}
+				case r.Routing == project.PECEBGP:
+					vrfCfg := parentCfg.BGP.VRF[parentIf.VRF]
+					if vrfCfg.Neighbors == nil {
+						vrfCfg.Neighbors = make(map[string]BGPNbr, len(vpn.Customers))
+					}
+					vrfCfg.Neighbors[iface.IP.IP.String()] = BGPNbr{
+						RemoteAS:   r.ASN,
+						ConnCheck:  true,
+						AF:         project.AddressFamily{IPv4: is4, IPv6: !is4},
+						ASOverride: r.ASOverride,
+						AllowASIn:  r.AllowASIn,
+					}
+					parentCfg.BGP.VRF[parentIf.VRF] = vrfCfg
 
-						parentCfg.Interfaces[parentIf.IfName] = pIfCfg
+					c.BGP.Neighbors[parentIf.IP.IP.String()] = BGPNbr{
+						RemoteAS:  as.ASN,
+						ConnCheck: true,
+						AF:        project.AddressFamily{IPv4: is4, IPv6: !is4},
+						AllowASIn: r.AllowASIn,
 					}
-				case "ISIS", "IS-IS":
+				case r.Routing == project.PECEOSPF:
+					ifCfg.IGPConfig = append(ifCfg.IGPConfig, OSPFIfConfig{
+						V4:        is4,
+						V6:        !is4,
+						Cost:      iface.Cost,
+						ProcessID: 0,
+						Area:      0,
+					})
+					pIfCfg.IGPConfig = append(pIfCfg.IGPConfig, OSPFIfConfig{
+						V4:        is4,
+						V6:        !is4,
+						Cost:      parentIf.Cost,
+						ProcessID: 0,
+						Area:      0,
+					})
+				case r.Routing == project.PECEISIS:
 					ifCfg.IGPConfig =
 						append(ifCfg.IGPConfig, ISISIfConfig{
+							V4:          is4,
 							V6:          !is4,
 							ProcessName: isisDefaultProcess,
 							Cost:        iface.Cost,
 							CircuitType: 2,
 						})
-					break
 				}
+
+				// if we are in the hub side, add the static routes to the spokes
+				// we need to use the IP of the parent interface
+				if r.Hub && parentIf.IsDownstreamVRF() {
+					for _, subnet := range vpn.SpokeSubnets {
+						c.StaticRoutes.addNet(subnet, parentIf.IP.IP.String())
+					}
+				}
+
+				parentCfg.Interfaces[parentIf.IfName] = pIfCfg
 				c.Interfaces[iface.IfName] = ifCfg
 			}
 
 			// Also add IGP config for loopback interface
 			if nbLo > 0 {
 				ifCfg := c.Interfaces["lo"]
-				switch igp {
-				case "OSPF":
+				switch r.Routing {
+				case project.PECEOSPF:
 					ifCfg.IGPConfig =
 						append(ifCfg.IGPConfig, OSPFIfConfig{
+							V4:        is4,
 							V6:        !is4,
 							ProcessID: 0,
 							Area:      0,
 						})
-				case "ISIS", "IS-IS":
+				case project.PECEISIS:
 					ifCfg.IGPConfig =
 						append(ifCfg.IGPConfig, ISISIfConfig{
+							V4:          is4,
 							V6:          !is4,
 							ProcessName: isisDefaultProcess,
 							Passive:     true,
@@ -208,8 +262,28 @@ func generateVPNConfig(as *project.AutonomousSystem, ASconfigs []*FRRConfig) []*
 
 			res = append(res, c)
 		}
-		nextRouteDescriptor++
-		nextRouteTarget++
 	}
 	return res
 }
+
+// setupCustomerBGP configures the BGP instance of a CE speaking eBGP with its
+// PE. The CE announces its loopbacks and remote subnets (and the spokes
+// subnets if it is the hub of the VPN).
+func (c *FRRConfig) setupCustomerBGP(r project.VPNCustomer, spokes []net.IPNet) {
+	c.BGP = BGPConfig{
+		ASN:       r.ASN,
+		Neighbors: make(map[string]BGPNbr, 1),
+	}
+	c.BGP.setupRouterID(r.Router)
+	subnets := r.Subnets
+	if r.Hub {
+		subnets = append(subnets, spokes...)
+	}
+	for _, subnet := range subnets {
+		if subnet.IP.To4() != nil {
+			c.BGP.Networks.V4 = append(c.BGP.Networks.V4, subnet.String())
+		} else {
+			c.BGP.Networks.V6 = append(c.BGP.Networks.V6, subnet.String())
+		}
+	}
+}
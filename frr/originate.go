@@ -0,0 +1,69 @@
+package frr
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+// originateTag is the tag of the static routes of the originated prefixes,
+// used to select them when they are redistributed
+const originateTag = 65100
+
+// TagMatch matches the routes having a tag
+type TagMatch struct {
+	Tag int
+}
+
+func (m *TagMatch) WriteMatch(dst io.Writer) {
+	fmt.Fprintln(dst, " match tag", m.Tag)
+}
+
+// setupOriginate announces the additional prefixes originated by r, using
+// network statements or the redistribution of blackhole routes
+func (c *FRRConfig) setupOriginate(as *project.AutonomousSystem, r *project.Router) {
+	if len(r.Originated) == 0 {
+		return
+	}
+	attrs := as.BGP.Originate
+	rm := RouteMap{
+		Name:  "ORIGINATE",
+		Order: 10,
+	}
+	if len(attrs.Communities) > 0 {
+		rm.Set = append(rm.Set, "community "+strings.Join(attrs.Communities, " ")+" additive")
+	}
+	if attrs.HasMED {
+		rm.Set = append(rm.Set, "metric "+strconv.Itoa(attrs.MED))
+	}
+
+	if attrs.Redistribute {
+		for _, prefix := range r.Originated {
+			c.StaticRoutes.addNet(prefix, fmt.Sprintf("Null0 tag %d", originateTag))
+		}
+		rm.Match = &TagMatch{Tag: originateTag}
+		c.RouteMaps = append(c.RouteMaps, rm)
+		c.BGP.Redistribute.Static = true
+		c.BGP.Redistribute.StaticRouteMap = rm.Name
+		return
+	}
+
+	if len(rm.Set) > 0 {
+		c.RouteMaps = append(c.RouteMaps, rm)
+		c.BGP.Networks.RouteMaps = make(map[string]string, len(r.Originated))
+	}
+	for _, prefix := range r.Originated {
+		if len(rm.Set) > 0 {
+			c.BGP.Networks.RouteMaps[prefix.String()] = rm.Name
+		}
+		if prefix.IP.To4() != nil {
+			c.BGP.Networks.V4 = append(c.BGP.Networks.V4, prefix.String())
+		} else {
+			c.BGP.Networks.V6 = append(c.BGP.Networks.V6, prefix.String())
+		}
+		c.StaticRoutes.addNet(prefix, "Null0")
+	}
+}
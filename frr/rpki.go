@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/rahveiz/topomate/config"
 	"github.com/rahveiz/topomate/project"
 )
 
@@ -21,3 +22,127 @@ func writeRPKI(dst io.Writer, servers map[string]project.RPKIServer, selected []
 	}
 	sep(dst)
 }
+
+// Communities values used to tag the RPKI validation state of routes
+const (
+	rpkiValidCommunity    = 65100
+	rpkiNotFoundCommunity = 65101
+	rpkiInvalidCommunity  = 65102
+)
+
+// Local preference adjustment of valid and invalid routes for the
+// prefer-valid policy, small enough to keep the relations order
+const rpkiLocalPrefDelta = 10
+
+type RPKIMatch struct {
+	State string
+}
+
+func (m *RPKIMatch) WriteMatch(dst io.Writer) {
+	fmt.Fprintln(dst, " match rpki", m.State)
+}
+
+// setupRPKIPolicy replaces the inbound route-maps of the eBGP neighbors by
+// maps calling them and applying the RPKI policy of the AS
+func (c *FRRConfig) setupRPKIPolicy(as *project.AutonomousSystem) {
+	if as.RPKI.Policy == project.RPKIOff {
+		return
+	}
+	created := make(map[string]bool, 4)
+	for ip, nbr := range c.BGP.Neighbors {
+		if nbr.RemoteAS == c.BGP.ASN || nbr.ConfedAS > 0 {
+			continue
+		}
+		maps := nbr.RouteMapsIn
+		if len(maps) == 0 {
+			maps = []string{""}
+		}
+		nbr.RouteMapsIn = make([]string, len(maps))
+		for i, base := range maps {
+			nbr.RouteMapsIn[i] = c.rpkiRouteMap(base, as, created)
+		}
+		c.BGP.Neighbors[ip] = nbr
+	}
+}
+
+// rpkiRouteMap creates the route-map applying the RPKI policy after the
+// base route-map, and returns its name
+func (c *FRRConfig) rpkiRouteMap(base string, as *project.AutonomousSystem, created map[string]bool) string {
+	name := "RPKI"
+	if base != "" {
+		name += "_" + base
+	}
+	if created[name] {
+		return name
+	}
+	created[name] = true
+
+	if as.RPKI.Policy == project.RPKIDropInvalid {
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 10,
+			Match: &RPKIMatch{State: "invalid"},
+			Deny:  true,
+		})
+	}
+	if base != "" {
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:        name,
+			Order:       20,
+			Call:        base,
+			OnMatchNext: true,
+		})
+	}
+
+	lp := relationLocalPref(base)
+	states := []struct {
+		name      string
+		community int
+		localPref int
+	}{
+		{"valid", rpkiValidCommunity, lp + rpkiLocalPrefDelta},
+		{"notfound", rpkiNotFoundCommunity, 0},
+		{"invalid", rpkiInvalidCommunity, lp - rpkiLocalPrefDelta},
+	}
+	for i, st := range states {
+		// already denied
+		if st.name == "invalid" && as.RPKI.Policy == project.RPKIDropInvalid {
+			continue
+		}
+		set := make([]string, 0, 2)
+		if as.RPKI.Policy == project.RPKIPreferValid && st.localPref > 0 {
+			set = append(set, fmt.Sprintf("local-preference %d", st.localPref))
+		}
+		if as.RPKI.Tag {
+			set = append(set, fmt.Sprintf("community additive %d:%d", c.BGP.ASN, st.community))
+		}
+		if len(set) == 0 {
+			continue
+		}
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:  name,
+			Order: 30 + i,
+			Match: &RPKIMatch{State: st.name},
+			Set:   set,
+		})
+	}
+	c.RouteMaps = append(c.RouteMaps, RouteMap{
+		Name:  name,
+		Order: 100,
+	})
+	return name
+}
+
+// relationLocalPref returns the local preference set by a relation route-map
+func relationLocalPref(routeMap string) int {
+	switch routeMap {
+	case "PROVIDER_IN":
+		return config.DefaultBGPSettings.Provider.LocalPref
+	case "PEER_IN":
+		return config.DefaultBGPSettings.Peer.LocalPref
+	case "CUSTOMER_IN":
+		return config.DefaultBGPSettings.Customer.LocalPref
+	}
+	// FRR default
+	return 100
+}
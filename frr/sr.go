@@ -0,0 +1,201 @@
+package frr
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rahveiz/topomate/project"
+)
+
+// SRIGPConfig contains the segment routing settings of an IGP instance
+type SRIGPConfig struct {
+	LowerBound int
+	UpperBound int
+	Prefix     string
+	Index      int
+}
+
+type SRSegmentList struct {
+	Name   string
+	Labels []int
+}
+
+type SRCandidatePath struct {
+	Name        string
+	Preference  int
+	SegmentList string
+}
+
+type SRTEPolicy struct {
+	Name       string
+	Color      int
+	Endpoint   string
+	BindingSID int
+	Candidates []SRCandidatePath
+}
+
+type SRTEConfig struct {
+	SegmentLists []SRSegmentList
+	Policies     []SRTEPolicy
+}
+
+func getSRIGPConfig(sr *project.SegmentRouting, r *project.Router) *SRIGPConfig {
+	if !sr.Enabled {
+		return nil
+	}
+	return &SRIGPConfig{
+		LowerBound: sr.SRGB[0],
+		UpperBound: sr.SRGB[1],
+		Prefix:     r.Loopback[0].String(),
+		Index:      sr.NodeIndex(r),
+	}
+}
+
+func (c *SRIGPConfig) Write(dst io.Writer) {
+	if c == nil {
+		return
+	}
+	fmt.Fprintln(dst, " segment-routing on")
+	fmt.Fprintln(dst, " segment-routing global-block", c.LowerBound, c.UpperBound)
+	fmt.Fprintln(dst, " segment-routing prefix", c.Prefix, "index", c.Index)
+}
+
+// setupSRTE translates the SR-TE policies of a headend into pathd
+// configuration, and colors the BGP routes whose next-hop is a policy endpoint
+func (c *FRRConfig) setupSRTE(sr *project.SegmentRouting, r *project.Router) {
+	policies := sr.PoliciesFor(r)
+	if len(policies) == 0 {
+		return
+	}
+
+	c.SRTE = &SRTEConfig{
+		SegmentLists: make([]SRSegmentList, 0, len(policies)),
+		Policies:     make([]SRTEPolicy, 0, len(policies)),
+	}
+
+	color := make([]RouteMap, 0, len(policies))
+	order := 10
+	for _, p := range policies {
+		policy := SRTEPolicy{
+			Name:       p.Name,
+			Color:      p.Color,
+			Endpoint:   p.Endpoint.LoID(),
+			BindingSID: p.BindingSID,
+			Candidates: make([]SRCandidatePath, len(p.SegmentLists)),
+		}
+		for i, sl := range p.SegmentLists {
+			segments := SRSegmentList{
+				Name:   sl.Name,
+				Labels: make([]int, len(sl.Hops)),
+			}
+			for j, hop := range sl.Hops {
+				segments.Labels[j] = sr.NodeLabel(hop)
+			}
+			c.SRTE.SegmentLists = append(c.SRTE.SegmentLists, segments)
+			policy.Candidates[i] = SRCandidatePath{
+				Name:        sl.Name,
+				Preference:  sl.Preference,
+				SegmentList: sl.Name,
+			}
+		}
+		c.SRTE.Policies = append(c.SRTE.Policies, policy)
+
+		if !p.ColorRoutes {
+			continue
+		}
+		plName := fmt.Sprintf("SRTE_NH_%d", p.Color)
+		c.PrefixLists = append(c.PrefixLists, PrefixList{
+			Name:   plName,
+			Prefix: p.Endpoint.Loopback[0].String(),
+		})
+		color = append(color, RouteMap{
+			Order: order,
+			Match: &NextHopMatch{PrefixList: plName},
+			Set:   []string{fmt.Sprintf("sr-te color %d", p.Color)},
+		})
+		order += 10
+	}
+
+	if len(color) == 0 {
+		return
+	}
+
+	// Apply the coloring on iBGP sessions, after their inbound route-maps
+	created := make(map[string]bool, 2)
+	for ip, nbr := range c.BGP.Neighbors {
+		if nbr.RemoteAS != c.BGP.ASN {
+			continue
+		}
+		maps := nbr.RouteMapsIn
+		if len(maps) == 0 {
+			maps = []string{""}
+		}
+		nbr.RouteMapsIn = make([]string, len(maps))
+		for i, base := range maps {
+			nbr.RouteMapsIn[i] = c.srteRouteMap(base, color, created)
+		}
+		c.BGP.Neighbors[ip] = nbr
+	}
+}
+
+// srteRouteMap creates the route-map coloring the routes, calling the base
+// route-map of the neighbor first if any, and returns its name
+func (c *FRRConfig) srteRouteMap(base string, color []RouteMap, created map[string]bool) string {
+	name := "SRTE_COLOR"
+	if base != "" {
+		name += "_" + base
+	}
+	if created[name] {
+		return name
+	}
+	created[name] = true
+
+	if base != "" {
+		c.RouteMaps = append(c.RouteMaps, RouteMap{
+			Name:        name,
+			Order:       5,
+			Call:        base,
+			OnMatchNext: true,
+		})
+	}
+	for _, rm := range color {
+		rm.Name = name
+		c.RouteMaps = append(c.RouteMaps, rm)
+	}
+	// Let the other routes through
+	c.RouteMaps = append(c.RouteMaps, RouteMap{
+		Name:  name,
+		Order: 1000,
+	})
+	return name
+}
+
+func (c *SRTEConfig) Write(dst io.Writer) {
+	sep(dst)
+
+	fmt.Fprintln(dst, "segment-routing")
+	fmt.Fprintln(dst, " traffic-eng")
+	for _, sl := range c.SegmentLists {
+		fmt.Fprintln(dst, "  segment-list", sl.Name)
+		for i, label := range sl.Labels {
+			fmt.Fprintf(dst, "   index %d mpls label %d\n", 10*(i+1), label)
+		}
+		fmt.Fprintln(dst, "  exit")
+	}
+	for _, p := range c.Policies {
+		fmt.Fprintln(dst, "  policy color", p.Color, "endpoint", p.Endpoint)
+		fmt.Fprintln(dst, "   name", p.Name)
+		if p.BindingSID > 0 {
+			fmt.Fprintln(dst, "   binding-sid", p.BindingSID)
+		}
+		for _, cp := range p.Candidates {
+			fmt.Fprintf(dst, "   candidate-path preference %d name %s explicit segment-list %s\n",
+				cp.Preference, cp.Name, cp.SegmentList)
+		}
+		fmt.Fprintln(dst, "  exit")
+	}
+	fmt.Fprintln(dst, " exit")
+	fmt.Fprintln(dst, "exit")
+
+	sep(dst)
+}
@@ -3,18 +3,21 @@ package frr
 import (
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 )
 
 type staticRoutes struct {
-	V4 map[string][]string
-	V6 map[string][]string
+	V4  map[string][]string
+	V6  map[string][]string
+	VRF map[string]staticRoutes
 }
 
 func initStatic(size int) staticRoutes {
 	return staticRoutes{
-		V4: make(map[string][]string, size),
-		V6: make(map[string][]string, size),
+		V4:  make(map[string][]string, size),
+		V6:  make(map[string][]string, size),
+		VRF: make(map[string]staticRoutes),
 	}
 }
 
@@ -26,17 +29,49 @@ func (s *staticRoutes) add6(dest string, prefixLen int, gateway string) {
 	s.V6[gateway] = append(s.V6[gateway], dest+"/"+strconv.Itoa(prefixLen))
 }
 
-func (c *staticRoutes) Write(dst io.Writer) {
-	sep(dst)
+// addNet adds a route to dest, using the IPv4 or IPv6 table depending on
+// the destination address family
+func (s *staticRoutes) addNet(dest net.IPNet, gateway string) {
+	if dest.IP.To4() != nil {
+		s.V4[gateway] = append(s.V4[gateway], dest.String())
+	} else {
+		s.V6[gateway] = append(s.V6[gateway], dest.String())
+	}
+}
+
+// addVRF adds a route to dest in the routing table of vrf
+func (s *staticRoutes) addVRF(vrf string, dest net.IPNet, gateway string) {
+	routes, ok := s.VRF[vrf]
+	if !ok {
+		routes = staticRoutes{
+			V4: make(map[string][]string),
+			V6: make(map[string][]string),
+		}
+	}
+	routes.addNet(dest, gateway)
+	s.VRF[vrf] = routes
+}
+
+func (c *staticRoutes) writeRoutes(dst io.Writer, depth int) {
 	for ifName, ips := range c.V4 {
 		for _, ip := range ips {
-			fmt.Fprintln(dst, "ip route", ip, ifName)
+			writeWithIndent(dst, depth, "ip route "+ip+" "+ifName)
 		}
 	}
 	for ifName, ips := range c.V6 {
 		for _, ip := range ips {
-			fmt.Fprintln(dst, "ipv6 route", ip, ifName)
+			writeWithIndent(dst, depth, "ipv6 route "+ip+" "+ifName)
 		}
 	}
+}
+
+func (c *staticRoutes) Write(dst io.Writer) {
+	sep(dst)
+	c.writeRoutes(dst, 0)
+	for vrf, routes := range c.VRF {
+		fmt.Fprintln(dst, "vrf", vrf)
+		routes.writeRoutes(dst, 1)
+		fmt.Fprintln(dst, "exit-vrf")
+	}
 	sep(dst)
 }
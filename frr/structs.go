@@ -12,21 +12,28 @@ const (
 	fromProvider       = 20
 	fromPeer           = 30
 	isisDefaultProcess = "1"
-	frrVersion         = "7.4.0"
+	frrVersion         = "8.4.1"
 )
 
 type FRRConfig struct {
 	Hostname     string
+	Customer     bool
 	Interfaces   map[string]IfConfig
 	BGP          BGPConfig
 	IGP          []interface{}
 	MPLS         bool
+	SRTE         *SRTEConfig
+	BFD          *BFDConfig
+	L3VNIs       map[string]int
 	StaticRoutes staticRoutes
 	IXP          bool
 	RPKIBuffer   string
 	PrefixLists  []PrefixList
-	RouteMaps    []RouteMap
-	DefaultIPv6  bool
+	ASPathLists  []ASPathList
+	// CommunityLists entries, a list having one entry per community
+	CommunityLists []CommunityList
+	RouteMaps      []RouteMap
+	DefaultIPv6    bool
 }
 
 type IfConfig struct {
@@ -36,17 +43,23 @@ type IfConfig struct {
 	Speed       int
 	External    bool
 	VRF         string
+	MPLSBGP     bool
 }
 
 type VRFConfig struct {
-	RD           int
-	RT           RouteTarget
-	Redistribute RouteRedistribution
+	RD            string
+	RT            RouteTarget
+	IPv4          bool
+	IPv6          bool
+	Redistribute  RouteRedistribution
+	Redistribute6 RouteRedistribution
+	Neighbors     map[string]BGPNbr
+	VNI           int
 }
 
 type RouteTarget struct {
-	In  int
-	Out int
+	In  []string
+	Out []string
 }
 
 type OSPFConfig struct {
@@ -56,6 +69,7 @@ type OSPFConfig struct {
 	RouterID     string
 	Networks     []project.OSPFNet
 	Stubs        map[int]bool
+	SR           *SRIGPConfig
 }
 
 type OSPF6Config struct {
@@ -64,12 +78,14 @@ type OSPF6Config struct {
 }
 
 type RouteRedistribution struct {
-	Static       bool
-	OSPF         bool
-	Connected    bool
-	ConnectedOwn bool
-	ISIS         bool
-	BGP          bool
+	Static         bool
+	StaticRouteMap string
+	OSPF           bool
+	Connected      bool
+	ConnectedOwn   bool
+	ISIS           bool
+	BGP            bool
+	BGPRouteMap    string
 }
 
 type IGPIfConfig interface {
@@ -82,6 +98,10 @@ type OSPFIfConfig struct {
 	ProcessID int
 	Area      int
 	Cost      int
+	Broadcast bool
+	Priority  int
+	Passive   bool
+	BFD       string
 }
 
 type PrefixList struct {
@@ -90,12 +110,26 @@ type PrefixList struct {
 	Deny   bool
 }
 
+type ASPathList struct {
+	Name  string
+	Regex string
+}
+
 type RouteMapMatch interface {
 	WriteMatch(dst io.Writer)
 }
 
+type NextHopMatch struct {
+	PrefixList string
+}
+
 type RouteMap struct {
 	Name  string
+	Order int
 	Match RouteMapMatch
+	Set   []string
 	Deny  bool
+	// Call is the name of a route-map applied after this entry
+	Call        string
+	OnMatchNext bool
 }
@@ -60,17 +60,6 @@ route-map ALLOW_ALL permit 100
 	sep(dst)
 }
 
-func writeRPKIMaps(dst io.Writer) {
-	fmt.Fprintf(dst,
-		`!
-route-map RPKI permit 10
- match rpki valid
- !
-route-map RPKI deny 20
-!
-`)
-}
-
 func writeOwnPrefix(dst io.Writer, prefix string, order int, is6 bool) {
 	sep(dst)
 	if !is6 {
@@ -106,8 +95,23 @@ func (c *FRRConfig) writeUtilities(dst io.Writer) {
 		n++
 	}
 
+	if len(c.PrefixLists) > 0 || len(c.RouteMaps) > 0 {
+		writeComment(dst, "Generated prefix-lists and route-maps")
+		for _, pl := range c.PrefixLists {
+			pl.Write(dst)
+		}
+		for _, l := range c.ASPathLists {
+			l.Write(dst)
+		}
+		for _, l := range c.CommunityLists {
+			l.Write(dst)
+		}
+		sep(dst)
+		for _, rm := range c.RouteMaps {
+			rm.Write(dst)
+		}
+	}
+
 	writeComment(dst, "BGP relations maps")
 	writeRelationsMaps(dst, c.BGP.ASN)
-	writeComment(dst, "RPKI filter maps")
-	writeRPKIMaps(dst)
 }
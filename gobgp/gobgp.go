@@ -0,0 +1,367 @@
+// Package gobgp renders the configuration of the routers running GoBGP and
+// controls the daemon in their containers.
+package gobgp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/project"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Backend runs GoBGP in the router containers. GoBGP neither configures the
+// interfaces nor runs an IGP, and its routes are not installed in the
+// kernel: it is used to test the BGP control plane.
+type Backend struct{}
+
+func init() {
+	project.RegisterBackend(project.DaemonGoBGP, Backend{})
+}
+
+// Neighbor sets used by the global policies
+const (
+	setCustomers   = "CUSTOMERS"
+	setPeers       = "PEERS"
+	setProviders   = "PROVIDERS"
+	setUpstreams   = "UPSTREAMS"
+	setNextHopSelf = "NEXT_HOP_SELF"
+)
+
+// Render writes the TOML configuration of gobgpd. The relations are applied
+// by the global import and export policies, using neighbor sets. The header
+// lists the addresses of the interfaces, the routes to the eBGP neighbors
+// and the prefixes originated by the router, configured by the init script
+// of the image.
+func (Backend) Render(dst io.Writer, p *project.Project, as *project.AutonomousSystem, r *project.Router) {
+	fmt.Fprintf(dst, "# AS%d %s\n", as.ASN, r.Hostname)
+	for _, addr := range r.InterfaceAddresses() {
+		fmt.Fprintln(dst, "# address", addr)
+	}
+	for _, route := range p.PeerRoutes(as, r) {
+		if route.Gateway != nil {
+			fmt.Fprintln(dst, "# route", route.Prefix, "via", route.Gateway)
+		} else {
+			fmt.Fprintln(dst, "# route", route.Prefix, "dev", route.IfName)
+		}
+	}
+	for _, n := range as.Announced(r) {
+		fmt.Fprintln(dst, "# network", n.String())
+	}
+
+	fmt.Fprintln(dst, "\n[global.config]")
+	fmt.Fprintf(dst, "  as = %d\n", as.ASN)
+	fmt.Fprintf(dst, "  router-id = \"%s\"\n", r.RouterID(as.ASN))
+	fmt.Fprintln(dst, "\n[global.apply-policy.config]")
+	fmt.Fprintln(dst, "  import-policy-list = [\"IMPORT\"]")
+	fmt.Fprintln(dst, "  default-import-policy = \"accept-route\"")
+	fmt.Fprintln(dst, "  export-policy-list = [\"EXPORT\"]")
+	fmt.Fprintln(dst, "  default-export-policy = \"accept-route\"")
+
+	ips := make([]string, 0, len(r.Neighbors))
+	for ip := range r.Neighbors {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	sets := make(map[string][]string, 5)
+	for _, ip := range ips {
+		nbr := r.Neighbors[ip]
+		if nbr.NextHopSelf {
+			sets[setNextHopSelf] = append(sets[setNextHopSelf], ip)
+		}
+		if nbr.RemoteAS == as.ASN || len(nbr.RouteMapsIn) == 0 {
+			continue
+		}
+		switch nbr.RouteMapsIn[0] {
+		case "CUSTOMER_IN":
+			sets[setCustomers] = append(sets[setCustomers], ip)
+			break
+		case "PEER_IN":
+			sets[setPeers] = append(sets[setPeers], ip)
+			sets[setUpstreams] = append(sets[setUpstreams], ip)
+			break
+		case "PROVIDER_IN":
+			sets[setProviders] = append(sets[setProviders], ip)
+			sets[setUpstreams] = append(sets[setUpstreams], ip)
+			break
+		}
+	}
+	writePolicies(dst, as, sets)
+
+	for _, ip := range ips {
+		writeNeighbor(dst, as, r, ip, r.Neighbors[ip])
+	}
+}
+
+func quote(items []string) string {
+	res := make([]string, len(items))
+	for i, s := range items {
+		res[i] = `"` + s + `"`
+	}
+	return "[" + strings.Join(res, ", ") + "]"
+}
+
+// writePolicies writes the defined sets and the IMPORT and EXPORT policies,
+// with the semantics of the relations route-maps of FRR
+func writePolicies(dst io.Writer, as *project.AutonomousSystem, sets map[string][]string) {
+	bgp := config.DefaultBGPSettings
+	comm := func(c int) string {
+		return fmt.Sprintf("%d:%d", as.ASN, c)
+	}
+
+	names := make([]string, 0, len(sets))
+	for name := range sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(dst, "\n[[defined-sets.neighbor-sets]]")
+		fmt.Fprintf(dst, "  neighbor-set-name = \"%s\"\n", name)
+		fmt.Fprintf(dst, "  neighbor-info-list = %s\n", quote(sets[name]))
+	}
+	fmt.Fprintln(dst, "\n[[defined-sets.bgp-defined-sets.community-sets]]")
+	fmt.Fprintln(dst, "  community-set-name = \"UPSTREAM_ROUTES\"")
+	fmt.Fprintf(dst, "  community-list = %s\n",
+		quote([]string{comm(bgp.Provider.Community), comm(bgp.Peer.Community)}))
+
+	statement := func(name, set string) {
+		fmt.Fprintln(dst, "  [[policy-definitions.statements]]")
+		fmt.Fprintf(dst, "    name = \"%s\"\n", name)
+		fmt.Fprintln(dst, "    [policy-definitions.statements.conditions.match-neighbor-set]")
+		fmt.Fprintf(dst, "      neighbor-set = \"%s\"\n", set)
+		fmt.Fprintln(dst, "      match-set-options = \"any\"")
+	}
+
+	// routes learned from a neighbor are tagged with its relation
+	fmt.Fprintln(dst, "\n[[policy-definitions]]")
+	fmt.Fprintln(dst, "  name = \"IMPORT\"")
+	for _, rel := range []struct {
+		set string
+		cfg config.BGPRelationConfig
+	}{
+		{setProviders, bgp.Provider},
+		{setPeers, bgp.Peer},
+		{setCustomers, bgp.Customer},
+	} {
+		if len(sets[rel.set]) == 0 {
+			continue
+		}
+		statement("FROM_"+rel.set, rel.set)
+		fmt.Fprintln(dst, "    [policy-definitions.statements.actions]")
+		fmt.Fprintln(dst, "      route-disposition = \"accept-route\"")
+		fmt.Fprintln(dst, "    [policy-definitions.statements.actions.bgp-actions]")
+		fmt.Fprintf(dst, "      set-local-pref = %d\n", rel.cfg.LocalPref)
+		fmt.Fprintln(dst, "    [policy-definitions.statements.actions.bgp-actions.set-community]")
+		fmt.Fprintln(dst, "      options = \"add\"")
+		fmt.Fprintln(dst, "      [policy-definitions.statements.actions.bgp-actions.set-community.set-community-method]")
+		fmt.Fprintf(dst, "        communities-list = %s\n", quote([]string{comm(rel.cfg.Community)}))
+	}
+
+	// routes of providers and peers are only announced to customers
+	fmt.Fprintln(dst, "\n[[policy-definitions]]")
+	fmt.Fprintln(dst, "  name = \"EXPORT\"")
+	if len(sets[setNextHopSelf]) > 0 {
+		statement(setNextHopSelf, setNextHopSelf)
+		fmt.Fprintln(dst, "    [policy-definitions.statements.actions.bgp-actions]")
+		fmt.Fprintln(dst, "      set-next-hop = \"self\"")
+	}
+	if len(sets[setUpstreams]) > 0 {
+		statement("TO_"+setUpstreams, setUpstreams)
+		fmt.Fprintln(dst, "    [policy-definitions.statements.conditions.bgp-conditions.match-community-set]")
+		fmt.Fprintln(dst, "      community-set = \"UPSTREAM_ROUTES\"")
+		fmt.Fprintln(dst, "      match-set-options = \"any\"")
+		fmt.Fprintln(dst, "    [policy-definitions.statements.actions]")
+		fmt.Fprintln(dst, "      route-disposition = \"reject-route\"")
+	}
+}
+
+// writeNeighbor writes the configuration of a session
+func writeNeighbor(dst io.Writer, as *project.AutonomousSystem, r *project.Router, ip string, nbr *project.BGPNbr) {
+	peer := net.ParseIP(ip)
+	fmt.Fprintln(dst, "\n[[neighbors]]")
+	fmt.Fprintln(dst, "  [neighbors.config]")
+	fmt.Fprintf(dst, "    neighbor-address = \"%s\"\n", ip)
+	fmt.Fprintf(dst, "    peer-as = %d\n", nbr.RemoteAS)
+	if nbr.LocalAS > 0 {
+		fmt.Fprintf(dst, "    local-as = %d\n", nbr.LocalAS)
+	}
+	if nbr.Password != "" {
+		fmt.Fprintf(dst, "    auth-password = \"%s\"\n", nbr.Password)
+	}
+	if nbr.Hold > 0 {
+		fmt.Fprintln(dst, "  [neighbors.timers.config]")
+		fmt.Fprintf(dst, "    hold-time = %d\n", nbr.Hold)
+		fmt.Fprintf(dst, "    keepalive-interval = %d\n", nbr.Keepalive)
+	}
+	if nbr.UpdateSource == "lo" {
+		for _, lo := range r.Loopback {
+			if (lo.IP.To4() != nil) == (peer.To4() != nil) {
+				fmt.Fprintln(dst, "  [neighbors.transport.config]")
+				fmt.Fprintf(dst, "    local-address = \"%s\"\n", lo.IP)
+				break
+			}
+		}
+	}
+	if nbr.RemoteAS != as.ASN && nbr.EBGPMultihop > 0 {
+		fmt.Fprintln(dst, "  [neighbors.ebgp-multihop.config]")
+		fmt.Fprintln(dst, "    enabled = true")
+		fmt.Fprintf(dst, "    multihop-ttl = %d\n", nbr.EBGPMultihop)
+	}
+	if nbr.RRClient {
+		fmt.Fprintln(dst, "  [neighbors.route-reflector.config]")
+		fmt.Fprintln(dst, "    route-reflector-client = true")
+		if r.ClusterID != "" {
+			fmt.Fprintf(dst, "    route-reflector-cluster-id = \"%s\"\n", r.ClusterID)
+		}
+	}
+	if nbr.RSClient {
+		fmt.Fprintln(dst, "  [neighbors.route-server.config]")
+		fmt.Fprintln(dst, "    route-server-client = true")
+	}
+	if nbr.AllowASIn > 0 {
+		fmt.Fprintln(dst, "  [neighbors.as-path-options.config]")
+		fmt.Fprintf(dst, "    allow-own-as = %d\n", nbr.AllowASIn)
+	}
+	for _, af := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"ipv4-unicast", nbr.AF.IPv4},
+		{"ipv6-unicast", nbr.AF.IPv6},
+	} {
+		if !af.enabled {
+			continue
+		}
+		fmt.Fprintln(dst, "  [[neighbors.afi-safis]]")
+		fmt.Fprintln(dst, "    [neighbors.afi-safis.config]")
+		fmt.Fprintf(dst, "      afi-safi-name = \"%s\"\n", af.name)
+		if nbr.MaxPrefix > 0 {
+			fmt.Fprintln(dst, "    [neighbors.afi-safis.prefix-limit.config]")
+			fmt.Fprintf(dst, "      max-prefixes = %d\n", nbr.MaxPrefix)
+		}
+	}
+}
+
+// Start runs the init script of the image, which configures the addresses
+// and starts gobgpd before adding the originated prefixes
+func (Backend) Start(r *project.Router) error {
+	utils.StartFrr(r.ContainerName)
+	return nil
+}
+
+// Reload runs the reload action of the init script of the image
+func (Backend) Reload(r *project.Router) error {
+	return utils.ReloadFrr(r.ContainerName)
+}
+
+// gobgpJSON runs a command of the GoBGP client in the router container and
+// decodes its JSON output in v
+func gobgpJSON(r *project.Router, v interface{}, args ...string) error {
+	out, err := exec.Command("docker", append([]string{"exec", r.ContainerName, "gobgp", "-j"}, args...)...).Output()
+	if err != nil {
+		return fmt.Errorf("%s: %v", r.ContainerName, err)
+	}
+	return json.Unmarshal(out, v)
+}
+
+type neighbor struct {
+	Conf struct {
+		NeighborAddress string `json:"neighbor_address"`
+		PeerAS          int    `json:"peer_as"`
+		LocalAS         int    `json:"local_as"`
+	} `json:"conf"`
+	State struct {
+		SessionState int `json:"session_state"`
+	} `json:"state"`
+}
+
+// session states of the GoBGP API
+var sessionStates = []string{"Unknown", "Idle", "Connect", "Active", "OpenSent", "OpenConfirm", "Established"}
+
+func (Backend) RIB(r *project.Router) ([]project.BGPRoute, error) {
+	var nbrs []neighbor
+	if err := gobgpJSON(r, &nbrs, "neighbor"); err != nil {
+		return nil, err
+	}
+	external := make(map[string]bool, len(nbrs))
+	for _, n := range nbrs {
+		external[n.Conf.NeighborAddress] = n.Conf.PeerAS != n.Conf.LocalAS
+	}
+
+	res := make([]project.BGPRoute, 0, 64)
+	for _, af := range []string{"ipv4", "ipv6"} {
+		var rib map[string][]struct {
+			Best       bool   `json:"best"`
+			NeighborIP string `json:"neighbor-ip"`
+			Attrs      []struct {
+				Type    int `json:"type"`
+				ASPaths []struct {
+					Type int   `json:"segment_type"`
+					ASNs []int `json:"asns"`
+				} `json:"as_paths"`
+			} `json:"attrs"`
+		}
+		if err := gobgpJSON(r, &rib, "global", "rib", "-a", af); err != nil {
+			return nil, err
+		}
+		for prefix, paths := range rib {
+			for _, path := range paths {
+				route := project.BGPRoute{
+					Prefix:   prefix,
+					Best:     path.Best,
+					Valid:    true,
+					External: external[path.NeighborIP],
+				}
+				segs := make([]string, 0, 2)
+				for _, attr := range path.Attrs {
+					if attr.Type != 2 { // AS_PATH
+						continue
+					}
+					for _, seg := range attr.ASPaths {
+						asns := make([]string, len(seg.ASNs))
+						for i, asn := range seg.ASNs {
+							asns[i] = fmt.Sprint(asn)
+						}
+						switch seg.Type {
+						case 1: // AS_SET
+							segs = append(segs, "{"+strings.Join(asns, ",")+"}")
+						case 3, 4: // confederation segments
+							segs = append(segs, "("+strings.Join(asns, " ")+")")
+						default:
+							segs = append(segs, strings.Join(asns, " "))
+						}
+					}
+				}
+				route.Path = strings.Join(segs, " ")
+				res = append(res, route)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (Backend) Sessions(r *project.Router) (map[string]project.BGPPeerState, error) {
+	var nbrs []neighbor
+	if err := gobgpJSON(r, &nbrs, "neighbor"); err != nil {
+		return nil, err
+	}
+	res := make(map[string]project.BGPPeerState, len(nbrs))
+	for _, n := range nbrs {
+		state := sessionStates[0]
+		if n.State.SessionState > 0 && n.State.SessionState < len(sessionStates) {
+			state = sessionStates[n.State.SessionState]
+		}
+		res[n.Conf.NeighborAddress] = project.BGPPeerState{
+			RemoteAS: n.Conf.PeerAS,
+			State:    state,
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,35 @@
+#!/bin/sh
+
+# topomate copies the configuration to /etc/frr/frr.conf. Its header lists
+# the addresses of the interfaces as "# address <interface> <prefix>" since
+# BIRD does not configure them.
+conf=/etc/frr/frr.conf
+
+addresses() {
+    grep '^# address ' $conf | while read -r _ _ dev prefix; do
+        ip addr add "$prefix" dev "$dev" 2>/dev/null
+        ip link set "$dev" up
+    done
+}
+
+case "$1" in
+start)
+    addresses
+    bird -c $conf
+    ;;
+stop)
+    birdc down
+    ;;
+restart)
+    birdc down
+    addresses
+    bird -c $conf
+    ;;
+reload)
+    birdc configure
+    ;;
+*)
+    echo "Usage: $0 {start|stop|restart|reload}"
+    exit 1
+    ;;
+esac
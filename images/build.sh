@@ -4,4 +4,7 @@ current_dir=$(dirname "${0}")
 
 docker build ${current_dir}/router -t topomate/router
 docker build ${current_dir}/route-server-frr -t topomate/route-server
-docker build ${current_dir}/rtr -t topomate/rtr
\ No newline at end of file
+docker build ${current_dir}/bird -t topomate/bird
+docker build ${current_dir}/gobgp -t topomate/gobgp
+docker build ${current_dir}/rtr -t topomate/rtr
+docker build -f ${current_dir}/injector/Dockerfile ${current_dir}/.. -t topomate/injector
\ No newline at end of file
@@ -0,0 +1,63 @@
+#!/bin/sh
+
+# topomate copies the configuration to /etc/frr/frr.conf. Its header lists
+# the addresses of the interfaces as "# address <interface> <prefix>", the
+# routes to the eBGP neighbors as "# route <prefix> dev|via <next hop>" and
+# the prefixes originated by the router as "# network <prefix>", since
+# GoBGP does not configure them.
+conf=/etc/frr/frr.conf
+
+addresses() {
+    grep '^# address ' $conf | while read -r _ _ dev prefix; do
+        ip addr add "$prefix" dev "$dev" 2>/dev/null
+        ip link set "$dev" up
+    done
+}
+
+routes() {
+    grep '^# route ' $conf | while read -r _ _ route; do
+        ip route add $route 2>/dev/null
+    done
+}
+
+networks() {
+    # wait for the API of the daemon
+    for i in $(seq 1 20); do
+        gobgp global >/dev/null 2>&1 && break
+        sleep 0.5
+    done
+    grep '^# network ' $conf | while read -r _ _ prefix; do
+        case "$prefix" in
+        *:*) gobgp global rib add -a ipv6 "$prefix" ;;
+        *) gobgp global rib add -a ipv4 "$prefix" ;;
+        esac
+    done
+}
+
+start() {
+    addresses
+    routes
+    setsid gobgpd -f $conf -t toml >>/var/log/gobgpd.log 2>&1 &
+    networks
+}
+
+case "$1" in
+start)
+    start
+    ;;
+stop)
+    pkill gobgpd
+    ;;
+restart)
+    pkill gobgpd
+    sleep 1
+    start
+    ;;
+reload)
+    pkill -HUP gobgpd
+    ;;
+*)
+    echo "Usage: $0 {start|stop|restart|reload}"
+    exit 1
+    ;;
+esac
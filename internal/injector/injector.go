@@ -0,0 +1,192 @@
+// Package injector replays the routes of an MRT file over an eBGP session,
+// rewriting their prefixes and AS paths.
+package injector
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rahveiz/topomate/internal/mrt"
+)
+
+// Config contains the settings of an injector
+type Config struct {
+	File     string
+	LocalAS  uint32
+	RouterID net.IP
+	Peer     net.IP
+	PeerAS   uint32
+	// Rate is the maximum number of updates sent per second, 0 for no limit
+	Rate int
+	// Limit is the maximum number of routes sent, 0 for no limit
+	Limit int
+	// PeerIndex selects the RIB entries of a peer of the dump, -1 for the
+	// first entry of each prefix
+	PeerIndex int
+	ASMap     map[uint32]uint32
+	PrefixMap []PrefixRewrite
+}
+
+// PrefixRewrite moves the prefixes included in From to To, both having the
+// same length
+type PrefixRewrite struct {
+	From net.IPNet
+	To   net.IPNet
+}
+
+// ParseASMap parses a list of old=new AS numbers separated by commas
+func ParseASMap(s string) (map[uint32]uint32, error) {
+	res := make(map[uint32]uint32)
+	for _, item := range strings.Split(s, ",") {
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid AS rewrite %s", item)
+		}
+		from, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AS rewrite %s", item)
+		}
+		to, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AS rewrite %s", item)
+		}
+		res[uint32(from)] = uint32(to)
+	}
+	return res, nil
+}
+
+// ParsePrefixMap parses a list of old=new prefixes separated by commas
+func ParsePrefixMap(s string) ([]PrefixRewrite, error) {
+	res := make([]PrefixRewrite, 0, 2)
+	for _, item := range strings.Split(s, ",") {
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid prefix rewrite %s", item)
+		}
+		_, from, err := net.ParseCIDR(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		_, to, err := net.ParseCIDR(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		fromOnes, fromBits := from.Mask.Size()
+		toOnes, toBits := to.Mask.Size()
+		if fromOnes != toOnes || fromBits != toBits {
+			return nil, fmt.Errorf("prefixes of %s do not have the same length", item)
+		}
+		res = append(res, PrefixRewrite{From: *from, To: *to})
+	}
+	return res, nil
+}
+
+// rewrite applies the prefix and AS rewrites to a route
+func (cfg *Config) rewrite(r *mrt.Route) {
+	for _, pr := range cfg.PrefixMap {
+		ones, _ := r.Prefix.Mask.Size()
+		fromOnes, bits := pr.From.Mask.Size()
+		if ones < fromOnes || len(r.Prefix.IP) != bits/8 || !pr.From.Contains(r.Prefix.IP) {
+			continue
+		}
+		ip := make(net.IP, len(r.Prefix.IP))
+		for i := range ip {
+			ip[i] = pr.To.IP[i] | (r.Prefix.IP[i] &^ pr.From.Mask[i])
+		}
+		r.Prefix.IP = ip
+		break
+	}
+
+	if r.Withdraw || len(cfg.ASMap) == 0 {
+		return
+	}
+	attrs := *r.Attrs
+	attrs.ASPath = make([]mrt.Segment, len(r.Attrs.ASPath))
+	for i, seg := range r.Attrs.ASPath {
+		asns := make([]uint32, len(seg.ASNs))
+		for j, asn := range seg.ASNs {
+			if n, ok := cfg.ASMap[asn]; ok {
+				asn = n
+			}
+			asns[j] = asn
+		}
+		attrs.ASPath[i] = mrt.Segment{Set: seg.Set, ASNs: asns}
+	}
+	r.Attrs = &attrs
+}
+
+// Run establishes the session with the peer, replays the routes of the file
+// and keeps the session up. It only returns on errors.
+func Run(cfg Config) error {
+	s, err := dial(&cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Session established with", cfg.Peer)
+	done := make(chan error, 1)
+	go func() { done <- s.run() }()
+
+	reader, err := mrt.Open(cfg.File)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	reader.PeerIndex = cfg.PeerIndex
+
+	var tick <-chan time.Time
+	if cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	v4 := s.localIP.To4() != nil
+	sent, skipped := 0, 0
+	for cfg.Limit == 0 || sent < cfg.Limit {
+		r, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// only the routes of the address family of the session are sent
+		if (r.Prefix.IP.To4() != nil) != v4 {
+			skipped++
+			continue
+		}
+		cfg.rewrite(&r)
+		if tick != nil {
+			select {
+			case <-tick:
+			case err := <-done:
+				return err
+			}
+		}
+		ok, err := s.sendRoute(r, cfg.LocalAS)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		sent++
+		if sent%10000 == 0 {
+			fmt.Println(sent, "updates sent")
+		}
+	}
+	fmt.Printf("Replay done: %d updates sent, %d routes skipped\n", sent, skipped)
+
+	return <-done
+}
@@ -0,0 +1,328 @@
+package injector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rahveiz/topomate/internal/mrt"
+)
+
+// BGP messages types
+const (
+	msgOpen         = 1
+	msgUpdate       = 2
+	msgNotification = 3
+	msgKeepalive    = 4
+
+	headerLen  = 19
+	maxMsgLen  = 4096
+	holdTime   = 180
+	asTrans    = 23456
+	capMP      = 1
+	capAS4     = 65
+	optCap     = 2
+	afiIPv4    = 1
+	afiIPv6    = 2
+	safiUni    = 1
+	flagOpt    = 0x80
+	flagTrans  = 0x40
+	flagExtLen = 0x10
+)
+
+// session is an established eBGP session
+type session struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	localIP net.IP
+	hold    time.Duration
+}
+
+// dial connects to the peer and establishes the session, retrying until the
+// peer accepts the connection
+func dial(cfg *Config) (*session, error) {
+	var conn net.Conn
+	for {
+		var err error
+		conn, err = net.DialTimeout("tcp", net.JoinHostPort(cfg.Peer.String(), "179"), 5*time.Second)
+		if err == nil {
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+	s := &session{
+		conn:    conn,
+		localIP: conn.LocalAddr().(*net.TCPAddr).IP,
+	}
+	if err := s.open(cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open exchanges the OPEN and KEEPALIVE messages
+func (s *session) open(cfg *Config) error {
+	id := cfg.RouterID.To4()
+	if id == nil {
+		id = s.localIP.To4()
+	}
+	if id == nil {
+		return errors.New("no IPv4 router-id")
+	}
+	afi := uint16(afiIPv4)
+	if s.localIP.To4() == nil {
+		afi = afiIPv6
+	}
+
+	myAS := uint16(asTrans)
+	if cfg.LocalAS <= 0xffff {
+		myAS = uint16(cfg.LocalAS)
+	}
+	caps := []byte{
+		capMP, 4, byte(afi >> 8), byte(afi), 0, safiUni,
+		capAS4, 4, 0, 0, 0, 0,
+	}
+	binary.BigEndian.PutUint32(caps[8:], cfg.LocalAS)
+	body := make([]byte, 10, 10+2+len(caps))
+	body[0] = 4
+	binary.BigEndian.PutUint16(body[1:], myAS)
+	binary.BigEndian.PutUint16(body[3:], holdTime)
+	copy(body[5:9], id)
+	body[9] = byte(2 + len(caps))
+	body = append(body, optCap, byte(len(caps)))
+	body = append(body, caps...)
+	if err := s.send(msgOpen, body); err != nil {
+		return err
+	}
+
+	t, msg, err := s.read()
+	if err != nil {
+		return err
+	}
+	if t != msgOpen {
+		return unexpected(t, msg)
+	}
+	if err := s.checkOpen(msg, cfg); err != nil {
+		return err
+	}
+	if err := s.send(msgKeepalive, nil); err != nil {
+		return err
+	}
+	if t, msg, err = s.read(); err != nil {
+		return err
+	}
+	if t != msgKeepalive {
+		return unexpected(t, msg)
+	}
+	return nil
+}
+
+// checkOpen checks the OPEN message of the peer, and negotiates the hold
+// time
+func (s *session) checkOpen(msg []byte, cfg *Config) error {
+	if len(msg) < 10 {
+		return errors.New("invalid OPEN message")
+	}
+	peerAS := uint32(binary.BigEndian.Uint16(msg[1:]))
+	hold := binary.BigEndian.Uint16(msg[3:])
+	if hold > holdTime {
+		hold = holdTime
+	}
+	s.hold = time.Duration(hold) * time.Second
+
+	as4 := false
+	params := msg[10:]
+	for len(params) >= 2 {
+		t, l := params[0], int(params[1])
+		if len(params) < 2+l {
+			break
+		}
+		caps := params[2 : 2+l]
+		params = params[2+l:]
+		for t == optCap && len(caps) >= 2 {
+			code, cl := caps[0], int(caps[1])
+			if len(caps) < 2+cl {
+				break
+			}
+			if code == capAS4 && cl == 4 {
+				as4 = true
+				peerAS = binary.BigEndian.Uint32(caps[2:])
+			}
+			caps = caps[2+cl:]
+		}
+	}
+	if !as4 {
+		return errors.New("the peer does not support 4 bytes AS numbers")
+	}
+	if cfg.PeerAS != 0 && peerAS != cfg.PeerAS {
+		return fmt.Errorf("unexpected peer AS %d", peerAS)
+	}
+	return nil
+}
+
+func unexpected(t byte, msg []byte) error {
+	if t == msgNotification && len(msg) >= 2 {
+		return fmt.Errorf("notification received (code %d, subcode %d)", msg[0], msg[1])
+	}
+	return fmt.Errorf("unexpected message type %d", t)
+}
+
+func (s *session) send(t byte, body []byte) error {
+	msg := make([]byte, headerLen, headerLen+len(body))
+	for i := 0; i < 16; i++ {
+		msg[i] = 0xff
+	}
+	binary.BigEndian.PutUint16(msg[16:], uint16(headerLen+len(body)))
+	msg[18] = t
+	msg = append(msg, body...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *session) read() (byte, []byte, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(s.conn, header[:]); err != nil {
+		return 0, nil, err
+	}
+	l := int(binary.BigEndian.Uint16(header[16:]))
+	if l < headerLen || l > maxMsgLen {
+		return 0, nil, fmt.Errorf("invalid message length %d", l)
+	}
+	body := make([]byte, l-headerLen)
+	if _, err := io.ReadFull(s.conn, body); err != nil {
+		return 0, nil, err
+	}
+	return header[18], body, nil
+}
+
+// run sends keepalives and reads the messages of the peer until the session
+// goes down
+func (s *session) run() error {
+	if s.hold > 0 {
+		go func() {
+			for range time.Tick(s.hold / 3) {
+				if s.send(msgKeepalive, nil) != nil {
+					return
+				}
+			}
+		}()
+	}
+	for {
+		t, msg, err := s.read()
+		if err != nil {
+			return err
+		}
+		if t == msgNotification {
+			return unexpected(t, msg)
+		}
+	}
+}
+
+// sendRoute sends an UPDATE message announcing or withdrawing a route. It
+// returns false if the message cannot be built.
+func (s *session) sendRoute(r mrt.Route, localAS uint32) (bool, error) {
+	v4 := r.Prefix.IP.To4() != nil
+	nlri := encodePrefix(r.Prefix)
+
+	var withdrawn, attrs, reach []byte
+	if r.Withdraw {
+		if v4 {
+			withdrawn = nlri
+		} else {
+			attrs = appendAttr(attrs, flagOpt, 15, append([]byte{0, afiIPv6, safiUni}, nlri...))
+		}
+	} else {
+		a := r.Attrs
+		attrs = appendAttr(attrs, flagTrans, 1, []byte{a.Origin})
+		attrs = appendAttr(attrs, flagTrans, 2, encodeASPath(a.ASPath, localAS))
+		if v4 {
+			attrs = appendAttr(attrs, flagTrans, 3, s.localIP.To4())
+			reach = nlri
+		} else {
+			mp := append([]byte{0, afiIPv6, safiUni, net.IPv6len}, s.localIP.To16()...)
+			mp = append(append(mp, 0), nlri...)
+			attrs = appendAttr(attrs, flagOpt, 14, mp)
+		}
+		if a.HasMED {
+			med := make([]byte, 4)
+			binary.BigEndian.PutUint32(med, a.MED)
+			attrs = appendAttr(attrs, flagOpt, 4, med)
+		}
+		if len(a.Communities) > 0 {
+			comm := make([]byte, 4*len(a.Communities))
+			for i, c := range a.Communities {
+				binary.BigEndian.PutUint32(comm[4*i:], c)
+			}
+			attrs = appendAttr(attrs, flagOpt|flagTrans, 8, comm)
+		}
+		if len(a.LargeCommunities) > 0 {
+			attrs = appendAttr(attrs, flagOpt|flagTrans, 32, a.LargeCommunities)
+		}
+	}
+
+	body := make([]byte, 0, 4+len(withdrawn)+len(attrs)+len(reach))
+	body = append(body, byte(len(withdrawn)>>8), byte(len(withdrawn)))
+	body = append(body, withdrawn...)
+	body = append(body, byte(len(attrs)>>8), byte(len(attrs)))
+	body = append(body, attrs...)
+	body = append(body, reach...)
+	if headerLen+len(body) > maxMsgLen {
+		return false, nil
+	}
+	return true, s.send(msgUpdate, body)
+}
+
+// appendAttr appends a path attribute, always using the extended length
+func appendAttr(dst []byte, flags, t byte, v []byte) []byte {
+	dst = append(dst, flags|flagExtLen, t, byte(len(v)>>8), byte(len(v)))
+	return append(dst, v...)
+}
+
+// encodeASPath encodes a path using 4 bytes AS numbers, prepending localAS
+func encodeASPath(path []mrt.Segment, localAS uint32) []byte {
+	segs := make([]mrt.Segment, 0, len(path)+1)
+	if len(path) > 0 && !path[0].Set && len(path[0].ASNs) < 255 {
+		segs = append(segs, mrt.Segment{ASNs: append([]uint32{localAS}, path[0].ASNs...)})
+		segs = append(segs, path[1:]...)
+	} else {
+		segs = append(segs, mrt.Segment{ASNs: []uint32{localAS}})
+		segs = append(segs, path...)
+	}
+
+	res := make([]byte, 0, 64)
+	for _, seg := range segs {
+		t := byte(2)
+		if seg.Set {
+			t = 1
+		}
+		for len(seg.ASNs) > 0 {
+			n := len(seg.ASNs)
+			if n > 255 {
+				n = 255
+			}
+			res = append(res, t, byte(n))
+			for _, asn := range seg.ASNs[:n] {
+				res = append(res, byte(asn>>24), byte(asn>>16), byte(asn>>8), byte(asn))
+			}
+			seg.ASNs = seg.ASNs[n:]
+		}
+	}
+	return res
+}
+
+func encodePrefix(p net.IPNet) []byte {
+	ones, _ := p.Mask.Size()
+	ip := p.IP.To4()
+	if ip == nil {
+		ip = p.IP.To16()
+	}
+	return append([]byte{byte(ones)}, ip[:(ones+7)/8]...)
+}
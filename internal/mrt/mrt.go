@@ -0,0 +1,477 @@
+// Package mrt reads the BGP routes of MRT files (RFC 6396): TABLE_DUMP_V2
+// RIB dumps and BGP4MP updates, possibly compressed with gzip or bzip2.
+package mrt
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+)
+
+// MRT types and subtypes
+const (
+	typeTableDumpV2 = 13
+	typeBGP4MP      = 16
+	typeBGP4MPET    = 17
+
+	subtypeRIBIPv4Unicast = 2
+	subtypeRIBIPv6Unicast = 4
+
+	subtypeMessage         = 1
+	subtypeMessageAS4      = 4
+	subtypeMessageLocal    = 6
+	subtypeMessageAS4Local = 7
+)
+
+// BGP path attributes types
+const (
+	attrOrigin          = 1
+	attrASPath          = 2
+	attrMED             = 4
+	attrCommunity       = 8
+	attrMPReach         = 14
+	attrMPUnreach       = 15
+	attrAS4Path         = 17
+	attrLargeCommunity  = 32
+	segmentSet          = 1
+	segmentSequence     = 2
+	afiIPv4             = 1
+	afiIPv6             = 2
+	safiUnicast         = 1
+	bgpHeaderLen        = 19
+	bgpMessageUpdate    = 2
+	attrFlagExtendedLen = 0x10
+)
+
+var errTruncated = errors.New("truncated data")
+
+// Segment is an AS_PATH segment
+type Segment struct {
+	Set  bool
+	ASNs []uint32
+}
+
+// Attributes are the path attributes of a route kept when replaying it
+type Attributes struct {
+	Origin      uint8
+	ASPath      []Segment
+	MED         uint32
+	HasMED      bool
+	Communities []uint32
+	// LargeCommunities contains the raw 12 bytes entries
+	LargeCommunities []byte
+}
+
+// Route is an announcement or a withdrawal of a prefix
+type Route struct {
+	Prefix   net.IPNet
+	Withdraw bool
+	Attrs    *Attributes
+}
+
+// Reader reads the routes of an MRT file
+type Reader struct {
+	r      *bufio.Reader
+	file   *os.File
+	routes []Route
+	// PeerIndex selects the RIB entries of a peer of the dump, -1 keeping the
+	// first entry of each prefix
+	PeerIndex int
+}
+
+// Open opens an MRT file, detecting its compression
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(3)
+	var src io.Reader = br
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		src = gz
+	case len(magic) == 3 && string(magic) == "BZh":
+		src = bzip2.NewReader(br)
+	}
+	return &Reader{
+		r:         bufio.NewReaderSize(src, 1<<16),
+		file:      f,
+		PeerIndex: -1,
+	}, nil
+}
+
+// Close closes the underlying file
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Next returns the next route of the file, or io.EOF at the end. Unsupported
+// records are skipped.
+func (r *Reader) Next() (Route, error) {
+	for len(r.routes) == 0 {
+		if err := r.readRecord(); err != nil {
+			return Route{}, err
+		}
+	}
+	route := r.routes[0]
+	r.routes = r.routes[1:]
+	return route, nil
+}
+
+func (r *Reader) readRecord() error {
+	var header [12]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+	t := binary.BigEndian.Uint16(header[4:6])
+	subtype := binary.BigEndian.Uint16(header[6:8])
+	body := make([]byte, binary.BigEndian.Uint32(header[8:12]))
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return errTruncated
+	}
+
+	var err error
+	switch t {
+	case typeTableDumpV2:
+		switch subtype {
+		case subtypeRIBIPv4Unicast:
+			err = r.readRIB(body, net.IPv4len)
+		case subtypeRIBIPv6Unicast:
+			err = r.readRIB(body, net.IPv6len)
+		}
+	case typeBGP4MPET:
+		if len(body) < 4 {
+			return errTruncated
+		}
+		body = body[4:]
+		fallthrough
+	case typeBGP4MP:
+		switch subtype {
+		case subtypeMessage, subtypeMessageLocal:
+			err = r.readBGP4MP(body, false)
+		case subtypeMessageAS4, subtypeMessageAS4Local:
+			err = r.readBGP4MP(body, true)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("MRT record (type %d, subtype %d): %v", t, subtype, err)
+	}
+	return nil
+}
+
+// readRIB reads a RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record
+func (r *Reader) readRIB(body []byte, ipLen int) error {
+	if len(body) < 5 {
+		return errTruncated
+	}
+	prefix, n, err := readPrefix(body[4:], ipLen)
+	if err != nil {
+		return err
+	}
+	body = body[4+n:]
+	if len(body) < 2 {
+		return errTruncated
+	}
+	count := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	for i := 0; i < count; i++ {
+		if len(body) < 8 {
+			return errTruncated
+		}
+		peer := int(binary.BigEndian.Uint16(body))
+		attrLen := int(binary.BigEndian.Uint16(body[6:]))
+		if len(body) < 8+attrLen {
+			return errTruncated
+		}
+		attrs := body[8 : 8+attrLen]
+		body = body[8+attrLen:]
+		if r.PeerIndex >= 0 && peer != r.PeerIndex {
+			continue
+		}
+		// AS_PATH attributes of RIB entries always use 4 bytes ASN
+		a, _, _, err := parseAttributes(attrs, true, true)
+		if err != nil {
+			return err
+		}
+		r.routes = append(r.routes, Route{Prefix: prefix, Attrs: a})
+		break
+	}
+	return nil
+}
+
+// readBGP4MP reads the UPDATE message of a BGP4MP_MESSAGE record
+func (r *Reader) readBGP4MP(body []byte, as4 bool) error {
+	asLen := 2
+	if as4 {
+		asLen = 4
+	}
+	if len(body) < 2*asLen+4 {
+		return errTruncated
+	}
+	afi := binary.BigEndian.Uint16(body[2*asLen+2:])
+	ipLen := net.IPv4len
+	if afi == afiIPv6 {
+		ipLen = net.IPv6len
+	}
+	body = body[2*asLen+4:]
+	if len(body) < 2*ipLen+bgpHeaderLen {
+		return errTruncated
+	}
+	msg := body[2*ipLen:]
+	if msg[18] != bgpMessageUpdate {
+		return nil
+	}
+	msg = msg[bgpHeaderLen:]
+
+	if len(msg) < 2 {
+		return errTruncated
+	}
+	wLen := int(binary.BigEndian.Uint16(msg))
+	if len(msg) < 2+wLen+2 {
+		return errTruncated
+	}
+	withdrawn, err := readPrefixes(msg[2:2+wLen], net.IPv4len)
+	if err != nil {
+		return err
+	}
+	msg = msg[2+wLen:]
+	aLen := int(binary.BigEndian.Uint16(msg))
+	if len(msg) < 2+aLen {
+		return errTruncated
+	}
+	attrs, reach, unreach, err := parseAttributes(msg[2:2+aLen], as4, false)
+	if err != nil {
+		return err
+	}
+	nlri, err := readPrefixes(msg[2+aLen:], net.IPv4len)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range append(withdrawn, unreach...) {
+		r.routes = append(r.routes, Route{Prefix: p, Withdraw: true})
+	}
+	for _, p := range append(nlri, reach...) {
+		r.routes = append(r.routes, Route{Prefix: p, Attrs: attrs})
+	}
+	return nil
+}
+
+// parseAttributes returns the attributes kept from a list of path attributes,
+// and the unicast prefixes of the MP_REACH_NLRI and MP_UNREACH_NLRI
+// attributes. The attributes of RIB entries (rib) use the abbreviated
+// MP_REACH_NLRI of RFC 6396, without NLRI.
+func parseAttributes(data []byte, as4, rib bool) (a *Attributes, reach, unreach []net.IPNet, err error) {
+	a = &Attributes{}
+	var as4Path []Segment
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, nil, nil, errTruncated
+		}
+		flags, t := data[0], data[1]
+		hLen, vLen := 3, int(data[2])
+		if flags&attrFlagExtendedLen != 0 {
+			if len(data) < 4 {
+				return nil, nil, nil, errTruncated
+			}
+			hLen, vLen = 4, int(binary.BigEndian.Uint16(data[2:]))
+		}
+		if len(data) < hLen+vLen {
+			return nil, nil, nil, errTruncated
+		}
+		v := data[hLen : hLen+vLen]
+		data = data[hLen+vLen:]
+
+		switch t {
+		case attrOrigin:
+			if len(v) > 0 {
+				a.Origin = v[0]
+			}
+		case attrASPath:
+			if a.ASPath, err = parseASPath(v, as4); err != nil {
+				return nil, nil, nil, err
+			}
+		case attrAS4Path:
+			if as4Path, err = parseASPath(v, true); err != nil {
+				return nil, nil, nil, err
+			}
+		case attrMED:
+			if len(v) == 4 {
+				a.MED, a.HasMED = binary.BigEndian.Uint32(v), true
+			}
+		case attrCommunity:
+			for i := 0; i+4 <= len(v); i += 4 {
+				a.Communities = append(a.Communities, binary.BigEndian.Uint32(v[i:]))
+			}
+		case attrLargeCommunity:
+			a.LargeCommunities = append([]byte(nil), v[:len(v)-len(v)%12]...)
+		case attrMPReach:
+			if rib {
+				if len(v) < 1 || len(v) < 1+int(v[0]) {
+					return nil, nil, nil, errTruncated
+				}
+				break
+			}
+			if reach, err = parseMPReach(v); err != nil {
+				return nil, nil, nil, err
+			}
+		case attrMPUnreach:
+			if unreach, err = parseMPUnreach(v); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+	if !as4 && as4Path != nil {
+		a.ASPath = mergeAS4Path(a.ASPath, as4Path)
+	}
+	return a, reach, unreach, nil
+}
+
+func parseASPath(v []byte, as4 bool) ([]Segment, error) {
+	asLen := 2
+	if as4 {
+		asLen = 4
+	}
+	res := make([]Segment, 0, 1)
+	for len(v) > 0 {
+		if len(v) < 2 {
+			return nil, errTruncated
+		}
+		t, count := v[0], int(v[1])
+		if len(v) < 2+count*asLen {
+			return nil, errTruncated
+		}
+		seg := Segment{Set: t == segmentSet, ASNs: make([]uint32, count)}
+		for i := 0; i < count; i++ {
+			b := v[2+i*asLen:]
+			if as4 {
+				seg.ASNs[i] = binary.BigEndian.Uint32(b)
+			} else {
+				seg.ASNs[i] = uint32(binary.BigEndian.Uint16(b))
+			}
+		}
+		v = v[2+count*asLen:]
+		// confederation segments are not kept
+		if t == segmentSet || t == segmentSequence {
+			res = append(res, seg)
+		}
+	}
+	return res, nil
+}
+
+// pathLen returns the number of AS of a path, AS sets counting as one
+func pathLen(path []Segment) int {
+	n := 0
+	for _, s := range path {
+		if s.Set {
+			n++
+		} else {
+			n += len(s.ASNs)
+		}
+	}
+	return n
+}
+
+// mergeAS4Path rebuilds the path of a route from a 2 bytes AS speaker
+// (RFC 6793), replacing the end of AS_PATH by AS4_PATH
+func mergeAS4Path(path, as4Path []Segment) []Segment {
+	keep := pathLen(path) - pathLen(as4Path)
+	if keep < 0 {
+		return path
+	}
+	res := make([]Segment, 0, len(path)+len(as4Path))
+	for _, s := range path {
+		if keep == 0 {
+			break
+		}
+		if s.Set {
+			res = append(res, s)
+			keep--
+			continue
+		}
+		n := len(s.ASNs)
+		if n > keep {
+			n = keep
+		}
+		res = append(res, Segment{ASNs: s.ASNs[:n]})
+		keep -= n
+	}
+	return append(res, as4Path...)
+}
+
+func parseMPReach(v []byte) ([]net.IPNet, error) {
+	if len(v) < 5 {
+		return nil, errTruncated
+	}
+	afi, safi, nhLen := binary.BigEndian.Uint16(v), v[2], int(v[3])
+	if len(v) < 5+nhLen {
+		return nil, errTruncated
+	}
+	if safi != safiUnicast || (afi != afiIPv4 && afi != afiIPv6) {
+		return nil, nil
+	}
+	return readPrefixes(v[5+nhLen:], afiLen(afi))
+}
+
+func parseMPUnreach(v []byte) ([]net.IPNet, error) {
+	if len(v) < 3 {
+		return nil, errTruncated
+	}
+	afi, safi := binary.BigEndian.Uint16(v), v[2]
+	if safi != safiUnicast || (afi != afiIPv4 && afi != afiIPv6) {
+		return nil, nil
+	}
+	return readPrefixes(v[3:], afiLen(afi))
+}
+
+func afiLen(afi uint16) int {
+	if afi == afiIPv6 {
+		return net.IPv6len
+	}
+	return net.IPv4len
+}
+
+func readPrefixes(data []byte, ipLen int) ([]net.IPNet, error) {
+	res := make([]net.IPNet, 0, 1)
+	for len(data) > 0 {
+		p, n, err := readPrefix(data, ipLen)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+		data = data[n:]
+	}
+	return res, nil
+}
+
+// readPrefix reads a prefix encoded as its length followed by the
+// significant bytes, and returns the number of bytes read
+func readPrefix(data []byte, ipLen int) (net.IPNet, int, error) {
+	if len(data) < 1 {
+		return net.IPNet{}, 0, errTruncated
+	}
+	bits := int(data[0])
+	n := (bits + 7) / 8
+	if bits > ipLen*8 || len(data) < 1+n {
+		return net.IPNet{}, 0, errTruncated
+	}
+	ip := make(net.IP, ipLen)
+	copy(ip, data[1:1+n])
+	mask := net.CIDRMask(bits, ipLen*8)
+	return net.IPNet{IP: ip.Mask(mask), Mask: mask}, 1 + n, nil
+}
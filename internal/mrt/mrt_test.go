@@ -0,0 +1,285 @@
+package mrt
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func u16(v int) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, uint16(v))
+	return b
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func cat(parts ...[]byte) []byte {
+	var res []byte
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
+
+func cidr(s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return *n
+}
+
+// nlri encodes a prefix as its length followed by its significant bytes
+func nlri(s string) []byte {
+	n := cidr(s)
+	bits, _ := n.Mask.Size()
+	return append([]byte{byte(bits)}, n.IP[:(bits+7)/8]...)
+}
+
+func attr(t byte, v []byte) []byte {
+	return cat([]byte{0x40, t, byte(len(v))}, v)
+}
+
+func asPathAttr(t byte, as4 bool, asns ...uint32) []byte {
+	v := []byte{segmentSequence, byte(len(asns))}
+	for _, asn := range asns {
+		if as4 {
+			v = append(v, u32(asn)...)
+		} else {
+			v = append(v, u16(int(asn))...)
+		}
+	}
+	return attr(t, v)
+}
+
+// ribRecord builds a RIB_IPV4_UNICAST or RIB_IPV6_UNICAST record body with
+// an entry per attributes list, the peer index being the position
+func ribRecord(prefix string, entries ...[]byte) []byte {
+	body := cat(u32(1), nlri(prefix), u16(len(entries)))
+	for i, attrs := range entries {
+		body = cat(body, u16(i), u32(0), u16(len(attrs)), attrs)
+	}
+	return body
+}
+
+// bgp4mpRecord builds a BGP4MP_MESSAGE(_AS4) record body containing an
+// UPDATE message
+func bgp4mpRecord(as4, v6 bool, withdrawn, attrs, reach []byte) []byte {
+	asLen, afi, ipLen := 2, afiIPv4, net.IPv4len
+	if as4 {
+		asLen = 4
+	}
+	if v6 {
+		afi, ipLen = afiIPv6, net.IPv6len
+	}
+	update := cat(u16(len(withdrawn)), withdrawn, u16(len(attrs)), attrs, reach)
+	marker := make([]byte, 16)
+	for i := range marker {
+		marker[i] = 0xff
+	}
+	msg := cat(marker, u16(bgpHeaderLen+len(update)), []byte{bgpMessageUpdate}, update)
+	return cat(make([]byte, 2*asLen), u16(0), u16(afi), make([]byte, 2*ipLen), msg)
+}
+
+func TestReadRIB(t *testing.T) {
+	origin := attr(attrOrigin, []byte{0})
+	tests := []struct {
+		name      string
+		body      []byte
+		ipLen     int
+		peerIndex int
+		want      []Route
+		wantErr   bool
+	}{
+		{
+			name:      "IPv4",
+			body:      ribRecord("10.0.0.0/8", cat(origin, asPathAttr(attrASPath, true, 65001, 4200000000))),
+			ipLen:     net.IPv4len,
+			peerIndex: -1,
+			want: []Route{{
+				Prefix: cidr("10.0.0.0/8"),
+				Attrs:  &Attributes{ASPath: []Segment{{ASNs: []uint32{65001, 4200000000}}}},
+			}},
+		},
+		{
+			name: "IPv6 abbreviated MP_REACH_NLRI",
+			body: ribRecord("2001:db8:1::/48", cat(
+				origin,
+				asPathAttr(attrASPath, true, 65002),
+				attr(attrMPReach, cat([]byte{16}, net.ParseIP("2001:db8::1"))),
+			)),
+			ipLen:     net.IPv6len,
+			peerIndex: -1,
+			want: []Route{{
+				Prefix: cidr("2001:db8:1::/48"),
+				Attrs:  &Attributes{ASPath: []Segment{{ASNs: []uint32{65002}}}},
+			}},
+		},
+		{
+			name: "peer index",
+			body: ribRecord("192.0.2.0/24",
+				cat(origin, asPathAttr(attrASPath, true, 65001)),
+				cat(origin, asPathAttr(attrASPath, true, 65002), attr(attrMED, u32(10))),
+			),
+			ipLen:     net.IPv4len,
+			peerIndex: 1,
+			want: []Route{{
+				Prefix: cidr("192.0.2.0/24"),
+				Attrs: &Attributes{
+					ASPath: []Segment{{ASNs: []uint32{65002}}},
+					MED:    10,
+					HasMED: true,
+				},
+			}},
+		},
+		{
+			name:      "truncated entry",
+			body:      ribRecord("10.0.0.0/8", origin)[:14],
+			ipLen:     net.IPv4len,
+			peerIndex: -1,
+			wantErr:   true,
+		},
+		{
+			name: "truncated next hop",
+			body: ribRecord("2001:db8:1::/48", cat(
+				asPathAttr(attrASPath, true, 65002),
+				attr(attrMPReach, cat([]byte{16}, net.ParseIP("2001:db8::1")[:8])),
+			)),
+			ipLen:     net.IPv6len,
+			peerIndex: -1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reader{PeerIndex: tt.peerIndex}
+			err := r.readRIB(tt.body, tt.ipLen)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRIB() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(r.routes, tt.want) {
+				t.Errorf("readRIB() routes = %+v, want %+v", r.routes, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadBGP4MP(t *testing.T) {
+	origin := attr(attrOrigin, []byte{0})
+	tests := []struct {
+		name    string
+		body    []byte
+		as4     bool
+		want    []Route
+		wantErr bool
+	}{
+		{
+			name: "AS2 IPv4",
+			body: bgp4mpRecord(false, false,
+				nlri("10.1.0.0/16"),
+				cat(origin, asPathAttr(attrASPath, false, 65001, 65002)),
+				nlri("10.2.0.0/16"),
+			),
+			want: []Route{
+				{Prefix: cidr("10.1.0.0/16"), Withdraw: true},
+				{
+					Prefix: cidr("10.2.0.0/16"),
+					Attrs:  &Attributes{ASPath: []Segment{{ASNs: []uint32{65001, 65002}}}},
+				},
+			},
+		},
+		{
+			name: "AS2 with AS4_PATH",
+			body: bgp4mpRecord(false, false, nil,
+				cat(
+					origin,
+					asPathAttr(attrASPath, false, 65001, 23456),
+					asPathAttr(attrAS4Path, true, 4200000000),
+				),
+				nlri("10.2.0.0/16"),
+			),
+			want: []Route{{
+				Prefix: cidr("10.2.0.0/16"),
+				Attrs: &Attributes{ASPath: []Segment{
+					{ASNs: []uint32{65001}},
+					{ASNs: []uint32{4200000000}},
+				}},
+			}},
+		},
+		{
+			name: "AS4 IPv4",
+			body: bgp4mpRecord(true, false, nil,
+				cat(
+					origin,
+					asPathAttr(attrASPath, true, 4200000000),
+					attr(attrCommunity, u32(65001<<16|100)),
+				),
+				nlri("198.51.100.0/24"),
+			),
+			as4: true,
+			want: []Route{{
+				Prefix: cidr("198.51.100.0/24"),
+				Attrs: &Attributes{
+					ASPath:      []Segment{{ASNs: []uint32{4200000000}}},
+					Communities: []uint32{65001<<16 | 100},
+				},
+			}},
+		},
+		{
+			name: "AS4 IPv6",
+			body: bgp4mpRecord(true, true, nil,
+				cat(
+					origin,
+					asPathAttr(attrASPath, true, 65001),
+					attr(attrMPReach, cat(
+						u16(afiIPv6), []byte{safiUnicast, 16}, net.ParseIP("2001:db8::1"),
+						[]byte{0}, nlri("2001:db8:1::/48"),
+					)),
+					attr(attrMPUnreach, cat(u16(afiIPv6), []byte{safiUnicast}, nlri("2001:db8:2::/48"))),
+				),
+				nil,
+			),
+			as4: true,
+			want: []Route{
+				{Prefix: cidr("2001:db8:2::/48"), Withdraw: true},
+				{
+					Prefix: cidr("2001:db8:1::/48"),
+					Attrs:  &Attributes{ASPath: []Segment{{ASNs: []uint32{65001}}}},
+				},
+			},
+		},
+		{
+			name: "truncated update",
+			body: bgp4mpRecord(true, false, nil,
+				cat(origin, asPathAttr(attrASPath, true, 65001)),
+				nlri("10.2.0.0/16"),
+			)[:50],
+			as4:     true,
+			wantErr: true,
+		},
+		{
+			name:    "truncated header",
+			body:    make([]byte, 6),
+			as4:     true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reader{PeerIndex: -1}
+			err := r.readBGP4MP(tt.body, tt.as4)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBGP4MP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(r.routes, tt.want) {
+				t.Errorf("readBGP4MP() routes = %+v, want %+v", r.routes, tt.want)
+			}
+		})
+	}
+}
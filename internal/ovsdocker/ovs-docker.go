@@ -19,6 +19,8 @@ import (
 
 const MPLSMAXLabels = 65535
 
+const VXLANPort = 4789
+
 type PortSettings struct {
 	MTU    int
 	Speed  int
@@ -26,6 +28,18 @@ type PortSettings struct {
 	VRF    string
 	IP     string
 	Routes []IPRoute
+	// Host is set for interfaces of end hosts (no routing daemon)
+	Host bool
+}
+
+// VNISettings describes a VXLAN segment terminated in a container
+type VNISettings struct {
+	VNI     int
+	Local   string
+	VRF     string
+	Ports   []string
+	Gateway string
+	MAC     string
 }
 
 type IPRoute struct {
@@ -51,6 +65,9 @@ type OVSInterface struct {
 
 type OVSBulk map[string][]OVSInterface
 
+// VNIBulk contains the VNIs terminated in each container
+type VNIBulk map[string][]VNISettings
+
 func DefaultParams() PortSettings {
 	return PortSettings{
 		MTU:   1500,
@@ -224,9 +241,20 @@ func (c *OVSDockerClient) AddPort(brName, ifName string, settings PortSettings,
 
 	portHost, portCont := c.IfNames()
 
+	// Set the MTU on both ends (kept when moving to the container)
+	if settings.MTU > 0 {
+		mtu := strconv.Itoa(settings.MTU)
+		if err := ExecLink("set", portHost, "mtu", mtu); err != nil {
+			return err
+		}
+		if err := ExecLink("set", portCont, "mtu", mtu); err != nil {
+			return err
+		}
+	}
+
 	if bridge {
 		// Add the host end of the veth to an OVS bridge
-		if err := c.addToBridge(brName, ifName, settings.Speed, settings.OFPort); err != nil {
+		if err := c.addToBridge(brName, ifName, settings.Speed, settings.MTU, settings.OFPort); err != nil {
 			return err
 		}
 	}
@@ -284,13 +312,13 @@ func (c *OVSDockerClient) AddPort(brName, ifName string, settings PortSettings,
 
 	// Add a VRF in needed
 	if settings.VRF != "" {
-		c.ExecNS("ip", "link", "add", settings.VRF, "type", "vrf", "table", strconv.Itoa(nextTableID))
-		c.ExecNS("ip", "link", "set", settings.VRF, "up")
+		if err := c.addVRF(settings.VRF); err != nil {
+			return err
+		}
 
 		if err := c.ExecNS("ip", "link", "set", ifName, "vrf", settings.VRF); err != nil {
 			return err
 		}
-		nextTableID++
 	}
 
 	// Add IP if specified
@@ -314,6 +342,66 @@ func (c *OVSDockerClient) AddPort(brName, ifName string, settings PortSettings,
 	return nil
 }
 
+// addVRF creates a VRF device in the container (nothing is done if it
+// already exists)
+func (c *OVSDockerClient) addVRF(name string) error {
+	if err := c.ExecNS("ip", "link", "show", name); err == nil {
+		return nil
+	}
+	if err := c.ExecNS("ip", "link", "add", name, "type", "vrf", "table", strconv.Itoa(nextTableID)); err != nil {
+		return err
+	}
+	nextTableID++
+	return c.ExecNS("ip", "link", "set", name, "up")
+}
+
+// AddVNI creates a VXLAN device sourced from settings.Local and its bridge
+// in the container, then attaches the ports (and the bridge to the VRF if
+// any). Without ports, the VNI is a L3VNI and the bridge is attached to the
+// VRF.
+func (c *OVSDockerClient) AddVNI(settings VNISettings) error {
+	c.createNetNSLink()
+	defer c.deleteNetNSLink()
+
+	vni := strconv.Itoa(settings.VNI)
+	br := "br" + vni
+	vxlan := "vxlan" + vni
+
+	cmds := [][]string{
+		{"ip", "link", "add", br, "type", "bridge"},
+		{"ip", "link", "add", vxlan, "type", "vxlan", "id", vni,
+			"local", settings.Local, "dstport", strconv.Itoa(VXLANPort), "nolearning"},
+		{"ip", "link", "set", vxlan, "master", br, "addrgenmode", "none"},
+		{"bridge", "link", "set", "dev", vxlan, "learning", "off", "neigh_suppress", "on"},
+	}
+	for _, port := range settings.Ports {
+		cmds = append(cmds, []string{"ip", "link", "set", port, "master", br})
+	}
+	if settings.MAC != "" {
+		cmds = append(cmds, []string{"ip", "link", "set", br, "address", settings.MAC})
+	}
+	if settings.VRF != "" {
+		if err := c.addVRF(settings.VRF); err != nil {
+			return err
+		}
+		cmds = append(cmds, []string{"ip", "link", "set", br, "master", settings.VRF})
+	}
+	if settings.Gateway != "" {
+		cmds = append(cmds, []string{"ip", "address", "add", settings.Gateway, "dev", br})
+	}
+	cmds = append(cmds,
+		[]string{"ip", "link", "set", vxlan, "up"},
+		[]string{"ip", "link", "set", br, "up"},
+	)
+
+	for _, cmd := range cmds {
+		if err := c.ExecNS(cmd...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // DeletePort deletes a port from a container
 func (c *OVSDockerClient) DeletePort(ifName string) {
 	port, ok := c.FindPort(ifName)
@@ -377,7 +465,7 @@ func (c *OVSDockerClient) createVEth() error {
 	return ExecLink("add", host, "type", "veth", "peer", "name", cont)
 }
 
-func (c *OVSDockerClient) addToBridge(brName, ifName string, speed int, ofport int) error {
+func (c *OVSDockerClient) addToBridge(brName, ifName string, speed, mtu, ofport int) error {
 	var stderr bytes.Buffer
 	host := c.PortnameHost()
 	cmdArgs := []string{"ovs-vsctl",
@@ -387,6 +475,9 @@ func (c *OVSDockerClient) addToBridge(brName, ifName string, speed int, ofport i
 		"external_ids:container_iface=" + ifName,
 		"ingress_policing_rate=" + strconv.Itoa(speed*1000),
 	}
+	if mtu > 0 {
+		cmdArgs = append(cmdArgs, "mtu_request="+strconv.Itoa(mtu))
+	}
 	if ofport > 0 {
 		cmdArgs = append(cmdArgs, "ofport_request="+strconv.Itoa(ofport))
 	}
@@ -420,6 +511,9 @@ func AddToBridgeBulk(elements map[string][]OVSInterface) error {
 				"ingress_policing_rate="+strconv.Itoa(e.Settings.Speed*1000),
 				"ofport_request="+strconv.Itoa(e.Settings.OFPort),
 			)
+			if e.Settings.MTU > 0 {
+				cmdArgs = append(cmdArgs, "mtu_request="+strconv.Itoa(e.Settings.MTU))
+			}
 		}
 	}
 	cmd := utils.ExecSudo(cmdArgs...)
@@ -447,3 +541,13 @@ func getPID(containerName string) int {
 
 	return res.State.Pid
 }
+
+// IsHost returns true if the interfaces belong to an end host
+func IsHost(links []OVSInterface) bool {
+	for _, v := range links {
+		if v.Settings.Host {
+			return true
+		}
+	}
+	return false
+}
@@ -24,17 +24,37 @@ const (
 // 	Cliques [][]int `yaml:"cliques,flow"`
 // }
 
+const (
+	PECEStatic = iota
+	PECEOSPF   = iota
+	PECEISIS   = iota
+	PECEBGP    = iota
+)
+
 type VPNCustomer struct {
-	Router *Router
-	Parent *Router
-	Hub    bool
+	Router  *Router
+	Parent  *Router
+	Hub     bool
+	Subnets []net.IPNet
+	Routing int
+	// eBGP PE-CE settings: ASOverride is set on the PE side, AllowASIn on
+	// both sides (needed when several sites share the same ASN)
+	ASN        int
+	ASOverride bool
+	AllowASIn  int
 }
 
 type VPN struct {
 	VRF          string
+	RD           string
+	DownRD       string
+	ImportRT     []string
+	ExportRT     []string
 	Customers    []VPNCustomer
 	Neighbors    map[string]bool
 	SpokeSubnets []net.IPNet
+	IPv4         bool
+	IPv6         bool
 }
 type ospfAttributes struct {
 	Area int
@@ -43,32 +63,103 @@ type ospfAttributes struct {
 
 // AutonomousSystem represents an AS in a Project
 type AutonomousSystem struct {
-	ASN       int
-	IGP       string
-	MPLS      bool
-	Network   Net
-	LoStart   net.IPNet
-	Routers   []*Router
-	Hosts     []*Host
-	Links     []Link
-	HostLinks []HostLink
-	VPN       []VPN
-	BGP       struct {
-		Disabled        bool
-		RedistributeIGP bool
+	ASN  int
+	IGP  string
+	MPLS bool
+	MTU  int
+	BFD  *BFD
+	// BFDEnabled is set if BFD is used on all the IGP adjacencies and iBGP
+	// sessions of the AS
+	BFDEnabled bool
+	SR         SegmentRouting
+	EVPN       EVPN
+	Network    Net
+	LoStart    net.IPNet
+	Routers    []*Router
+	Hosts      []*Host
+	Links      []Link
+	HostLinks  []HostLink
+	LANs       []*LAN
+	VPN        []VPN
+	BGP        struct {
+		Disabled         bool
+		RedistributeIGP  bool
+		MaximumPaths     int
+		MaximumPathsIBGP int
+		MultipathRelax   bool
+		Session          BGPSession
+		// Sub-AS numbers of the confederation members, if any
+		Confederation []int
+		Originate     Originate
 	}
 	OSPF struct {
 		Stubs []int
 	}
 	RPKI struct {
 		Servers []string
+		Policy  string
+		Tag     bool
 	}
+	// explicit interface names used by each router
+	ifNames map[*Router]map[string]bool
 }
 
 func (vpn *VPN) IsHubAndSpoke() bool {
 	return vpn.SpokeSubnets != nil || len(vpn.SpokeSubnets) > 0
 }
 
+// AddressFamily returns the VPN address families needed between the PEs
+// of the VPN. IPv6 customers are carried over VPNv6 whatever the address
+// family of the core is (6VPE when the core is IPv4).
+func (vpn *VPN) AddressFamily() AddressFamily {
+	return AddressFamily{
+		VPNv4: vpn.IPv4,
+		VPNv6: vpn.IPv6,
+	}
+}
+
+// setupRouting sets the PE-CE routing protocol of the customer. If routing
+// is not specified, the IGP of the AS is used for IPv4 customers and static
+// routing for IPv6 ones (IGPs cannot run in a VRF for IPv6).
+func (c *VPNCustomer) setupRouting(a *AutonomousSystem, routing string) {
+	switch strings.ToLower(routing) {
+	case "":
+		switch {
+		case !c.IsIPv4():
+			c.Routing = PECEStatic
+		case a.IGPType() == IGPOSPF:
+			c.Routing = PECEOSPF
+		case a.IGPType() == IGPISIS:
+			c.Routing = PECEISIS
+		default:
+			c.Routing = PECEStatic
+		}
+	case "static":
+		c.Routing = PECEStatic
+	case "ospf":
+		c.Routing = PECEOSPF
+	case "isis", "is-is":
+		c.Routing = PECEISIS
+	case "bgp":
+		c.Routing = PECEBGP
+	default:
+		utils.Fatalf("AS%d: customer %s: unknown routing %s\n", a.ASN, c.Router.Hostname, routing)
+	}
+
+	if !c.IsIPv4() && (c.Routing == PECEOSPF || c.Routing == PECEISIS) {
+		utils.Fatalf("AS%d: customer %s: IGP routing is not supported for IPv6 customers\n",
+			a.ASN, c.Router.Hostname)
+	}
+	if c.Routing == PECEBGP && c.ASN < 1 {
+		utils.Fatalf("AS%d: customer %s: an ASN is needed for eBGP routing\n", a.ASN, c.Router.Hostname)
+	}
+}
+
+// IsIPv4 returns true if the customer is linked to its PE using IPv4
+func (c *VPNCustomer) IsIPv4() bool {
+	return len(c.Router.Links) == 0 || c.Router.Links[0].IP.IP.To4() != nil
+}
+
 func (a *AutonomousSystem) IsOSPFStub(area int) bool {
 	for _, e := range a.OSPF.Stubs {
 		if e == area {
@@ -161,21 +252,33 @@ func (a *AutonomousSystem) SetupLinks(cfg config.InternalLinks) {
 	case "full-mesh":
 		a.Links = a.SetupFullMesh(cfg, noCost)
 		break
+	case "lan":
+		a.LANs = append(a.LANs, a.newLAN(config.LANConfig{Name: "lan", Speed: cfg.Speed, Cost: cfg.Cost, MTU: cfg.MTU}, noCost))
+		break
 	default:
 		break
 	}
+	for _, lan := range cfg.LANs {
+		a.LANs = append(a.LANs, a.newLAN(lan, noCost))
+	}
+	checkMTU(cfg.MTU, fmt.Sprintf("AS%d links", a.ASN))
+	a.setLinksMTU(cfg.MTU)
+	a.setLinksBFD()
 }
 
 // ReserveSubnets generates IPv4 addressing for internal links in an AS
 func (a *AutonomousSystem) ReserveSubnets() {
-	if !a.Network.AutoAddress { // do not set subnets
-		return
-	}
-	for _, v := range a.Links {
-		a, b := a.Network.NextLinkIPs()
-		v.First.Interface.IP = a
-		v.Second.Interface.IP = b
+	if a.Network.AutoAddress { // do not set subnets otherwise
+		for _, v := range a.Links {
+			if len(v.First.Interface.IP.IP) > 0 { // explicit addressing
+				continue
+			}
+			a, b := a.Network.NextLinkIPs()
+			v.First.Interface.IP = a
+			v.Second.Interface.IP = b
+		}
 	}
+	a.reserveLANs()
 }
 
 func (a *AutonomousSystem) linkRouters(ibgp bool) {
@@ -250,6 +353,7 @@ func (a *AutonomousSystem) linkRouters(ibgp bool) {
 			}
 		}
 	}
+	a.linkLANs(ibgp, af)
 }
 
 func (a *AutonomousSystem) linkVPN() {
@@ -264,44 +368,36 @@ func (a *AutonomousSystem) linkVPN() {
 
 		// Add neighbors for VPN
 		for _, vpn := range a.VPN {
+			af := vpn.AddressFamily()
 			if _, ok := vpn.Neighbors[firstID]; ok {
-				for id := range vpn.Neighbors {
-					if id == firstID {
-						continue
-					}
-					nbr, ok := first.Router.Neighbors[id]
-					if ok {
-						nbr.AF.VPNv4 = true
-					} else {
-						first.Router.Neighbors[id] = &BGPNbr{
-							RemoteAS:     a.ASN,
-							UpdateSource: "lo",
-							ConnCheck:    false,
-							NextHopSelf:  false,
-							AF:           AddressFamily{VPNv4: true},
-						}
-					}
-				}
+				a.addVPNNeighbors(first.Router, firstID, vpn.Neighbors, af)
 			}
 			// Check if current router is present
 			if _, ok := vpn.Neighbors[secondID]; ok {
-				for id := range vpn.Neighbors {
-					if id == secondID {
-						continue
-					}
-					nbr, ok := second.Router.Neighbors[id]
-					if ok {
-						nbr.AF.VPNv4 = true
-					} else {
-						second.Router.Neighbors[id] = &BGPNbr{
-							RemoteAS:     a.ASN,
-							UpdateSource: "lo",
-							ConnCheck:    false,
-							NextHopSelf:  false,
-							AF:           AddressFamily{VPNv4: true},
-						}
-					}
-				}
+				a.addVPNNeighbors(second.Router, secondID, vpn.Neighbors, af)
+			}
+		}
+	}
+}
+
+// addVPNNeighbors activates the VPN address families af with all the PEs of
+// nbrs (except itself) on router r
+func (a *AutonomousSystem) addVPNNeighbors(r *Router, self string, nbrs map[string]bool, af AddressFamily) {
+	for id := range nbrs {
+		if id == self {
+			continue
+		}
+		nbr, ok := r.Neighbors[id]
+		if ok {
+			nbr.AF.VPNv4 = nbr.AF.VPNv4 || af.VPNv4
+			nbr.AF.VPNv6 = nbr.AF.VPNv6 || af.VPNv6
+		} else {
+			r.Neighbors[id] = &BGPNbr{
+				RemoteAS:     a.ASN,
+				UpdateSource: "lo",
+				ConnCheck:    false,
+				NextHopSelf:  false,
+				AF:           af,
 			}
 		}
 	}
@@ -315,8 +411,16 @@ func (a *AutonomousSystem) setupIBGP(ibgpConfig config.IBGPConfig) {
 	// Setup route reflectors and clients
 	for _, r := range ibgpConfig.RR {
 		routeReflector := a.getRouter(r.Router)
+		a.setClusterID(routeReflector, r.ClusterID)
 		for _, c := range r.Clients {
 			client := a.getRouter(c)
+			if client == routeReflector {
+				utils.Fatalf("AS%d: %s cannot be its own route reflector client\n", a.ASN, client.Hostname)
+			}
+			if nbr, ok := client.Neighbors[routeReflector.LoID()]; ok && nbr.RRClient {
+				utils.Fatalf("AS%d: %s and %s are clients of each other\n",
+					a.ASN, client.Hostname, routeReflector.Hostname)
+			}
 			id, mask := client.LoInfo()
 			routeReflector.Neighbors[id] = &BGPNbr{
 				RemoteAS:     a.ASN,
@@ -327,7 +431,7 @@ func (a *AutonomousSystem) setupIBGP(ibgpConfig config.IBGPConfig) {
 				Mask:         mask,
 			}
 
-			id, mask = client.LoInfo()
+			id, mask = routeReflector.LoInfo()
 			client.Neighbors[id] = &BGPNbr{
 				RemoteAS:     a.ASN,
 				UpdateSource: "lo",
@@ -360,6 +464,9 @@ func (a *AutonomousSystem) setupIBGP(ibgpConfig config.IBGPConfig) {
 		}
 	}
 
+	if ibgpConfig.RRFullMesh {
+		a.meshRouteReflectors(af)
+	}
 }
 
 func (a *AutonomousSystem) IGPType() int {
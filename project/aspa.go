@@ -0,0 +1,291 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rahveiz/topomate/utils"
+)
+
+// ASPA is an Autonomous System Provider Authorization, listing the providers
+// of a customer AS
+type ASPA struct {
+	Customer  int   `json:"customer_asid"`
+	Providers []int `json:"providers"`
+}
+
+type aspaSource struct {
+	ASPAs []ASPA `json:"aspas"`
+}
+
+// aspaNoProvider is the provider of the ASPA of an AS having no provider
+const aspaNoProvider = 0
+
+// ASPA verification results
+const (
+	ASPAValid   = "valid"
+	ASPAUnknown = "unknown"
+	ASPAInvalid = "invalid"
+)
+
+// ASPAs returns the ASPA objects derived from the relations of the external
+// links and IXP bilateral sessions. AS without provider get an AS0 ASPA,
+// attesting that they have no provider at all.
+func (p *Project) ASPAs() []ASPA {
+	providers := make(map[int]map[int]bool, len(p.AS))
+	add := func(customer, provider int) {
+		if _, ok := providers[customer]; !ok {
+			providers[customer] = make(map[int]bool, 2)
+		}
+		if provider != aspaNoProvider {
+			providers[customer][provider] = true
+		}
+	}
+	for _, rel := range p.asRelations() {
+		add(rel.FromASN, aspaNoProvider)
+		add(rel.ToASN, aspaNoProvider)
+		if rel.From == Provider && rel.To == Customer {
+			add(rel.ToASN, rel.FromASN)
+		} else if rel.From == Customer && rel.To == Provider {
+			add(rel.FromASN, rel.ToASN)
+		}
+	}
+
+	res := make([]ASPA, 0, len(providers))
+	for customer, m := range providers {
+		aspa := ASPA{Customer: customer, Providers: make([]int, 0, len(m))}
+		for provider := range m {
+			aspa.Providers = append(aspa.Providers, provider)
+		}
+		if len(aspa.Providers) == 0 {
+			aspa.Providers = append(aspa.Providers, aspaNoProvider)
+		}
+		sort.Ints(aspa.Providers)
+		res = append(res, aspa)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Customer < res[j].Customer })
+	return res
+}
+
+// exportASPA writes the ASPA objects of the project in path
+func (p *Project) exportASPA(path string) {
+	j, err := json.MarshalIndent(aspaSource{ASPAs: p.ASPAs()}, "", "  ")
+	if err != nil {
+		utils.Fatalln(err)
+	}
+	if err := ioutil.WriteFile(path, j, 0644); err != nil {
+		utils.Fatalln(err)
+	}
+}
+
+// loadASPA reads ASPA objects exported by exportASPA (or edited afterwards)
+func loadASPA(path string) []ASPA {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		utils.Fatalln(err)
+	}
+	var src aspaSource
+	if err := json.Unmarshal(data, &src); err != nil {
+		utils.Fatalf("%s: %v\n", path, err)
+	}
+	return src.ASPAs
+}
+
+// aspaSet indexes ASPA objects by customer
+type aspaSet map[int]map[int]bool
+
+func newASPASet(aspas []ASPA) aspaSet {
+	res := make(aspaSet, len(aspas))
+	for _, a := range aspas {
+		res[a.Customer] = make(map[int]bool, len(a.Providers))
+		for _, p := range a.Providers {
+			res[a.Customer][p] = true
+		}
+	}
+	return res
+}
+
+const (
+	hopNoAttestation = iota
+	hopProvider
+	hopNotProvider
+)
+
+// hop checks if provider is authorized by the ASPA of customer. An AS0 ASPA
+// authorizes no provider.
+func (s aspaSet) hop(customer, provider int) int {
+	providers, ok := s[customer]
+	if !ok {
+		return hopNoAttestation
+	}
+	if providers[aspaNoProvider] {
+		return hopNotProvider
+	}
+	if providers[provider] {
+		return hopProvider
+	}
+	return hopNotProvider
+}
+
+// Verify applies the ASPA verification procedure to an AS path, the first
+// AS being the neighbor and the last one the origin. Downstream verification
+// is used for paths received from a provider.
+func (s aspaSet) Verify(path []int, fromProvider bool) string {
+	// remove prepending and start from the origin
+	seq := make([]int, 0, len(path))
+	for i := len(path) - 1; i >= 0; i-- {
+		if len(seq) == 0 || seq[len(seq)-1] != path[i] {
+			seq = append(seq, path[i])
+		}
+	}
+	n := len(seq)
+	if n == 0 {
+		return ASPAValid
+	}
+
+	// Up ramp: each AS is the provider of the previous one. The max ramp
+	// stops at the first hop that is not a provider, the min ramp at the
+	// first hop that is not attested to be one.
+	maxUp, minUp := n, n
+	for i := 0; i < n-1; i++ {
+		h := s.hop(seq[i], seq[i+1])
+		if h != hopProvider && minUp == n {
+			minUp = i + 1
+		}
+		if h == hopNotProvider {
+			maxUp = i + 1
+			break
+		}
+	}
+	if !fromProvider {
+		switch {
+		case maxUp < n:
+			return ASPAInvalid
+		case minUp < n:
+			return ASPAUnknown
+		}
+		return ASPAValid
+	}
+
+	// Down ramp: each AS is the provider of the next one, starting from the
+	// neighbor
+	maxDown, minDown := n, n
+	for j := n - 1; j > 0; j-- {
+		h := s.hop(seq[j], seq[j-1])
+		if h != hopProvider && minDown == n {
+			minDown = n - j
+		}
+		if h == hopNotProvider {
+			maxDown = n - j
+			break
+		}
+	}
+	switch {
+	case n <= 2:
+		return ASPAValid
+	case maxUp+maxDown < n:
+		return ASPAInvalid
+	case minUp+minDown < n:
+		return ASPAUnknown
+	}
+	return ASPAValid
+}
+
+// parseASPath returns the ASN of an AS path, and false if it contains AS
+// sets. Confederation segments are ignored.
+func parseASPath(path string) ([]int, bool) {
+	res := make([]int, 0, 8)
+	confed := false
+	for _, f := range strings.Fields(path) {
+		if strings.HasPrefix(f, "{") {
+			return nil, false
+		}
+		if strings.HasPrefix(f, "(") || strings.HasPrefix(f, "[") {
+			confed = true
+		}
+		if confed {
+			confed = !strings.HasSuffix(f, ")") && !strings.HasSuffix(f, "]")
+			continue
+		}
+		asn, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, false
+		}
+		res = append(res, asn)
+	}
+	return res, true
+}
+
+// externalPaths returns the AS paths of the routes learned using eBGP by r,
+// indexed by prefix
+func (r *Router) externalPaths() (map[string][]string, error) {
+	routes, err := r.Backend().RIB(r)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]string)
+	for _, route := range routes {
+		if route.Valid && route.External && route.Path != "" {
+			res[route.Prefix] = append(res[route.Prefix], route.Path)
+		}
+	}
+	return res, nil
+}
+
+// VerifyASPA checks the AS paths of the routes learned using eBGP by the
+// routers of the project against the ASPA objects, read from aspaFile or
+// derived from the topology if empty. It prints the invalid paths and the
+// number of paths of each state per AS, and returns the number of invalid
+// paths.
+func (p *Project) VerifyASPA(aspaFile string) int {
+	aspas := p.ASPAs()
+	if aspaFile != "" {
+		aspas = loadASPA(aspaFile)
+	}
+	set := newASPASet(aspas)
+
+	asns := make([]int, 0, len(p.AS))
+	for n := range p.AS {
+		asns = append(asns, n)
+	}
+	sort.Ints(asns)
+
+	invalid := 0
+	for _, n := range asns {
+		count := make(map[string]int, 3)
+		for _, r := range p.AS[n].Routers {
+			routes, err := r.externalPaths()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			prefixes := make([]string, 0, len(routes))
+			for prefix := range routes {
+				prefixes = append(prefixes, prefix)
+			}
+			sort.Strings(prefixes)
+			for _, prefix := range prefixes {
+				for _, s := range routes[prefix] {
+					// paths with AS sets are invalid
+					state := ASPAInvalid
+					if path, ok := parseASPath(s); ok && len(path) > 0 {
+						state = set.Verify(path, p.relation(n, path[0]) == Provider)
+					}
+					count[state]++
+					if state == ASPAInvalid {
+						invalid++
+						fmt.Printf("AS%d %s: %s [%s] is invalid\n", n, r.Hostname, prefix, s)
+					}
+				}
+			}
+		}
+		fmt.Printf("AS%d: %d valid, %d unknown, %d invalid\n",
+			n, count[ASPAValid], count[ASPAUnknown], count[ASPAInvalid])
+	}
+	return invalid
+}
@@ -0,0 +1,228 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Hijack is a prefix of the Victim AS originated by a router of the
+// Attacker AS
+type Hijack struct {
+	Attacker int
+	Router   *Router
+	Victim   int
+	Prefix   net.IPNet
+}
+
+// Leak is the announcement by an AS of the routes learned from From (all the
+// routes if 0) to To
+type Leak struct {
+	ASN  int
+	From int
+	To   int
+}
+
+func (p *Project) parseHijacks(cfgs []config.HijackConfig) {
+	for _, cfg := range cfgs {
+		attacker, ok := p.AS[cfg.ASN]
+		if !ok {
+			utils.Fatalf("Hijack error: AS%d does not exist\n", cfg.ASN)
+		}
+		victim, ok := p.AS[cfg.Victim]
+		if !ok {
+			utils.Fatalf("Hijack error: AS%d does not exist\n", cfg.Victim)
+		}
+		if cfg.ASN == cfg.Victim {
+			utils.Fatalf("Hijack error: AS%d cannot hijack itself\n", cfg.ASN)
+		}
+		if victim.Network.IPNet == nil {
+			utils.Fatalf("Hijack error: AS%d has no prefix\n", cfg.Victim)
+		}
+
+		prefix := *victim.Network.IPNet
+		if cfg.Prefix != "" {
+			_, n, err := net.ParseCIDR(cfg.Prefix)
+			if err != nil {
+				utils.Fatalln("Hijack error:", err)
+			}
+			ones, _ := n.Mask.Size()
+			victimOnes, _ := prefix.Mask.Size()
+			if !prefix.Contains(n.IP) || ones < victimOnes {
+				utils.Fatalf("Hijack error: %s is not in the prefix of AS%d (%s)\n",
+					cfg.Prefix, cfg.Victim, prefix.String())
+			}
+			prefix = *n
+		}
+
+		id := cfg.RouterID
+		if id == 0 {
+			id = 1
+		}
+		r := attacker.getRouter(id)
+		r.Hijacked = append(r.Hijacked, prefix)
+		p.Hijacks = append(p.Hijacks, Hijack{
+			Attacker: cfg.ASN,
+			Router:   r,
+			Victim:   cfg.Victim,
+			Prefix:   prefix,
+		})
+	}
+}
+
+func (p *Project) parseLeaks(cfgs []config.LeakConfig) {
+	for _, cfg := range cfgs {
+		a, ok := p.AS[cfg.ASN]
+		if !ok {
+			utils.Fatalf("Leak error: AS%d does not exist\n", cfg.ASN)
+		}
+		if cfg.To == cfg.ASN || cfg.From == cfg.ASN || cfg.From == cfg.To {
+			utils.Fatalf("Leak error: invalid leak of AS%d (from %d to %d)\n", cfg.ASN, cfg.From, cfg.To)
+		}
+		routers := a.Routers
+		if cfg.RouterID != 0 {
+			routers = []*Router{a.getRouter(cfg.RouterID)}
+		}
+
+		found, fromFound := false, cfg.From == 0
+		for _, r := range a.Routers {
+			for _, nbr := range r.Neighbors {
+				if nbr.RemoteAS == cfg.From {
+					fromFound = true
+				}
+			}
+		}
+		for _, r := range routers {
+			for _, nbr := range r.Neighbors {
+				if nbr.RemoteAS == cfg.To {
+					nbr.LeakFrom = append(nbr.LeakFrom, cfg.From)
+					found = true
+				}
+			}
+		}
+		if !found {
+			utils.Fatalf("Leak error: AS%d has no session with AS%d\n", cfg.ASN, cfg.To)
+		}
+		if !fromFound {
+			utils.Fatalf("Leak error: AS%d has no session with AS%d\n", cfg.ASN, cfg.From)
+		}
+		p.Leaks = append(p.Leaks, Leak{ASN: cfg.ASN, From: cfg.From, To: cfg.To})
+	}
+}
+
+// bestPaths returns the AS path of the best routes of r, indexed by prefix
+func (r *Router) bestPaths() (map[string]string, error) {
+	routes, err := r.Backend().RIB(r)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]string)
+	for _, route := range routes {
+		if route.Best {
+			res[route.Prefix] = route.Path
+		}
+	}
+	return res, nil
+}
+
+// hijacked returns true if the path of a route for the hijacked prefix
+// originates from the attacker
+func (h *Hijack) hijacked(prefix string, path []int) bool {
+	return prefix == h.Prefix.String() && len(path) > 0 && path[len(path)-1] == h.Attacker
+}
+
+// leaked returns true if the path, starting with the AS of the router that
+// selected it, contains the leak
+func (p *Project) leaked(l *Leak, path []int) bool {
+	seq := make([]int, 0, len(path))
+	for _, asn := range path {
+		if len(seq) == 0 || seq[len(seq)-1] != asn {
+			seq = append(seq, asn)
+		}
+	}
+	for i := 1; i < len(seq)-1; i++ {
+		if seq[i-1] != l.To || seq[i] != l.ASN {
+			continue
+		}
+		from := seq[i+1]
+		if l.From == from || (l.From == 0 && p.relation(l.ASN, from) != Customer) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAttacks prints the AS polluted by the hijacks and route leaks of the
+// project, that is the AS with a router selecting a hijacked or leaked route
+func (p *Project) checkAttacks() {
+	if len(p.Hijacks) == 0 && len(p.Leaks) == 0 {
+		return
+	}
+	hijacks := make([]map[int]bool, len(p.Hijacks))
+	leaks := make([]map[int]bool, len(p.Leaks))
+	for i := range hijacks {
+		hijacks[i] = make(map[int]bool)
+	}
+	for i := range leaks {
+		leaks[i] = make(map[int]bool)
+	}
+
+	for n, a := range p.AS {
+		for _, r := range a.Routers {
+			routes, err := r.bestPaths()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			for prefix, s := range routes {
+				path, ok := parseASPath(s)
+				if !ok {
+					continue
+				}
+				for i := range p.Hijacks {
+					if n != p.Hijacks[i].Attacker && p.Hijacks[i].hijacked(prefix, path) {
+						hijacks[i][n] = true
+					}
+				}
+				for i := range p.Leaks {
+					if p.leaked(&p.Leaks[i], append([]int{n}, path...)) {
+						leaks[i][n] = true
+					}
+				}
+			}
+		}
+	}
+
+	for i, h := range p.Hijacks {
+		fmt.Printf("Hijack of %s (AS%d) by AS%d: %s\n",
+			h.Prefix.String(), h.Victim, h.Attacker, pollutedString(hijacks[i]))
+	}
+	for i, l := range p.Leaks {
+		from := "all"
+		if l.From != 0 {
+			from = fmt.Sprintf("AS%d", l.From)
+		}
+		fmt.Printf("Leak by AS%d (%s to AS%d): %s\n", l.ASN, from, l.To, pollutedString(leaks[i]))
+	}
+}
+
+func pollutedString(polluted map[int]bool) string {
+	if len(polluted) == 0 {
+		return "no AS polluted"
+	}
+	asns := make([]int, 0, len(polluted))
+	for n := range polluted {
+		asns = append(asns, n)
+	}
+	sort.Ints(asns)
+	names := make([]string, len(asns))
+	for i, n := range asns {
+		names[i] = fmt.Sprintf("AS%d", n)
+	}
+	return strings.Join(names, ", ") + " polluted"
+}
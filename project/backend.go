@@ -0,0 +1,269 @@
+package project
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Routing daemons of the routers
+const (
+	DaemonFRR   = "frr"
+	DaemonBIRD  = "bird"
+	DaemonGoBGP = "gobgp"
+)
+
+// RouterBackend is the routing daemon running in a router container. It
+// renders the configuration of the router, copied to /etc/frr/frr.conf in
+// the container, and controls the daemon once the links are applied.
+type RouterBackend interface {
+	// Render writes the configuration of a router of the AS
+	Render(dst io.Writer, p *Project, as *AutonomousSystem, r *Router)
+	// Start starts the daemon with the configuration copied in the
+	// container
+	Start(r *Router) error
+	// Reload makes the daemon apply the configuration copied in the
+	// container
+	Reload(r *Router) error
+	// RIB returns the BGP routes of the router, for all the address-families
+	RIB(r *Router) ([]BGPRoute, error)
+	// Sessions returns the state of the BGP sessions of the router, indexed
+	// by neighbor address
+	Sessions(r *Router) (map[string]BGPPeerState, error)
+}
+
+// BGPRoute is a route of the BGP RIB of a router, Path being the AS path
+// as displayed by FRR (confederation segments between parentheses)
+type BGPRoute struct {
+	Prefix   string
+	Path     string
+	Best     bool
+	Valid    bool
+	External bool
+}
+
+// BGPPeerState is the state of a BGP session
+type BGPPeerState struct {
+	RemoteAS int    `json:"remoteAs"`
+	State    string `json:"state"`
+}
+
+var backends = make(map[string]RouterBackend, 3)
+
+// RegisterBackend makes a routing daemon available to the routers
+func RegisterBackend(daemon string, b RouterBackend) {
+	backends[daemon] = b
+}
+
+// Backend returns the backend of the routing daemon of the router
+func (r *Router) Backend() RouterBackend {
+	daemon := r.Daemon
+	if daemon == "" {
+		daemon = DaemonFRR
+	}
+	b, ok := backends[daemon]
+	if !ok {
+		utils.Fatalf("%s: no backend for daemon %s\n", r.ContainerName, daemon)
+	}
+	return b
+}
+
+// parseDaemons sets the routing daemon of the routers of the AS, daemon
+// being the default and routers overriding it for some router IDs
+func (a *AutonomousSystem) parseDaemons(daemon string, routers map[int]string) {
+	check := func(d string) string {
+		switch d = strings.ToLower(d); d {
+		case "", DaemonFRR:
+			return DaemonFRR
+		case DaemonBIRD, DaemonGoBGP:
+			return d
+		default:
+			utils.Fatalf("AS%d: unknown daemon %s\n", a.ASN, d)
+		}
+		return ""
+	}
+	def := check(daemon)
+	for _, r := range a.Routers {
+		r.Daemon = def
+	}
+	for id, d := range routers {
+		a.getRouter(id).Daemon = check(d)
+	}
+	for _, r := range a.Routers {
+		switch r.Daemon {
+		case DaemonBIRD:
+			r.CustomImage = config.DockerBirdImage
+			break
+		case DaemonGoBGP:
+			r.CustomImage = config.DockerGoBGPImage
+			break
+		}
+	}
+}
+
+// checkDaemons warns about the features of the project that are not
+// supported by the daemons of the routers, and ignored in their
+// configuration
+func (p *Project) checkDaemons() {
+	asns := make([]int, 0, len(p.AS))
+	for n := range p.AS {
+		asns = append(asns, n)
+	}
+	sort.Ints(asns)
+
+	for _, n := range asns {
+		a := p.AS[n]
+		for _, r := range a.Routers {
+			if r.Daemon == DaemonFRR {
+				continue
+			}
+			unsupported := make([]string, 0, 4)
+			if r.Daemon == DaemonGoBGP && a.IGPType() != IGPUndef {
+				unsupported = append(unsupported, "IGP")
+			}
+			if r.Daemon == DaemonBIRD && a.IGPType() == IGPISIS {
+				unsupported = append(unsupported, "IS-IS")
+			}
+			if a.MPLS || a.SR.Enabled {
+				unsupported = append(unsupported, "MPLS")
+			}
+			if len(r.VRFNeighbors) > 0 || a.EVPN.Enabled() {
+				unsupported = append(unsupported, "VPNs")
+			}
+			if r.SubAS > 0 {
+				unsupported = append(unsupported, "confederation")
+			}
+			if len(r.BFDPeers) > 0 {
+				unsupported = append(unsupported, "BFD")
+			}
+			if len(a.RPKI.Servers) > 0 {
+				unsupported = append(unsupported, "RPKI")
+			}
+			if len(r.Originated) > 0 && (a.BGP.Originate.HasMED || len(a.BGP.Originate.Communities) > 0) {
+				unsupported = append(unsupported, "originate attributes")
+			}
+			leaks, private := false, false
+			for _, nbr := range r.Neighbors {
+				leaks = leaks || nbr.LeakFrom != nil
+				private = private || nbr.RemovePrivateAS
+			}
+			if leaks {
+				unsupported = append(unsupported, "route leaks")
+			}
+			if private {
+				unsupported = append(unsupported, "remove-private-as")
+			}
+			if len(unsupported) > 0 {
+				utils.PrintError("Warning:", fmt.Sprintf(
+					"AS%d %s: %s not supported by %s, ignored",
+					n, r.Hostname, strings.Join(unsupported, ", "), r.Daemon))
+			}
+		}
+		for _, vpn := range a.VPN {
+			for _, c := range vpn.Customers {
+				if c.Parent.Daemon != DaemonFRR {
+					utils.Fatalf("AS%d %s: VPN customers need a FRR router\n", n, c.Parent.Hostname)
+				}
+			}
+		}
+	}
+}
+
+// WriteBackendConfigs writes the configuration of the routers using another
+// daemon than FRR in the configuration directory
+func (p *Project) WriteBackendConfigs() {
+	genDir := utils.GetDirectoryFromKey("ConfigDir", "")
+	for _, a := range p.AS {
+		for _, r := range a.Routers {
+			if r.Daemon == DaemonFRR {
+				continue
+			}
+			filename := fmt.Sprintf("%s/conf_%d_%s", genDir, a.ASN, r.Hostname)
+			if config.VFlag {
+				fmt.Println("writing", filename)
+			}
+			file, err := os.Create(filename)
+			if err != nil {
+				utils.Fatalln(err)
+			}
+			r.Backend().Render(file, p, a, r)
+			file.Close()
+		}
+	}
+}
+
+// InterfaceAddresses returns the addresses of the loopback and of the links
+// of the router as "<interface> <prefix>", for the daemons that do not
+// configure them
+func (r *Router) InterfaceAddresses() []string {
+	res := make([]string, 0, len(r.Loopback)+len(r.Links))
+	for _, lo := range r.Loopback {
+		res = append(res, "lo "+lo.String())
+	}
+	for _, iface := range r.Links {
+		if iface.IP.IP != nil {
+			res = append(res, iface.IfName+" "+iface.IP.String())
+		}
+	}
+	return res
+}
+
+// Announced returns the prefixes originated in BGP by a router of the AS:
+// the prefix of the AS, the subnets of its hosts outside of it, and the
+// additional and hijacked prefixes of the router
+func (a *AutonomousSystem) Announced(r *Router) []net.IPNet {
+	res := make([]net.IPNet, 0, 2+len(r.Originated)+len(r.Hijacked))
+	if a.Network.IPNet != nil {
+		res = append(res, *a.Network.IPNet)
+	}
+	res = append(res, a.ExtraSubnets(r)...)
+	res = append(res, r.Originated...)
+	return append(res, r.Hijacked...)
+}
+
+// PeerRoute is a route to the address of an eBGP neighbor reached through a
+// link but not on its subnet, Gateway being set for IPv6 neighbors
+type PeerRoute struct {
+	Prefix  string
+	IfName  string
+	Gateway net.IP
+}
+
+// PeerRoutes returns the routes to the eBGP neighbors of the router, as
+// added to the FRR static routes
+func (p *Project) PeerRoutes(as *AutonomousSystem, r *Router) []PeerRoute {
+	ips := make([]string, 0, len(r.Neighbors))
+	for ip := range r.Neighbors {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	res := make([]PeerRoute, 0, len(ips))
+	for _, ip := range ips {
+		nbr := r.Neighbors[ip]
+		// directly connected and multihop sessions do not need a route
+		if nbr.RemoteAS == as.ASN || nbr.ConnCheck || nbr.IfName == "" {
+			continue
+		}
+		route := PeerRoute{
+			Prefix: fmt.Sprintf("%s/%d", ip, nbr.Mask),
+			IfName: nbr.IfName,
+		}
+		for _, lnk := range r.Links {
+			if lnk.IfName == nbr.IfName {
+				remoteLink := p.FindMatchingExtLink(lnk)
+				if remoteLink != nil && remoteLink.IP.IP.To4() == nil {
+					route.Gateway = remoteLink.IP.IP
+				}
+			}
+		}
+		res = append(res, route)
+	}
+	return res
+}
@@ -28,7 +28,10 @@ type Project struct {
 	Ext      []*ExternalLink
 	IXPs     []IXP
 	RPKI     map[string]RPKIServer
+	Hijacks  []Hijack
+	Leaks    []Leak
 	AllLinks ovsdocker.OVSBulk
+	AllVNIs  ovsdocker.VNIBulk
 }
 
 type RPKIServer struct {
@@ -85,6 +88,7 @@ func ReadConfig(path string) *Project {
 			ASN:       k.ASN,
 			IGP:       k.IGP,
 			MPLS:      k.MPLS,
+			MTU:       k.MTU,
 			Routers:   make([]*Router, k.NumRouters),
 			Hosts:     make([]*Host, 0, 4),
 			HostLinks: make([]HostLink, 0, 4),
@@ -98,6 +102,13 @@ func ReadConfig(path string) *Project {
 		a := proj.AS[k.ASN]
 
 		a.BGP.RedistributeIGP = k.BGP.RedistributeIGP
+		a.BGP.MaximumPaths = k.BGP.MaximumPaths
+		a.BGP.MaximumPathsIBGP = k.BGP.MaximumPathsIBGP
+		a.BGP.MultipathRelax = k.BGP.MultipathRelax
+		a.BGP.Session = parseBGPSession(k.BGP.Session, fmt.Sprintf("AS%d", k.ASN))
+		if a.BGP.MaximumPaths < 0 || a.BGP.MaximumPathsIBGP < 0 {
+			utils.Fatalf("AS%d: invalid maximum_paths\n", k.ASN)
+		}
 		a.BGP.Disabled = k.BGP.Disabled
 
 		// Parse network prefix
@@ -176,16 +187,33 @@ func ReadConfig(path string) *Project {
 		}
 
 		// Setup links
+		checkMTU(k.MTU, fmt.Sprintf("AS%d", k.ASN))
+		a.parseBFD(k.BFD)
+		a.parseConfederation(k.BGP.Confederation)
+		a.parseOriginate(k.BGP.Originate)
+		a.parseDaemons(k.Daemon, k.RouterDaemons)
 		a.SetupLinks(k.Links)
 
 		a.ReserveSubnets()
 		if !k.BGP.IBGP.Manual {
-			a.linkRouters(true)
+			a.setupAutoIBGP(k.BGP.IBGP.Mode)
 		} else {
+			if k.BGP.IBGP.Mode != "" {
+				utils.Fatalf("AS%d: iBGP mode cannot be used with manual iBGP\n", k.ASN)
+			}
 			a.linkRouters(false)
 			a.setupIBGP(k.BGP.IBGP)
+			for _, issue := range a.IBGPIssues() {
+				utils.PrintError("Warning:", issue)
+			}
 		}
 
+		/*************************** Segment Routing ***************************/
+		a.parseSR(k.SR)
+
+		/******************************** EVPN ********************************/
+		a.parseEVPN(k.EVPN)
+
 		/*********************** Customer routers setup ***********************/
 		a.VPN = make([]VPN, len(k.VPN))
 		for idx, vpn := range k.VPN {
@@ -202,6 +230,12 @@ func ReadConfig(path string) *Project {
 				if err != nil {
 					utils.Fatalln(err)
 				}
+				// The customer address family is given by its link subnet
+				if n.IP.To4() != nil {
+					a.VPN[idx].IPv4 = true
+				} else {
+					a.VPN[idx].IPv6 = true
+				}
 				n.IP = cidr.Inc(n.IP)
 				router := &Router{
 					ID:            i + 1,
@@ -209,9 +243,12 @@ func ReadConfig(path string) *Project {
 					Links:         make([]*NetInterface, 1),
 					ContainerName: fmt.Sprintf("AS%d-Cust-%s", k.ASN, v.Hostname),
 				}
+				a.VPN[idx].Customers[i].Subnets = make([]net.IPNet, 0, 2)
 				if v.Loopback != "" {
 					if _, n, err := net.ParseCIDR(v.Loopback); err == nil {
 						router.Loopback = append(router.Loopback, *n)
+						a.VPN[idx].Customers[i].Subnets =
+							append(a.VPN[idx].Customers[i].Subnets, *n)
 					}
 				}
 				parentRouter := a.Routers[v.Parent-1]
@@ -226,6 +263,8 @@ func ReadConfig(path string) *Project {
 						utils.Fatalln(err)
 					}
 					a.VPN[idx].SpokeSubnets = append(a.VPN[idx].SpokeSubnets, *rmt)
+					a.VPN[idx].Customers[i].Subnets =
+						append(a.VPN[idx].Customers[i].Subnets, *rmt)
 				}
 
 				a.VPN[idx].Neighbors[parentRouter.LoID()] = true
@@ -245,6 +284,11 @@ func ReadConfig(path string) *Project {
 				router.Links[0] = l.Second.Interface
 				a.Links = append(a.Links, l)
 
+				a.VPN[idx].Customers[i].ASN = v.ASN
+				a.VPN[idx].Customers[i].ASOverride = v.ASOverride
+				a.VPN[idx].Customers[i].AllowASIn = v.AllowASIn
+				a.VPN[idx].Customers[i].setupRouting(a, v.Routing)
+
 				// if it is the hub, we also need to add a downstream link
 				if v.Hub {
 					_, dn, err := net.ParseCIDR(v.SubnetDown)
@@ -273,10 +317,16 @@ func ReadConfig(path string) *Project {
 				}
 			}
 		}
+		a.setupVPNIdentifiers(k.VPN)
 		a.linkVPN()
+		a.setupConfederation()
+
+		/******************************** Hosts *******************************/
+		a.parseHosts(k.Hosts)
 
 		/***************************** RPKI Servers ***************************/
 		a.RPKI.Servers = k.RPKI.Servers
+		a.setRPKIPolicy(k.RPKI.Policy, k.RPKI.Tag)
 	}
 
 	/************************** External links setup **************************/
@@ -290,6 +340,9 @@ func ReadConfig(path string) *Project {
 		}
 	}
 	proj.linkExternal()
+	proj.linkInterASVPN()
+	proj.setupBFD()
+	proj.checkRouteDistinguishers()
 
 	/******************************* IXP setup *******************************/
 	proj.IXPs = make([]IXP, len(conf.IXPs))
@@ -297,9 +350,24 @@ func ReadConfig(path string) *Project {
 		proj.IXPs[i] = proj.parseIXPConfig(ixpCfg)
 		proj.IXPs[i].linkIXP()
 	}
+	for i := range proj.IXPs {
+		proj.IXPs[i].setupFilters(proj)
+	}
+	proj.setupBGPSessions()
+
+	/************************* Hijacks and route leaks ************************/
+	proj.parseHijacks(conf.Hijacks)
+	proj.parseLeaks(conf.Leaks)
 
 	/******************************* RPKI setup *******************************/
 	proj.parseRPKIConfig(conf.RPKI)
+	for i := range proj.IXPs {
+		proj.IXPs[i].checkRPKI(proj.RPKI)
+	}
+	if len(proj.RPKI) > 0 {
+		proj.exportASPA(utils.GetDirectoryFromKey("ConfigDir", "") + "/aspa.json")
+	}
+	proj.checkDaemons()
 	return proj
 }
 
@@ -326,11 +394,17 @@ func (p *Project) Print() {
 				}
 			}
 		}
+		for _, l := range v.HostLinks {
+			fmt.Println("-- Host", l.Host.Host.Hostname, "via", l.Router.Router.Hostname)
+			fmt.Println(l.Host.Interface)
+		}
 	}
 
 	for _, ixp := range p.IXPs {
 		fmt.Println("=> IXP", ixp.ASN)
-		fmt.Println(ixp.RouteServer.Loopback[0])
+		for _, rs := range ixp.RouteServers {
+			fmt.Println(rs.Loopback[0])
+		}
 		for _, l := range ixp.Links {
 			fmt.Println(*l.Interface)
 		}
@@ -343,8 +417,11 @@ func (p *Project) StartAll(linksFlag string) {
 	var wg sync.WaitGroup
 
 	reloadReady := make(chan struct{}) // will be used to trigger a config reload
-	wgTotal := len(p.IXPs)
-	wg.Add(len(p.IXPs))
+	wgTotal := 0
+	for _, ixp := range p.IXPs {
+		wgTotal += len(ixp.RouteServers)
+		wg.Add(len(ixp.RouteServers) + len(ixp.Hosts))
+	}
 	for asn, v := range p.AS {
 		totalContainers := v.TotalContainers()
 		wg.Add(totalContainers + len(v.Hosts))
@@ -361,7 +438,9 @@ func (p *Project) StartAll(linksFlag string) {
 				r.StartContainer(nil, path)
 				wg.Done()
 				<-reloadReady // wait until links are applied
-				r.StartFRR()
+				if err := r.Backend().Start(&r); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
 				wg.Done()
 			}(*v.Routers[i], &wg, configPath)
 		}
@@ -378,7 +457,9 @@ func (p *Project) StartAll(linksFlag string) {
 					r.StartContainer(nil, path)
 					wg.Done()
 					<-reloadReady // wait until links are applied
-					r.StartFRR()
+					if err := r.Backend().Start(&r); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+					}
 					wg.Done()
 				}(*v.VPN[i].Customers[j].Router, &wg, configPath)
 			}
@@ -393,20 +474,30 @@ func (p *Project) StartAll(linksFlag string) {
 		}
 	}
 	// Create containers for IXPs
-	for i := 0; i < len(p.IXPs); i++ {
-		configPath := fmt.Sprintf(
-			"%s/conf_%d_%s",
-			utils.GetDirectoryFromKey("ConfigDir", ""),
-			p.IXPs[i].ASN,
-			p.IXPs[i].RouteServer.Hostname,
-		)
-		go func(r Router, wg *sync.WaitGroup, path string) {
-			r.StartContainer(nil, path)
-			wg.Done()
-			<-reloadReady // wait until links are applied
-			r.StartFRR()
-			wg.Done()
-		}(*p.IXPs[i].RouteServer, &wg, configPath)
+	for _, ixp := range p.IXPs {
+		for _, rs := range ixp.RouteServers {
+			configPath := fmt.Sprintf(
+				"%s/conf_%d_%s",
+				utils.GetDirectoryFromKey("ConfigDir", ""),
+				ixp.ASN,
+				rs.Hostname,
+			)
+			go func(r Router, wg *sync.WaitGroup, path string) {
+				r.StartContainer(nil, path)
+				wg.Done()
+				<-reloadReady // wait until links are applied
+				if err := r.Backend().Start(&r); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				wg.Done()
+			}(*rs, &wg, configPath)
+		}
+		for _, item := range ixp.Hosts {
+			go func(h Host, wg *sync.WaitGroup) {
+				h.StartContainer(nil)
+				wg.Done()
+			}(*item.Host, &wg)
+		}
 	}
 	wg.Wait()
 
@@ -415,11 +506,14 @@ func (p *Project) StartAll(linksFlag string) {
 	}
 
 	p.AllLinks = make(ovsdocker.OVSBulk, 1024)
+	p.AllVNIs = make(ovsdocker.VNIBulk)
 	// currently, internal links must be applied in priority
 	switch strings.ToLower(linksFlag) {
 	case "internal":
 		p.ApplyInternalLinks()
 		p.ApplyHostLinks()
+		p.ApplyLANs()
+		p.ApplyEVPN()
 		break
 	case "external":
 		p.ApplyExternalLinks()
@@ -430,8 +524,10 @@ func (p *Project) StartAll(linksFlag string) {
 	default:
 		p.ApplyInternalLinks()
 		p.ApplyHostLinks()
+		p.ApplyLANs()
 		p.ApplyExternalLinks()
 		p.ApplyIXPLinks()
+		p.ApplyEVPN()
 		break
 	}
 	wg.Add(wgTotal)
@@ -443,7 +539,9 @@ func (p *Project) StartAll(linksFlag string) {
 // StopAll stops all containers and removes all links
 func (p *Project) StopAll() {
 	var wg sync.WaitGroup
-	wg.Add(len(p.IXPs))
+	for _, ixp := range p.IXPs {
+		wg.Add(len(ixp.RouteServers) + len(ixp.Hosts))
+	}
 	for asn, v := range p.AS {
 		wg.Add(v.TotalContainers() + len(v.Hosts))
 		// Provider
@@ -482,18 +580,29 @@ func (p *Project) StopAll() {
 			}(*v.Hosts[i], &wg)
 		}
 	}
-	for i := 0; i < len(p.IXPs); i++ {
-		go func(r Router, wg *sync.WaitGroup, path string) {
-			r.StopContainer(nil, path)
-			wg.Done()
-		}(*p.IXPs[i].RouteServer, &wg, "")
+	for _, ixp := range p.IXPs {
+		for _, rs := range ixp.RouteServers {
+			go func(r Router, wg *sync.WaitGroup, path string) {
+				r.StopContainer(nil, path)
+				wg.Done()
+			}(*rs, &wg, "")
+		}
+		for _, item := range ixp.Hosts {
+			go func(h Host, wg *sync.WaitGroup) {
+				h.StopContainer(nil)
+				wg.Done()
+			}(*item.Host, &wg)
+		}
 	}
 	wg.Wait()
 	p.RemoveInternalLinks()
 	p.RemoveExternalLinks()
 	p.RemoveIXPLinks()
 	p.RemoveHostLinks()
+	p.RemoveLANs()
+	p.RemoveEVPN()
 	os.Remove(utils.GetDirectoryFromKey("MainDir", "") + "/links.json")
+	os.Remove(utils.GetDirectoryFromKey("MainDir", "") + "/vnis.json")
 }
 
 func setupContainerLinks(brName string, links []Link, m ovsdocker.OVSBulk) {
@@ -515,6 +624,7 @@ func setupContainerLinks(brName string, links []Link, m ovsdocker.OVSBulk) {
 		ifB := v.Second.Interface.IfName
 
 		settings.Speed = v.First.Interface.Speed
+		settings.MTU = v.First.Interface.EffectiveMTU()
 		settings.VRF = v.First.Interface.VRF
 
 		link.AddPortToContainer(brName, ifA, idA, settings, hostIf, false)
@@ -526,6 +636,7 @@ func setupContainerLinks(brName string, links []Link, m ovsdocker.OVSBulk) {
 		settings.OFPort++
 
 		settings.Speed = v.Second.Interface.Speed
+		settings.MTU = v.Second.Interface.EffectiveMTU()
 		settings.VRF = v.Second.Interface.VRF
 		link.AddPortToContainer(brName, ifB, idB, settings, hostIf, false)
 		// res = append(res, *hostIf)
@@ -573,22 +684,45 @@ func (p *Project) RemoveInternalLinks() {
 	}
 }
 
+// allExternalLinks returns the external links of the project, including the
+// per-VRF links created for inter-AS VPNs
+func (p *Project) allExternalLinks() []*ExternalLink {
+	res := make([]*ExternalLink, 0, len(p.Ext))
+	for _, v := range p.Ext {
+		res = append(res, v)
+		if v.VPN != nil {
+			res = append(res, v.VPN.Links...)
+		}
+	}
+	return res
+}
+
+func (e *ExternalLink) bridgeName() string {
+	brName := fmt.Sprintf("ext-%d%s-%d%s",
+		e.From.ASN,
+		e.From.Router.Hostname,
+		e.To.ASN,
+		e.To.Router.Hostname,
+	)
+	if e.From.Interface.VRF != "" {
+		brName += "-" + e.From.Interface.VRF
+	}
+	return brName
+}
+
 // ApplyExternalLinks creates all external links between the different AS
 func (p *Project) ApplyExternalLinks() {
-	for _, v := range p.Ext {
+	for _, v := range p.allExternalLinks() {
 
-		brName := fmt.Sprintf("ext-%d%s-%d%s",
-			v.From.ASN,
-			v.From.Router.Hostname,
-			v.To.ASN,
-			v.To.Router.Hostname,
-		)
+		brName := v.bridgeName()
 
 		link.CreateBridge(brName)
 		settings := ovsdocker.DefaultParams()
 		hostIf := ovsdocker.OVSInterface{}
 
 		settings.Speed = v.From.Interface.Speed
+		settings.MTU = v.From.Interface.EffectiveMTU()
+		settings.VRF = v.From.Interface.VRF
 		link.AddPortToContainer(brName, v.From.Interface.IfName, v.From.Router.ContainerName, settings, &hostIf, true)
 		if _, ok := p.AllLinks[v.From.Router.ContainerName]; !ok {
 			p.AllLinks[v.From.Router.ContainerName] = make([]ovsdocker.OVSInterface, 0, len(p.Ext))
@@ -596,6 +730,8 @@ func (p *Project) ApplyExternalLinks() {
 		p.AllLinks[v.From.Router.ContainerName] = append(p.AllLinks[v.From.Router.ContainerName], hostIf)
 
 		settings.Speed = v.To.Interface.Speed
+		settings.MTU = v.To.Interface.EffectiveMTU()
+		settings.VRF = v.To.Interface.VRF
 		link.AddPortToContainer(brName, v.To.Interface.IfName, v.To.Router.ContainerName, settings, &hostIf, true)
 
 		if _, ok := p.AllLinks[v.To.Router.ContainerName]; !ok {
@@ -607,15 +743,8 @@ func (p *Project) ApplyExternalLinks() {
 
 // RemoveExternalLinks removes all external links
 func (p *Project) RemoveExternalLinks() {
-	for _, v := range p.Ext {
-		brName := fmt.Sprintf("ext-%d%s-%d%s",
-			v.From.ASN,
-			v.From.Router.Hostname,
-			v.To.ASN,
-			v.To.Router.Hostname,
-		)
-
-		link.DeleteBridge(brName)
+	for _, v := range p.allExternalLinks() {
+		link.DeleteBridge(v.bridgeName())
 	}
 }
 
@@ -635,9 +764,14 @@ func (p *Project) ApplyHostLinks() {
 			p.AllLinks[v.Router.Router.ContainerName] = append(p.AllLinks[v.Router.Router.ContainerName], hostIf)
 
 			settings.Speed = v.Host.Interface.Speed
+			settings.Host = true
 			settings.IP = v.Host.Interface.IP.String()
+			defaultRoute := "0.0.0.0/0"
+			if v.Host.Interface.IP.IP.To4() == nil {
+				defaultRoute = "::/0"
+			}
 			settings.Routes = []ovsdocker.IPRoute{{
-				IP:     "0.0.0.0/0",
+				IP:     defaultRoute,
 				Via:    v.Router.Interface.IP.IP.String(),
 				IfName: v.Host.Interface.IfName,
 			}}
@@ -777,4 +911,16 @@ func (p *Project) saveLinks() {
 	}
 	defer f2.Close()
 	f2.Write(j)
+
+	// The VXLAN devices are not OVS ports, save them separately
+	j, err = json.Marshal(p.AllVNIs)
+	if err != nil {
+		utils.Fatalln(err)
+	}
+	f3, err := os.Create(utils.GetDirectoryFromKey("MainDir", "") + "/vnis.json")
+	if err != nil {
+		utils.Fatalln(err)
+	}
+	defer f3.Close()
+	f3.Write(j)
 }
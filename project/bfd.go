@@ -0,0 +1,190 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+const (
+	defaultBFDInterval   = 300
+	defaultBFDMultiplier = 3
+)
+
+// BFD is a BFD profile, intervals are in milliseconds
+type BFD struct {
+	Profile    string
+	RxInterval int
+	TxInterval int
+	Multiplier int
+	Echo       bool
+}
+
+// BFDPeer is a BFD session configured on a router. Multihop sessions are
+// sourced from Local, others are bound to IfName.
+type BFDPeer struct {
+	IP       string
+	Local    string
+	IfName   string
+	Multihop bool
+	Profile  string
+}
+
+func (a *AutonomousSystem) parseBFD(cfg config.BFDConfig) {
+	a.BFD = &BFD{
+		Profile:    fmt.Sprintf("AS%d", a.ASN),
+		RxInterval: cfg.RxInterval,
+		TxInterval: cfg.TxInterval,
+		Multiplier: cfg.Multiplier,
+		Echo:       cfg.Echo,
+	}
+	a.BFDEnabled = cfg.Enabled
+	if a.BFD.RxInterval == 0 {
+		a.BFD.RxInterval = defaultBFDInterval
+	}
+	if a.BFD.TxInterval == 0 {
+		a.BFD.TxInterval = defaultBFDInterval
+	}
+	if a.BFD.Multiplier == 0 {
+		a.BFD.Multiplier = defaultBFDMultiplier
+	}
+	for _, v := range []int{a.BFD.RxInterval, a.BFD.TxInterval} {
+		if v < 10 || v > 60000 {
+			utils.Fatalf("AS%d: invalid BFD interval %d (must be between 10 and 60000 ms)\n", a.ASN, v)
+		}
+	}
+	if a.BFD.Multiplier < 2 || a.BFD.Multiplier > 255 {
+		utils.Fatalf("AS%d: invalid BFD multiplier %d\n", a.ASN, a.BFD.Multiplier)
+	}
+}
+
+// useBFD registers the profile b on r, and returns its name
+func (r *Router) useBFD(b *BFD) string {
+	if r.BFDProfiles == nil {
+		r.BFDProfiles = make(map[string]*BFD, 1)
+	}
+	r.BFDProfiles[b.Profile] = b
+	return b.Profile
+}
+
+// setLinksBFD enables BFD on the internal interfaces of the AS, unless
+// disabled on the link
+func (a *AutonomousSystem) setLinksBFD() {
+	if !a.BFDEnabled {
+		return
+	}
+	items := make([]*LinkItem, 0, 2*len(a.Links))
+	for _, lnk := range a.Links {
+		items = append(items, lnk.First, lnk.Second)
+	}
+	for _, lan := range a.LANs {
+		items = append(items, lan.Routers...)
+	}
+	for _, item := range items {
+		if item.Interface.IGP.BFD == "" && !item.Interface.IGP.noBFD {
+			item.Interface.IGP.BFD = item.Router.useBFD(a.BFD)
+		}
+	}
+}
+
+// addBFDPeer adds a BFD session from r to ip. The session is single hop if
+// ip is in the subnet of one of the interfaces of r.
+func (r *Router) addBFDPeer(ip, profile string) {
+	for _, p := range r.BFDPeers {
+		if p.IP == ip {
+			return
+		}
+	}
+	peer := BFDPeer{
+		IP:       ip,
+		Profile:  profile,
+		Multihop: true,
+		Local:    r.LoID(),
+	}
+	for _, iface := range r.Links {
+		if iface.VRF == "" && iface.IP.Contains(net.ParseIP(ip)) {
+			peer.Multihop = false
+			peer.Local = ""
+			peer.IfName = iface.IfName
+			break
+		}
+	}
+	r.BFDPeers = append(r.BFDPeers, peer)
+}
+
+// setupBFD creates the BFD sessions of the IGP adjacencies and of the BGP
+// sessions. eBGP sessions use BFD if enabled on the external link, or in
+// both AS.
+func (p *Project) setupBFD() {
+	for _, a := range p.AS {
+		for _, lnk := range a.Links {
+			for _, e := range [][2]*LinkItem{{lnk.First, lnk.Second}, {lnk.Second, lnk.First}} {
+				local, remote := e[0], e[1]
+				if local.Interface.IGP.BFD != "" && len(remote.Interface.IP.IP) > 0 {
+					local.Router.addBFDPeer(remote.Interface.IP.IP.String(), local.Interface.IGP.BFD)
+				}
+			}
+		}
+		if !a.BFDEnabled {
+			continue
+		}
+		for _, r := range a.Routers {
+			for ip, nbr := range r.Neighbors {
+				if nbr.RemoteAS == a.ASN {
+					nbr.BFD = r.useBFD(a.BFD)
+					r.addBFDPeer(ip, nbr.BFD)
+				}
+			}
+		}
+	}
+
+	for _, lnk := range p.allExternalLinks() {
+		from, to := p.AS[lnk.From.ASN], p.AS[lnk.To.ASN]
+		if !lnk.BFD && !(from.BFDEnabled && to.BFDEnabled) {
+			continue
+		}
+		for _, e := range []struct {
+			local, remote *ExternalLinkItem
+			as            *AutonomousSystem
+		}{
+			{lnk.From, lnk.To, from},
+			{lnk.To, lnk.From, to},
+		} {
+			for ip, nbr := range e.local.Router.Neighbors {
+				if nbr.RemoteAS != e.remote.ASN || !e.remote.Router.hasAddress(ip) {
+					continue
+				}
+				nbr.BFD = e.local.Router.useBFD(e.as.BFD)
+				e.local.Router.addBFDPeer(ip, nbr.BFD)
+			}
+		}
+	}
+
+	// Keep a stable order in the generated configurations
+	for _, a := range p.AS {
+		for _, r := range a.Routers {
+			sort.Slice(r.BFDPeers, func(i, j int) bool {
+				return r.BFDPeers[i].IP < r.BFDPeers[j].IP
+			})
+		}
+	}
+}
+
+// hasAddress returns true if ip is one of the loopback or interface
+// addresses of r
+func (r *Router) hasAddress(ip string) bool {
+	for _, lo := range r.Loopback {
+		if lo.IP.String() == ip {
+			return true
+		}
+	}
+	for _, iface := range r.Links {
+		if iface.IP.IP.String() == ip {
+			return true
+		}
+	}
+	return false
+}
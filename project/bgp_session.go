@@ -0,0 +1,270 @@
+package project
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// BGPSession contains optional BGP session settings, zero values keeping the
+// FRR defaults
+type BGPSession struct {
+	Keepalive       int
+	Hold            int
+	MaxPrefix       int
+	EBGPMultihop    int
+	Password        string
+	LocalAS         int
+	AllowASIn       int
+	RemovePrivateAS bool
+	SendCommunity   string
+}
+
+func parseBGPSession(cfg config.BGPSessionConfig, where string) BGPSession {
+	s := BGPSession{
+		Keepalive:       cfg.Keepalive,
+		Hold:            cfg.Hold,
+		MaxPrefix:       cfg.MaximumPrefix,
+		EBGPMultihop:    cfg.EBGPMultihop,
+		Password:        cfg.Password,
+		LocalAS:         cfg.LocalAS,
+		AllowASIn:       cfg.AllowASIn,
+		RemovePrivateAS: cfg.RemovePrivateAS,
+		SendCommunity:   strings.ToLower(cfg.SendCommunity),
+	}
+	if (s.Keepalive > 0) != (s.Hold > 0) {
+		utils.Fatalf("%s: BGP keepalive and hold timers must be set together\n", where)
+	}
+	if s.Hold > 0 && (s.Hold < 3 || s.Keepalive > s.Hold || s.Hold > 65535) {
+		utils.Fatalf("%s: invalid BGP timers %d %d\n", where, s.Keepalive, s.Hold)
+	}
+	if s.EBGPMultihop < 0 || s.EBGPMultihop > 255 {
+		utils.Fatalf("%s: invalid ebgp_multihop %d\n", where, s.EBGPMultihop)
+	}
+	if s.AllowASIn < 0 || s.AllowASIn > 10 {
+		utils.Fatalf("%s: invalid allowas_in %d (must be between 1 and 10)\n", where, s.AllowASIn)
+	}
+	if s.MaxPrefix < 0 || s.LocalAS < 0 {
+		utils.Fatalf("%s: invalid BGP session settings\n", where)
+	}
+	switch s.SendCommunity {
+	case "", "standard", "extended", "large", "all", "none":
+	default:
+		utils.Fatalf("%s: invalid send_community %s\n", where, cfg.SendCommunity)
+	}
+	return s
+}
+
+// merge overrides the settings of s by the ones set in o
+func (s *BGPSession) merge(o BGPSession) {
+	if o.Hold > 0 {
+		s.Keepalive, s.Hold = o.Keepalive, o.Hold
+	}
+	if o.MaxPrefix > 0 {
+		s.MaxPrefix = o.MaxPrefix
+	}
+	if o.EBGPMultihop > 0 {
+		s.EBGPMultihop = o.EBGPMultihop
+	}
+	if o.Password != "" {
+		s.Password = o.Password
+	}
+	if o.LocalAS > 0 {
+		s.LocalAS = o.LocalAS
+	}
+	if o.AllowASIn > 0 {
+		s.AllowASIn = o.AllowASIn
+	}
+	s.RemovePrivateAS = s.RemovePrivateAS || o.RemovePrivateAS
+	if o.SendCommunity != "" {
+		s.SendCommunity = o.SendCommunity
+	}
+}
+
+// applySession sets the session settings on the neighbor. Settings only
+// relevant to eBGP are ignored for iBGP sessions.
+func (nbr *BGPNbr) applySession(s BGPSession, ebgp bool) {
+	if s.Hold > 0 {
+		nbr.Keepalive, nbr.Hold = s.Keepalive, s.Hold
+	}
+	if s.MaxPrefix > 0 {
+		nbr.MaxPrefix = s.MaxPrefix
+	}
+	if s.Password != "" {
+		nbr.Password = s.Password
+	}
+	if s.SendCommunity != "" {
+		nbr.SendCommunity = s.SendCommunity
+	}
+	if !ebgp {
+		return
+	}
+	if s.EBGPMultihop > 0 {
+		nbr.EBGPMultihop = s.EBGPMultihop
+	}
+	if s.LocalAS > 0 {
+		nbr.LocalAS = s.LocalAS
+	}
+	if s.AllowASIn > 0 {
+		nbr.AllowASIn = s.AllowASIn
+	}
+	nbr.RemovePrivateAS = nbr.RemovePrivateAS || s.RemovePrivateAS
+}
+
+// neighborsOf returns the BGP sessions of r with the remote router in AS asn
+func (r *Router) neighborsOf(remote *Router, asn int) map[string]*BGPNbr {
+	res := make(map[string]*BGPNbr, 1)
+	for ip, nbr := range r.Neighbors {
+		if nbr.RemoteAS == asn && remote.hasAddress(ip) {
+			res[ip] = nbr
+		}
+	}
+	return res
+}
+
+// ebgpEnd is one end of an eBGP session: the settings of the local router
+// and its neighbors pointing to the remote router
+type ebgpEnd struct {
+	asn     int
+	session BGPSession
+	nbrs    map[string]*BGPNbr
+}
+
+// setupEBGPSession applies the settings of both ends of an eBGP session. The
+// settings that must match (password and timers) are copied to the other end
+// if only set on one of them, and the remote end peers with the local_as of
+// the local end.
+func setupEBGPSession(where string, ends [2]ebgpEnd) {
+	if p0, p1 := ends[0].session.Password, ends[1].session.Password; p0 != "" && p1 != "" && p0 != p1 {
+		utils.Fatalf("%s: BGP passwords of both ends differ\n", where)
+	}
+	for j, e := range ends {
+		other := ends[1-j].session
+		s := e.session
+		if s.Password == "" {
+			s.Password = other.Password
+		}
+		if s.Hold == 0 {
+			s.Keepalive, s.Hold = other.Keepalive, other.Hold
+		}
+		for _, nbr := range e.nbrs {
+			nbr.applySession(s, true)
+		}
+		if s.LocalAS == 0 {
+			continue
+		}
+		if s.LocalAS == e.asn {
+			utils.Fatalf("%s: local_as must differ from AS%d\n", where, e.asn)
+		}
+		// the remote router peers with the replacement AS
+		for _, nbr := range ends[1-j].nbrs {
+			nbr.RemoteAS = s.LocalAS
+		}
+	}
+}
+
+// vrfNeighbor returns the VRF session of an inter-AS option A link end with
+// the remote end
+func (e *ExternalLinkItem) vrfNeighbor(remote *ExternalLinkItem) map[string]*BGPNbr {
+	ip := remote.Interface.IP.IP.String()
+	return map[string]*BGPNbr{ip: e.Router.VRFNeighbors[e.Interface.VRF][ip]}
+}
+
+// setupBGPSessions applies the session settings of the AS, of the external
+// links and of the IXP peers to the BGP neighbors, the most specific ones
+// last. The local_as and password of the AS are only applied to the eBGP
+// sessions over external links and IXPs, where the remote end can be
+// configured accordingly.
+func (p *Project) setupBGPSessions() {
+	for _, a := range p.AS {
+		ebgpSession := a.BGP.Session
+		ebgpSession.LocalAS, ebgpSession.Password = 0, ""
+		for _, r := range a.Routers {
+			for _, nbr := range r.Neighbors {
+				if nbr.RemoteAS == a.ASN {
+					nbr.applySession(a.BGP.Session, false)
+				} else {
+					nbr.applySession(ebgpSession, true)
+				}
+			}
+		}
+	}
+
+	// session settings of an end of an eBGP session, from the least specific
+	// to the most specific
+	endSession := func(asn int, sessions ...BGPSession) BGPSession {
+		s := p.AS[asn].BGP.Session
+		for _, o := range sessions {
+			s.merge(o)
+		}
+		return s
+	}
+
+	for i, lnk := range p.Ext {
+		where := fmt.Sprintf("External link %d", i+1)
+		fromSession := endSession(lnk.From.ASN, lnk.Session, lnk.From.Session)
+		toSession := endSession(lnk.To.ASN, lnk.Session, lnk.To.Session)
+		setupEBGPSession(where, [2]ebgpEnd{
+			{asn: lnk.From.ASN, session: fromSession, nbrs: lnk.From.Router.neighborsOf(lnk.To.Router, lnk.To.ASN)},
+			{asn: lnk.To.ASN, session: toSession, nbrs: lnk.To.Router.neighborsOf(lnk.From.Router, lnk.From.ASN)},
+		})
+		if lnk.VPN == nil {
+			continue
+		}
+		// back-to-back VRF sessions of inter-AS option A
+		for _, l := range lnk.VPN.Links {
+			setupEBGPSession(where, [2]ebgpEnd{
+				{asn: l.From.ASN, session: fromSession, nbrs: l.From.vrfNeighbor(l.To)},
+				{asn: l.To.ASN, session: toSession, nbrs: l.To.vrfNeighbor(l.From)},
+			})
+		}
+	}
+
+	for i := range p.IXPs {
+		ixp := &p.IXPs[i]
+		for j, rs := range ixp.RouteServers {
+			rsIP := ixp.Links[j].Interface.IP.IP.String()
+			for _, lnk := range ixp.Members() {
+				ixp.applyIXPSession(lnk,
+					endSession(lnk.ASN, lnk.Session),
+					lnk.Router.Neighbors[rsIP],
+					rs.Neighbors[lnk.Interface.IP.IP.String()])
+			}
+		}
+		for _, b := range ixp.Bilateral {
+			fromIP, toIP := b.From.Interface.IP.IP.String(), b.To.Interface.IP.IP.String()
+			setupEBGPSession(fmt.Sprintf("IXP %d: bilateral session AS%d-AS%d", ixp.ASN, b.From.ASN, b.To.ASN), [2]ebgpEnd{
+				{
+					asn:     b.From.ASN,
+					session: endSession(b.From.ASN, b.From.Session),
+					nbrs:    map[string]*BGPNbr{toIP: b.From.Router.Neighbors[toIP]},
+				},
+				{
+					asn:     b.To.ASN,
+					session: endSession(b.To.ASN, b.To.Session),
+					nbrs:    map[string]*BGPNbr{fromIP: b.To.Router.Neighbors[fromIP]},
+				},
+			})
+		}
+	}
+}
+
+// applyIXPSession applies the settings s of an IXP peer on its session with
+// the route server, and on the route server side for the settings that must
+// match (timers and password)
+func (ixp *IXP) applyIXPSession(lnk *ExternalLinkItem, s BGPSession, peer, rs *BGPNbr) {
+	peer.applySession(s, true)
+	rs.applySession(BGPSession{
+		Keepalive: s.Keepalive,
+		Hold:      s.Hold,
+		Password:  s.Password,
+	}, true)
+	if s.LocalAS > 0 {
+		if s.LocalAS == lnk.ASN {
+			utils.Fatalf("IXP %d: local_as must differ from AS%d\n", ixp.ASN, lnk.ASN)
+		}
+		rs.RemoteAS = s.LocalAS
+	}
+}
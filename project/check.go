@@ -0,0 +1,78 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+type bfdPeerState struct {
+	Peer      string `json:"peer"`
+	Interface string `json:"interface"`
+	Multihop  bool   `json:"multihop"`
+	Status    string `json:"status"`
+}
+
+// VtyshJSON runs a FRR show command in the router container and decodes its
+// JSON output in v
+func (r *Router) VtyshJSON(command string, v interface{}) error {
+	out, err := exec.Command(
+		"docker", "exec", r.ContainerName,
+		"vtysh", "-c", command+" json",
+	).Output()
+	if err != nil {
+		return fmt.Errorf("%s: %v", r.ContainerName, err)
+	}
+	return json.Unmarshal(out, v)
+}
+
+// Check prints the state of the BGP and BFD sessions of all the routers of
+// the project, and the AS polluted by the hijacks and route leaks
+func (p *Project) Check() {
+	asns := make([]int, 0, len(p.AS))
+	for n := range p.AS {
+		asns = append(asns, n)
+	}
+	sort.Ints(asns)
+
+	for _, n := range asns {
+		for _, r := range p.AS[n].Routers {
+			fmt.Printf("AS%d %s\n", n, r.Hostname)
+
+			peers, err := r.Backend().Sessions(r)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, " BGP:", err)
+			}
+			ips := make([]string, 0, len(peers))
+			for ip := range peers {
+				ips = append(ips, ip)
+			}
+			sort.Strings(ips)
+			for _, ip := range ips {
+				fmt.Printf(" BGP %-20s AS%-8d %s\n", ip, peers[ip].RemoteAS, peers[ip].State)
+			}
+
+			if len(r.BFDPeers) == 0 || r.Daemon != DaemonFRR {
+				continue
+			}
+			var bfd []bfdPeerState
+			if err := r.VtyshJSON("show bfd peers", &bfd); err != nil {
+				fmt.Fprintln(os.Stderr, " BFD:", err)
+				continue
+			}
+			sort.Slice(bfd, func(i, j int) bool { return bfd[i].Peer < bfd[j].Peer })
+			for _, peer := range bfd {
+				kind := peer.Interface
+				if peer.Multihop {
+					kind = "multihop"
+				}
+				fmt.Printf(" BFD %-20s %-8s %s\n", peer.Peer, kind, strings.ToLower(peer.Status))
+			}
+		}
+	}
+
+	p.checkAttacks()
+}
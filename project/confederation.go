@@ -0,0 +1,93 @@
+package project
+
+import (
+	"sort"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// parseConfederation assigns each router of the AS to its confederation
+// member. Every router must belong to exactly one member.
+func (a *AutonomousSystem) parseConfederation(cfg *config.ConfederationConfig) {
+	if cfg == nil {
+		return
+	}
+	if cfg.ID != 0 && cfg.ID != a.ASN {
+		utils.Fatalf("AS%d: confederation identifier must be the AS number (got %d)\n", a.ASN, cfg.ID)
+	}
+	if len(cfg.Members) < 2 {
+		utils.Fatalf("AS%d: a confederation needs at least two members\n", a.ASN)
+	}
+
+	members := make([]int, 0, len(cfg.Members))
+	for subAS, routers := range cfg.Members {
+		if subAS <= 0 || subAS == a.ASN {
+			utils.Fatalf("AS%d: invalid confederation member %d\n", a.ASN, subAS)
+		}
+		if len(routers) == 0 {
+			utils.Fatalf("AS%d: confederation member %d has no router\n", a.ASN, subAS)
+		}
+		for _, id := range routers {
+			r := a.getRouter(id)
+			if r.SubAS != 0 {
+				utils.Fatalf("AS%d: %s is in confederation members %d and %d\n",
+					a.ASN, r.Hostname, r.SubAS, subAS)
+			}
+			r.SubAS = subAS
+		}
+		members = append(members, subAS)
+	}
+	for _, r := range a.Routers {
+		if r.SubAS == 0 {
+			utils.Fatalf("AS%d: %s is not in a confederation member\n", a.ASN, r.Hostname)
+		}
+	}
+	sort.Ints(members)
+	a.BGP.Confederation = members
+}
+
+// setupConfederation turns the iBGP sessions between routers of different
+// confederation members into confederation eBGP sessions
+func (a *AutonomousSystem) setupConfederation() {
+	if len(a.BGP.Confederation) == 0 {
+		return
+	}
+	for _, r := range a.Routers {
+		for ip, nbr := range r.Neighbors {
+			if nbr.RemoteAS != a.ASN {
+				continue
+			}
+			var peer *Router
+			for _, n := range a.Routers {
+				if n.hasAddress(ip) {
+					peer = n
+					break
+				}
+			}
+			if peer == nil || peer.SubAS == r.SubAS {
+				continue
+			}
+			if nbr.RRClient {
+				utils.Fatalf("AS%d: %s cannot be a route reflector client of %s (different confederation members)\n",
+					a.ASN, peer.Hostname, r.Hostname)
+			}
+			nbr.ConfedAS = peer.SubAS
+			// confederation eBGP sessions use a TTL of 1 by default
+			if nbr.UpdateSource != "" && nbr.EBGPMultihop == 0 {
+				nbr.EBGPMultihop = 255
+			}
+		}
+	}
+}
+
+// ConfederationPeers returns the other members of the confederation of r
+func (a *AutonomousSystem) ConfederationPeers(r *Router) []int {
+	res := make([]int, 0, len(a.BGP.Confederation))
+	for _, m := range a.BGP.Confederation {
+		if m != r.SubAS {
+			res = append(res, m)
+		}
+	}
+	return res
+}
@@ -0,0 +1,358 @@
+package project
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/internal/link"
+	"github.com/rahveiz/topomate/internal/ovsdocker"
+	"github.com/rahveiz/topomate/utils"
+)
+
+const maxVNI = 1<<24 - 1
+
+// EVPNPort is a host-facing interface of a VTEP bridged in a L2VNI, and the
+// hosts attached to it
+type EVPNPort struct {
+	Router    *Router
+	Interface *NetInterface
+	Hosts     []*HostLinkItem
+	// Default gateway of the hosts
+	Gateway net.IP
+}
+
+// L2VNI represents a layer 2 segment stretched over the VXLAN overlay.
+// If Gateway is set, every VTEP of the segment routes it (distributed
+// anycast gateway), in VRF if specified.
+type L2VNI struct {
+	VNI     int
+	VRF     string
+	Gateway net.IPNet
+	Ports   []EVPNPort
+}
+
+// L3VNI represents the VNI used to route between the VTEPs of a VRF
+type L3VNI struct {
+	VNI   int
+	VRF   string
+	VTEPs []*Router
+}
+
+// EVPN contains the VXLAN overlay settings of an AS
+type EVPN struct {
+	L2VNIs []L2VNI
+	L3VNIs []L3VNI
+}
+
+// Enabled returns true if the AS has at least one VNI
+func (e *EVPN) Enabled() bool {
+	return len(e.L2VNIs) > 0 || len(e.L3VNIs) > 0
+}
+
+// IsVTEP returns true if r terminates at least one VNI
+func (e *EVPN) IsVTEP(r *Router) bool {
+	return len(e.L2VNIsFor(r)) > 0 || len(e.L3VNIsFor(r)) > 0
+}
+
+// L2VNIsFor returns the L2VNIs r is a VTEP of, with the ports of r only
+func (e *EVPN) L2VNIsFor(r *Router) []L2VNI {
+	res := make([]L2VNI, 0, len(e.L2VNIs))
+	for _, vni := range e.L2VNIs {
+		for _, port := range vni.Ports {
+			if port.Router == r {
+				vni.Ports = []EVPNPort{port}
+				res = append(res, vni)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// L3VNIsFor returns the L3VNIs r is a VTEP of
+func (e *EVPN) L3VNIsFor(r *Router) []L3VNI {
+	res := make([]L3VNI, 0, len(e.L3VNIs))
+	for _, vni := range e.L3VNIs {
+		for _, vtep := range vni.VTEPs {
+			if vtep == r {
+				res = append(res, vni)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// GatewayMAC returns the anycast gateway MAC address of a L2VNI, shared by
+// all its VTEPs
+func (vni *L2VNI) GatewayMAC() string {
+	return fmt.Sprintf("02:00:00:%02x:%02x:%02x",
+		(vni.VNI>>16)&0xff, (vni.VNI>>8)&0xff, vni.VNI&0xff)
+}
+
+func (a *AutonomousSystem) checkVNI(vni int, used map[int]bool) {
+	if vni < 1 || vni > maxVNI {
+		utils.Fatalf("AS%d: invalid VNI %d\n", a.ASN, vni)
+	}
+	if used[vni] {
+		utils.Fatalf("AS%d: VNI %d is used twice\n", a.ASN, vni)
+	}
+	used[vni] = true
+}
+
+func (a *AutonomousSystem) parseEVPN(cfg config.EVPNConfig) {
+	if len(cfg.L2VNIs) == 0 && len(cfg.L3VNIs) == 0 {
+		return
+	}
+	if a.BGP.Disabled {
+		utils.Fatalf("AS%d: EVPN requires BGP\n", a.ASN)
+	}
+
+	used := make(map[int]bool, len(cfg.L2VNIs)+len(cfg.L3VNIs))
+	vteps := make(map[*Router]bool, len(a.Routers))
+
+	a.EVPN.L2VNIs = make([]L2VNI, len(cfg.L2VNIs))
+	for i, v := range cfg.L2VNIs {
+		a.checkVNI(v.VNI, used)
+		if len(v.Routers) == 0 {
+			utils.Fatalf("AS%d: L2VNI %d has no router\n", a.ASN, v.VNI)
+		}
+		vni := L2VNI{
+			VNI:   v.VNI,
+			VRF:   v.VRF,
+			Ports: make([]EVPNPort, len(v.Routers)),
+		}
+		if v.Gateway != "" {
+			ip, n, err := net.ParseCIDR(v.Gateway)
+			if err != nil {
+				utils.Fatalln(err)
+			}
+			vni.Gateway = net.IPNet{IP: ip, Mask: n.Mask}
+		}
+
+		// each VTEP gets a new host-facing interface bridged in the segment
+		for j, name := range v.Routers {
+			r := a.getRouterByName(name)
+			vni.Ports[j] = EVPNPort{
+				Router: r,
+				Interface: &NetInterface{
+					IfName:      fmt.Sprintf("eth%d", r.NextInterface),
+					Description: fmt.Sprintf("access port (VNI %d)", v.VNI),
+					Speed:       10000,
+					External:    true,
+				},
+			}
+			r.NextInterface++
+			vteps[r] = true
+		}
+		a.EVPN.L2VNIs[i] = vni
+	}
+
+	a.EVPN.L3VNIs = make([]L3VNI, len(cfg.L3VNIs))
+	for i, v := range cfg.L3VNIs {
+		a.checkVNI(v.VNI, used)
+		if v.VRF == "" {
+			utils.Fatalf("AS%d: L3VNI %d needs a VRF\n", a.ASN, v.VNI)
+		}
+		vni := L3VNI{
+			VNI: v.VNI,
+			VRF: v.VRF,
+		}
+		for _, l3 := range a.EVPN.L3VNIs[:i] {
+			if l3.VRF == v.VRF {
+				utils.Fatalf("AS%d: VRF %s has several L3VNIs\n", a.ASN, v.VRF)
+			}
+		}
+
+		if len(v.Routers) > 0 {
+			vni.VTEPs = make([]*Router, len(v.Routers))
+			for j, name := range v.Routers {
+				vni.VTEPs[j] = a.getRouterByName(name)
+			}
+		} else {
+			// By default, use the VTEPs having a L2VNI in this VRF
+			for _, l2 := range a.EVPN.L2VNIs {
+				if l2.VRF != v.VRF {
+					continue
+				}
+				for _, port := range l2.Ports {
+					vni.VTEPs = append(vni.VTEPs, port.Router)
+				}
+			}
+		}
+		if len(vni.VTEPs) == 0 {
+			utils.Fatalf("AS%d: L3VNI %d has no VTEP\n", a.ASN, v.VNI)
+		}
+		for _, r := range vni.VTEPs {
+			vteps[r] = true
+		}
+		a.EVPN.L3VNIs[i] = vni
+	}
+
+	for r := range vteps {
+		if r.LoID() == "" {
+			utils.Fatalf("AS%d: VTEP %s needs a loopback\n", a.ASN, r.Hostname)
+		}
+	}
+
+	// Exchange EVPN routes on all iBGP sessions (including route reflectors)
+	for _, r := range a.Routers {
+		for _, nbr := range r.Neighbors {
+			if nbr.RemoteAS == a.ASN {
+				nbr.AF.EVPN = true
+			}
+		}
+	}
+}
+
+// attachToVNI adds a host to the access segment of a L2VNI on its router.
+// The hosts use the anycast gateway of the VNI if it has one.
+func (a *AutonomousSystem) attachToVNI(host *Host, cfg config.HostConfig) {
+	r := a.getRouterByName(cfg.Router)
+	var port *EVPNPort
+	var vni *L2VNI
+	for i := range a.EVPN.L2VNIs {
+		if a.EVPN.L2VNIs[i].VNI != cfg.VNI {
+			continue
+		}
+		vni = &a.EVPN.L2VNIs[i]
+		for j := range vni.Ports {
+			if vni.Ports[j].Router == r {
+				port = &vni.Ports[j]
+			}
+		}
+	}
+	if vni == nil {
+		utils.Fatalf("AS%d: host %s: L2VNI %d does not exist\n", a.ASN, cfg.Name, cfg.VNI)
+	}
+	if port == nil {
+		utils.Fatalf("AS%d: host %s: %s is not a VTEP of L2VNI %d\n", a.ASN, cfg.Name, r.Hostname, cfg.VNI)
+	}
+	if cfg.IP == "" {
+		utils.Fatalf("AS%d: host %s needs an explicit IP\n", a.ASN, cfg.Name)
+	}
+
+	item := NewHostLinkItem(host)
+	ip, n, err := net.ParseCIDR(cfg.IP)
+	if err != nil {
+		utils.Fatalln("Host error:", err)
+	}
+	item.Interface.IP = net.IPNet{IP: ip, Mask: n.Mask}
+
+	if len(vni.Gateway.IP) > 0 {
+		if !vni.Gateway.Contains(ip) {
+			utils.Fatalf("Host error: %s is not in L2VNI %d (%s)\n", cfg.IP, vni.VNI, vni.Gateway.String())
+		}
+		if cfg.Gateway != "" && !net.ParseIP(cfg.Gateway).Equal(vni.Gateway.IP) {
+			utils.Fatalf("Host error: L2VNI %d uses the anycast gateway %s\n", vni.VNI, vni.Gateway.IP)
+		}
+		port.Gateway = vni.Gateway.IP
+	} else if cfg.Gateway != "" {
+		port.Gateway = net.ParseIP(cfg.Gateway)
+	}
+	port.Hosts = append(port.Hosts, item)
+}
+
+func evpnBridgeName(asn int, r *Router, vni int) string {
+	return fmt.Sprintf("AS%d-%s-vni%d", asn, r.Hostname, vni)
+}
+
+// ApplyEVPN creates the access ports of the L2VNIs with their hosts, and the
+// VXLAN and bridge devices inside the VTEP containers
+func (p *Project) ApplyEVPN() {
+	for n, as := range p.AS {
+		if !as.EVPN.Enabled() {
+			continue
+		}
+		for _, r := range as.Routers {
+			l3 := as.EVPN.L3VNIsFor(r)
+			l2 := as.EVPN.L2VNIsFor(r)
+			if len(l3) == 0 && len(l2) == 0 {
+				continue
+			}
+			local := r.LoID()
+
+			// Access ports
+			for _, vni := range l2 {
+				port := vni.Ports[0]
+				brName := evpnBridgeName(n, r, vni.VNI)
+				link.CreateBridge(brName)
+				settings := ovsdocker.DefaultParams()
+				settings.Speed = port.Interface.Speed
+				hostIf := ovsdocker.OVSInterface{}
+				link.AddPortToContainer(brName, port.Interface.IfName, r.ContainerName, settings, &hostIf, true)
+				if _, ok := p.AllLinks[r.ContainerName]; !ok {
+					p.AllLinks[r.ContainerName] = make([]ovsdocker.OVSInterface, 0, len(l2))
+				}
+				p.AllLinks[r.ContainerName] = append(p.AllLinks[r.ContainerName], hostIf)
+
+				for _, item := range port.Hosts {
+					settings := ovsdocker.DefaultParams()
+					settings.Speed = item.Interface.Speed
+					settings.Host = true
+					settings.IP = item.Interface.IP.String()
+					if port.Gateway != nil {
+						defaultRoute := "0.0.0.0/0"
+						if port.Gateway.To4() == nil {
+							defaultRoute = "::/0"
+						}
+						settings.Routes = []ovsdocker.IPRoute{{
+							IP:     defaultRoute,
+							Via:    port.Gateway.String(),
+							IfName: item.Interface.IfName,
+						}}
+					}
+					hostIf := ovsdocker.OVSInterface{}
+					link.AddPortToContainer(brName, item.Interface.IfName, item.Host.ContainerName, settings, &hostIf, true)
+					if _, ok := p.AllLinks[item.Host.ContainerName]; !ok {
+						p.AllLinks[item.Host.ContainerName] = make([]ovsdocker.OVSInterface, 0, 1)
+					}
+					p.AllLinks[item.Host.ContainerName] = append(p.AllLinks[item.Host.ContainerName], hostIf)
+				}
+			}
+
+			c := ovsdocker.New(r.ContainerName)
+
+			// L3VNIs first, so the VRFs exist when L2VNIs are attached
+			vnis := make([]ovsdocker.VNISettings, 0, len(l3)+len(l2))
+			for _, vni := range l3 {
+				vnis = append(vnis, ovsdocker.VNISettings{
+					VNI:   vni.VNI,
+					Local: local,
+					VRF:   vni.VRF,
+				})
+			}
+			for _, vni := range l2 {
+				settings := ovsdocker.VNISettings{
+					VNI:   vni.VNI,
+					Local: local,
+					VRF:   vni.VRF,
+					Ports: []string{vni.Ports[0].Interface.IfName},
+				}
+				if len(vni.Gateway.IP) > 0 {
+					settings.Gateway = vni.Gateway.String()
+					settings.MAC = vni.GatewayMAC()
+				}
+				vnis = append(vnis, settings)
+			}
+			for _, settings := range vnis {
+				if err := c.AddVNI(settings); err != nil {
+					utils.Fatalln("ApplyEVPN:", err)
+				}
+			}
+			p.AllVNIs[r.ContainerName] = vnis
+		}
+	}
+}
+
+// RemoveEVPN removes the bridges of the L2VNIs access ports
+func (p *Project) RemoveEVPN() {
+	for n, as := range p.AS {
+		for _, vni := range as.EVPN.L2VNIs {
+			for _, port := range vni.Ports {
+				link.DeleteBridge(evpnBridgeName(n, port.Router, vni.VNI))
+			}
+		}
+	}
+}
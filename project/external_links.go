@@ -16,18 +16,62 @@ const (
 	Peer     = iota
 )
 
+// asRelation is the relation between 2 AS, From and To being the role of
+// each AS (Provider, Customer or Peer)
+type asRelation struct {
+	FromASN int
+	ToASN   int
+	From    int
+	To      int
+}
+
+// asRelations returns the relations of the external links and of the
+// bilateral sessions at IXPs
+func (p *Project) asRelations() []asRelation {
+	res := make([]asRelation, 0, len(p.Ext))
+	for _, lnk := range p.Ext {
+		res = append(res, asRelation{lnk.From.ASN, lnk.To.ASN, lnk.From.Relation, lnk.To.Relation})
+	}
+	for _, ixp := range p.IXPs {
+		for _, b := range ixp.Bilateral {
+			res = append(res, asRelation{b.From.ASN, b.To.ASN, b.FromRelation, b.ToRelation})
+		}
+	}
+	return res
+}
+
+// relation returns the role of AS asn for AS local (Provider if asn is a
+// provider of local), using the external links and bilateral sessions
+// between them
+func (p *Project) relation(local, asn int) int {
+	for _, rel := range p.asRelations() {
+		if rel.FromASN == local && rel.ToASN == asn {
+			return rel.To
+		}
+		if rel.ToASN == local && rel.FromASN == asn {
+			return rel.From
+		}
+	}
+	return NoRel
+}
+
 // ExternalLinkItem represents a side of an ExternalLink
 type ExternalLinkItem struct {
 	ASN       int
 	Router    *Router
 	Interface *NetInterface
 	Relation  int
+	Session   BGPSession
 }
 
 // ExternalLink represents a link between 2 routers from different AS
 type ExternalLink struct {
 	From *ExternalLinkItem
 	To   *ExternalLinkItem
+	VPN  *InterASVPN
+	BFD  bool
+	// BGP settings of both ends, overridden by the ones of each end
+	Session BGPSession
 }
 
 // NewExtLinkItem returns a poiter to an ExternalLinkItem based on the
@@ -48,6 +92,20 @@ func NewExtLinkItem(asn int, router *Router) *ExternalLinkItem {
 	}
 }
 
+// parseRelationship returns the role of both ends of a p2c, c2p or p2p
+// relationship
+func parseRelationship(rel string) (from int, to int) {
+	switch strings.ToLower(rel) {
+	case "p2c":
+		return Provider, Customer
+	case "c2p":
+		return Customer, Provider
+	case "p2p":
+		return Peer, Peer
+	}
+	return NoRel, NoRel
+}
+
 func (p *Project) parseExternal(k config.ExternalLink) {
 	if _, ok := p.AS[k.From.ASN]; !ok {
 		utils.Fatalf("External link error : AS%d does not exist\n", k.From.ASN)
@@ -65,23 +123,19 @@ func (p *Project) parseExternal(k config.ExternalLink) {
 			p.AS[k.To.ASN].getRouter(k.To.RouterID),
 		),
 	}
-	switch strings.ToLower(k.Relationship) {
-	case "p2c":
-		l.From.Relation = Provider
-		l.To.Relation = Customer
-		break
-	case "c2p":
-		l.From.Relation = Customer
-		l.To.Relation = Provider
-		break
-	case "p2p":
-		l.From.Relation = Peer
-		l.To.Relation = Peer
-		break
-	default:
-		break
-	}
+	l.From.Relation, l.To.Relation = parseRelationship(k.Relationship)
+	checkMTU(k.MTU, fmt.Sprintf("External link AS%d-AS%d", k.From.ASN, k.To.ASN))
+	l.BFD = k.BFD
+	where := fmt.Sprintf("External link AS%d-AS%d", k.From.ASN, k.To.ASN)
+	l.Session = parseBGPSession(k.BGP, where)
+	l.From.Session = parseBGPSession(k.From.BGP, where)
+	l.To.Session = parseBGPSession(k.To.BGP, where)
+	l.From.Interface.MTU = k.MTU
+	l.To.Interface.MTU = k.MTU
 	l.setupExternal(&p.AS[k.From.ASN].Network)
+	if k.VPN != nil {
+		l.VPN = parseInterASVPN(*k.VPN)
+	}
 	p.Ext = append(p.Ext, l)
 }
 
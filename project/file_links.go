@@ -10,6 +10,10 @@ import (
 	"github.com/rahveiz/topomate/utils"
 )
 
+// internalFromFile reads internal links from a file. Each line contains the
+// two routers, optionally followed by the speed and the IGP costs of both
+// ends (* keeps the default), and key=value options. Options ending with 1
+// or 2 apply to the first or second end only (e.g. ip1=10.0.0.1/30).
 func (a *AutonomousSystem) internalFromFile(path string) []Link {
 	f, err := os.Open(path)
 	if err != nil {
@@ -24,7 +28,7 @@ func (a *AutonomousSystem) internalFromFile(path string) []Link {
 		if line[:1] == "#" {
 			continue
 		}
-		fields := strings.Fields(line)
+		fields, opts := linkFileOptions(splitFields(line))
 
 		if len(fields) < 2 {
 			utils.Fatalln("internalFromFile: not enough fields (must be at least 2)")
@@ -72,6 +76,7 @@ func (a *AutonomousSystem) internalFromFile(path string) []Link {
 
 		l.First.Interface.Description = fmt.Sprintf("linked to %s", l.Second.Router.Hostname)
 		l.Second.Interface.Description = fmt.Sprintf("linked to %s", l.First.Router.Hostname)
+		a.setupLinkEnds(l, opts)
 		res = append(res, l)
 	}
 	if err := scanner.Err(); err != nil {
@@ -80,6 +85,34 @@ func (a *AutonomousSystem) internalFromFile(path string) []Link {
 	return res
 }
 
+// linkFileOptions separates the positional fields of a line from its
+// key=value options, converted to the keys used by manual specs
+func linkFileOptions(fields []string) ([]string, map[string]string) {
+	opts := make(map[string]string)
+	for i, f := range fields {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		for _, v := range fields[i:] {
+			kv := strings.SplitN(v, "=", 2)
+			if len(kv) != 2 {
+				utils.Fatalf("internalFromFile: positional field %s after options\n", v)
+			}
+			key := kv[0]
+			switch {
+			case strings.HasSuffix(key, "1"):
+				key = "first_" + strings.TrimSuffix(key, "1")
+			case strings.HasSuffix(key, "2"):
+				key = "second_" + strings.TrimSuffix(key, "2")
+			}
+			opts[key] = kv[1]
+		}
+		return fields[:i], opts
+	}
+	return fields, opts
+}
+
 func (p *Project) externalFromFile(path string) {
 	f, err := os.Open(path)
 	if err != nil {
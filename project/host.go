@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"net"
 	"os/exec"
+	"strings"
 	"sync"
 
+	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
@@ -53,6 +55,154 @@ func NewHostLinkItem(host *Host) *HostLinkItem {
 	}
 }
 
+func (a *AutonomousSystem) parseHosts(cfgs []config.HostConfig) {
+	for _, cfg := range cfgs {
+		if cfg.Name == "" {
+			utils.Fatalf("AS%d: host without name\n", a.ASN)
+		}
+		for _, r := range a.Routers {
+			if r.Hostname == cfg.Name {
+				utils.Fatalf("AS%d: host %s has the same name as a router\n", a.ASN, cfg.Name)
+			}
+		}
+		for _, h := range a.Hosts {
+			if h.Hostname == cfg.Name {
+				utils.Fatalf("AS%d: duplicate host %s\n", a.ASN, cfg.Name)
+			}
+		}
+		if cfg.Router == "" && cfg.LAN == "" {
+			utils.Fatalf("AS%d: host %s is not attached to a router or a LAN\n", a.ASN, cfg.Name)
+		}
+		if cfg.VNI != 0 && (cfg.Router == "" || cfg.LAN != "") {
+			utils.Fatalf("AS%d: host %s must be attached to a VTEP router to use a VNI\n", a.ASN, cfg.Name)
+		}
+
+		host := &Host{
+			Hostname:      cfg.Name,
+			ContainerName: fmt.Sprintf("AS%d-%s", a.ASN, cfg.Name),
+			DockerImage:   cfg.Image,
+			Command:       strings.Fields(cfg.Command),
+		}
+		// the default image needs a command to keep running
+		if host.DockerImage == "" {
+			host.DockerImage = config.DockerHostImage
+			if len(host.Command) == 0 {
+				host.Command = []string{"sleep", "infinity"}
+			}
+		}
+		for _, f := range cfg.Files {
+			host.Files = append(host.Files, HostFile{
+				HostPath:      utils.ResolveFilePath(f.Src),
+				ContainerPath: f.Dst,
+			})
+		}
+
+		if cfg.LAN != "" {
+			if cfg.Injector != nil {
+				utils.Fatalf("AS%d: injector %s must be attached to a router\n", a.ASN, cfg.Name)
+			}
+			a.Hosts = append(a.Hosts, host)
+			a.attachToLAN(host, cfg)
+			continue
+		}
+
+		if cfg.VNI != 0 {
+			if cfg.Injector != nil {
+				utils.Fatalf("AS%d: injector %s cannot be attached to a VNI\n", a.ASN, cfg.Name)
+			}
+			a.Hosts = append(a.Hosts, host)
+			a.attachToVNI(host, cfg)
+			continue
+		}
+
+		router := a.getRouterByName(cfg.Router)
+		linkRouter := NewLinkItem(router)
+		linkRouter.Interface.Description = "linked to " + cfg.Name
+		linkRouter.Interface.External = true // no IGP
+		linkHost := NewHostLinkItem(host)
+
+		if cfg.IP != "" {
+			linkHost.Interface.IP, linkRouter.Interface.IP = hostAddresses(cfg.IP, cfg.Gateway)
+		} else {
+			if !a.Network.AutoAddress {
+				utils.Fatalf("AS%d: host %s needs an explicit IP\n", a.ASN, cfg.Name)
+			}
+			linkHost.Interface.IP, linkRouter.Interface.IP = a.Network.NextLinkIPs()
+		}
+
+		l := HostLink{
+			Router: linkRouter,
+			Host:   linkHost,
+		}
+		if cfg.Injector != nil {
+			a.setupInjector(l, cfg.Injector)
+		}
+		a.HostLinks = append(a.HostLinks, l)
+		a.Hosts = append(a.Hosts, host)
+		router.Links = append(router.Links, linkRouter.Interface)
+	}
+}
+
+// attachToLAN adds a host to a LAN, using the next free address of the LAN
+// if no IP is specified
+func (a *AutonomousSystem) attachToLAN(host *Host, cfg config.HostConfig) {
+	lan := a.getLAN(cfg.LAN)
+	item := NewHostLinkItem(host)
+	if cfg.IP != "" {
+		ip, n, err := net.ParseCIDR(cfg.IP)
+		if err != nil {
+			utils.Fatalln("Host error:", err)
+		}
+		if !lan.Subnet.Contains(ip) {
+			utils.Fatalf("Host error: %s is not in LAN %s (%s)\n", cfg.IP, lan.Name, lan.Subnet.String())
+		}
+		item.Interface.IP = net.IPNet{IP: ip, Mask: n.Mask}
+	} else {
+		item.Interface.IP = lan.NextIP()
+	}
+	item.Interface.MTU = lan.MTU
+	if cfg.Gateway != "" {
+		lan.Gateway = net.ParseIP(cfg.Gateway)
+	}
+	lan.Hosts = append(lan.Hosts, item)
+}
+
+// hostAddresses returns the addresses of a host and of its router. If gateway
+// is empty, the router uses the first address of the subnet that is not the
+// host one.
+func hostAddresses(ip, gateway string) (host net.IPNet, router net.IPNet) {
+	hostIP, subnet, err := net.ParseCIDR(ip)
+	if err != nil {
+		utils.Fatalln("Host error:", err)
+	}
+	host = net.IPNet{IP: hostIP, Mask: subnet.Mask}
+	router = net.IPNet{Mask: subnet.Mask}
+
+	if gateway != "" {
+		router.IP = net.ParseIP(gateway)
+		if router.IP == nil || !subnet.Contains(router.IP) {
+			utils.Fatalf("Host error: invalid gateway %s for %s\n", gateway, ip)
+		}
+		return
+	}
+
+	candidate := cidr.Inc(subnet.IP)
+	if candidate.Equal(hostIP) {
+		candidate = cidr.Inc(candidate)
+	}
+	if !subnet.Contains(candidate) {
+		utils.Fatalf("Host error: no address left for the router in %s\n", subnet)
+	}
+	router.IP = candidate
+	return
+}
+
+// Subnet returns the subnet of the link between a host and its router
+func (l *HostLink) Subnet() net.IPNet {
+	ip := l.Host.Interface.IP
+	return net.IPNet{IP: ip.IP.Mask(ip.Mask), Mask: ip.Mask}
+}
+
 // StartContainer starts the container
 func (host *Host) StartContainer(wg *sync.WaitGroup) {
 	ctx := context.Background()
@@ -0,0 +1,138 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rahveiz/topomate/utils"
+)
+
+// iBGP modes used when the sessions are not configured manually
+const (
+	IBGPAuto            = ""
+	IBGPFullMesh        = "full-mesh"
+	IBGPRouteReflectors = "route-reflectors"
+	IBGPAdjacent        = "adjacent"
+)
+
+// autoRRThreshold is the number of routers above which the automatic mode
+// uses route reflectors instead of a full mesh
+const autoRRThreshold = 10
+
+// setupAutoIBGP creates the iBGP sessions of the AS between loopbacks, using a
+// full mesh or route reflectors depending on mode. The adjacent mode only
+// creates sessions between routers sharing a link or a LAN.
+func (a *AutonomousSystem) setupAutoIBGP(mode string) {
+	switch mode {
+	case IBGPAuto, IBGPFullMesh, IBGPRouteReflectors:
+	case IBGPAdjacent:
+		a.linkRouters(true)
+		return
+	default:
+		utils.Fatalf("AS%d: unknown iBGP mode %s\n", a.ASN, mode)
+	}
+
+	for _, r := range a.Routers {
+		if len(r.Loopback) > 0 {
+			continue
+		}
+		if mode != IBGPAuto {
+			utils.Fatalf("AS%d: iBGP mode %s needs loopback addresses\n", a.ASN, mode)
+		}
+		utils.PrintError("Warning:", fmt.Sprintf("AS%d: no loopback addresses, using adjacent iBGP sessions", a.ASN))
+		a.linkRouters(true)
+		return
+	}
+	a.linkRouters(false)
+
+	af := AddressFamily{IPv4: true}
+	if !a.Network.Is4() {
+		af = AddressFamily{IPv6: true}
+	}
+
+	// Each confederation member has its own design, the routers of full mesh
+	// members and the reflectors being meshed together
+	top := make([]*Router, 0, len(a.Routers))
+	for _, group := range a.ibgpGroups() {
+		useRR := mode == IBGPRouteReflectors ||
+			(mode == IBGPAuto && len(group) > autoRRThreshold)
+		if !useRR || len(group) <= 2 {
+			top = append(top, group...)
+			continue
+		}
+		reflectors := chooseReflectors(group)
+		for _, rr := range reflectors {
+			for _, client := range group {
+				if client == reflectors[0] || client == reflectors[1] {
+					continue
+				}
+				addIBGPSession(rr, client, a.ASN, af, true)
+				addIBGPSession(client, rr, a.ASN, af, false)
+			}
+		}
+		top = append(top, reflectors...)
+	}
+	for _, r := range top {
+		for _, n := range top {
+			if r != n {
+				addIBGPSession(r, n, a.ASN, af, false)
+			}
+		}
+	}
+}
+
+// ibgpGroups returns the routers of each confederation member, or all the
+// routers of the AS if there is no confederation
+func (a *AutonomousSystem) ibgpGroups() [][]*Router {
+	if len(a.BGP.Confederation) == 0 {
+		return [][]*Router{a.Routers}
+	}
+	res := make([][]*Router, 0, len(a.BGP.Confederation))
+	for _, m := range a.BGP.Confederation {
+		group := make([]*Router, 0, len(a.Routers))
+		for _, r := range a.Routers {
+			if r.SubAS == m {
+				group = append(group, r)
+			}
+		}
+		res = append(res, group)
+	}
+	return res
+}
+
+// chooseReflectors returns the two routers of the group with the most
+// internal links, used as redundant route reflectors
+func chooseReflectors(group []*Router) []*Router {
+	degree := func(r *Router) int {
+		n := 0
+		for _, iface := range r.Links {
+			if !iface.External {
+				n++
+			}
+		}
+		return n
+	}
+	sorted := make([]*Router, len(group))
+	copy(sorted, group)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return degree(sorted[i]) > degree(sorted[j])
+	})
+	return sorted[:2]
+}
+
+// addIBGPSession adds an iBGP session from r to the loopback of n
+func addIBGPSession(r, n *Router, asn int, af AddressFamily, rrClient bool) {
+	id, mask := n.LoInfo()
+	if nbr, ok := r.Neighbors[id]; ok {
+		nbr.RRClient = nbr.RRClient || rrClient
+		return
+	}
+	r.Neighbors[id] = &BGPNbr{
+		RemoteAS:     asn,
+		UpdateSource: "lo",
+		NextHopSelf:  true,
+		RRClient:     rrClient,
+		AF:           af,
+		Mask:         mask,
+	}
+}
@@ -0,0 +1,116 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/internal/injector"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// injectorFile is the path of the MRT file in the injector container
+const injectorFile = "/feed.mrt"
+
+// setupInjector makes the host of the link replay a MRT file over an eBGP
+// session with its router
+func (a *AutonomousSystem) setupInjector(l HostLink, cfg *config.InjectorConfig) {
+	host := l.Host.Host
+	where := fmt.Sprintf("AS%d: injector %s", a.ASN, host.Hostname)
+	if cfg.File == "" {
+		utils.Fatalf("%s has no MRT file\n", where)
+	}
+	if cfg.ASN <= 0 || cfg.ASN == a.ASN {
+		utils.Fatalf("%s needs an AS number different from AS%d\n", where, a.ASN)
+	}
+	file := utils.ResolveFilePath(cfg.File)
+	if _, err := os.Stat(file); err != nil {
+		utils.Fatalln(where+":", err)
+	}
+
+	hostIP := l.Host.Interface.IP
+	routerID := cfg.RouterID
+	if routerID == "" {
+		if hostIP.IP.To4() == nil {
+			utils.Fatalf("%s needs a router_id on IPv6 links\n", where)
+		}
+		routerID = hostIP.IP.String()
+	}
+
+	relation := Provider
+	switch strings.ToLower(cfg.Relation) {
+	case "", "provider":
+		break
+	case "customer":
+		relation = Customer
+		break
+	case "peer":
+		relation = Peer
+		break
+	default:
+		utils.Fatalf("%s: unknown relation %s\n", where, cfg.Relation)
+	}
+
+	host.DockerImage = config.DockerInjectorImage
+	host.Files = append(host.Files, HostFile{
+		HostPath:      file,
+		ContainerPath: injectorFile,
+	})
+	host.Command = []string{
+		"--file", injectorFile,
+		"--asn", strconv.Itoa(cfg.ASN),
+		"--id", routerID,
+		"--peer", l.Router.Interface.IP.IP.String(),
+		"--peer-as", strconv.Itoa(a.ASN),
+	}
+	if cfg.Rate > 0 {
+		host.Command = append(host.Command, "--rate", strconv.Itoa(cfg.Rate))
+	}
+	if cfg.Limit > 0 {
+		host.Command = append(host.Command, "--limit", strconv.Itoa(cfg.Limit))
+	}
+	if cfg.PeerIndex != nil {
+		host.Command = append(host.Command, "--peer-index", strconv.Itoa(*cfg.PeerIndex))
+	}
+	if len(cfg.ASMap) > 0 {
+		items := make([]string, 0, len(cfg.ASMap))
+		for from, to := range cfg.ASMap {
+			items = append(items, fmt.Sprintf("%d=%d", from, to))
+		}
+		sort.Strings(items)
+		host.Command = append(host.Command, "--as-map", strings.Join(items, ","))
+	}
+	if len(cfg.PrefixMap) > 0 {
+		items := make([]string, 0, len(cfg.PrefixMap))
+		for from, to := range cfg.PrefixMap {
+			items = append(items, from+"="+to)
+		}
+		sort.Strings(items)
+		s := strings.Join(items, ",")
+		if _, err := injector.ParsePrefixMap(s); err != nil {
+			utils.Fatalln(where+":", err)
+		}
+		host.Command = append(host.Command, "--prefix-map", s)
+	}
+
+	af := AddressFamily{}
+	if hostIP.IP.To4() != nil {
+		af.IPv4 = true
+	} else {
+		af.IPv6 = true
+	}
+	m, _ := hostIP.Mask.Size()
+	rmIn, rmOut := getRouteMaps(relation, nil, nil)
+	l.Router.Router.Neighbors[hostIP.IP.String()] = &BGPNbr{
+		RemoteAS:     cfg.ASN,
+		ConnCheck:    true,
+		IfName:       l.Router.Interface.IfName,
+		RouteMapsIn:  rmIn,
+		RouteMapsOut: rmOut,
+		AF:           af,
+		Mask:         m,
+	}
+}
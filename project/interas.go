@@ -0,0 +1,290 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+const (
+	InterASOptionA = iota + 1
+	InterASOptionB
+	InterASOptionC
+)
+
+// InterASVPN represents the inter-AS VPN settings of an external link
+type InterASVPN struct {
+	Option int
+	VRFs   []string
+	// Back-to-back links (one per VRF) used by option A
+	Links []*ExternalLink
+	// Routers exchanging VPN routes using multihop eBGP (option C)
+	FromRR int
+	ToRR   int
+}
+
+func parseInterASVPN(cfg config.InterASVPNConfig) *InterASVPN {
+	res := &InterASVPN{
+		VRFs:   cfg.VRFs,
+		FromRR: cfg.FromRR,
+		ToRR:   cfg.ToRR,
+	}
+	switch strings.ToUpper(cfg.Option) {
+	case "A":
+		res.Option = InterASOptionA
+		if len(cfg.VRFs) == 0 {
+			utils.Fatalln("Inter-AS VPN error: option A needs at least one VRF")
+		}
+	case "B":
+		res.Option = InterASOptionB
+	case "C":
+		res.Option = InterASOptionC
+		if cfg.FromRR < 1 || cfg.ToRR < 1 {
+			utils.Fatalln("Inter-AS VPN error: option C needs from_rr and to_rr")
+		}
+	default:
+		utils.Fatalf("Inter-AS VPN error: unknown option %s (must be A, B or C)\n", cfg.Option)
+	}
+	return res
+}
+
+// FindVPN returns the VPN using the VRF name vrf, or nil if not found
+func (a *AutonomousSystem) FindVPN(vrf string) *VPN {
+	for i := range a.VPN {
+		if a.VPN[i].VRF == vrf {
+			return &a.VPN[i]
+		}
+	}
+	return nil
+}
+
+// vpnAddressFamily returns the VPN address-families used in the AS
+func (a *AutonomousSystem) vpnAddressFamily() (af AddressFamily) {
+	for _, vpn := range a.VPN {
+		af.VPNv4 = af.VPNv4 || vpn.IPv4
+		af.VPNv6 = af.VPNv6 || vpn.IPv6
+	}
+	return
+}
+
+// joinVPN adds r to the PEs of vpn, creating the VPN sessions between r and
+// the other PEs. If nhSelf is set, r sets itself as next-hop for VPN routes
+// sent to the other PEs.
+func (a *AutonomousSystem) joinVPN(vpn *VPN, r *Router, nhSelf bool) {
+	id := r.LoID()
+	if id == "" {
+		utils.Fatalf("AS%d: %s needs a loopback to exchange VPN routes\n", a.ASN, r.Hostname)
+	}
+	af := vpn.AddressFamily()
+	if vpn.Neighbors == nil {
+		vpn.Neighbors = make(map[string]bool, 1)
+	}
+	a.addVPNNeighbors(r, id, vpn.Neighbors, af)
+	for _, pe := range a.Routers {
+		if pe == r || !vpn.Neighbors[pe.LoID()] {
+			continue
+		}
+		a.addVPNNeighbors(pe, pe.LoID(), map[string]bool{id: true}, af)
+	}
+	if nhSelf {
+		for nbrID := range vpn.Neighbors {
+			if nbr, ok := r.Neighbors[nbrID]; ok && nbrID != id {
+				nbr.NextHopSelfVPN = true
+			}
+		}
+	}
+	vpn.Neighbors[id] = true
+}
+
+// directSession makes the eBGP session of the link use the interface
+// addresses instead of the loopbacks, so the labels exchanged can be used
+// directly on the link
+func (e *ExternalLink) directSession() {
+	move := func(local, remote *ExternalLinkItem) {
+		key := remote.Interface.IP.IP.String()
+		if lo := remote.Router.LoID(); lo != "" {
+			if nbr, ok := local.Router.Neighbors[lo]; ok && nbr.RemoteAS == remote.ASN {
+				delete(local.Router.Neighbors, lo)
+				local.Router.Neighbors[key] = nbr
+			}
+		}
+		nbr, ok := local.Router.Neighbors[key]
+		if !ok {
+			utils.Fatalf("Inter-AS VPN error: no session between AS%d and AS%d\n", local.ASN, remote.ASN)
+		}
+		nbr.UpdateSource = ""
+		nbr.ConnCheck = true
+		local.Interface.MPLSBGP = true
+	}
+	move(e.From, e.To)
+	move(e.To, e.From)
+}
+
+func (p *Project) linkInterASVPN() {
+	for _, lnk := range p.Ext {
+		if lnk.VPN == nil {
+			continue
+		}
+		switch lnk.VPN.Option {
+		case InterASOptionA:
+			p.linkOptionA(lnk)
+		case InterASOptionB:
+			p.linkOptionB(lnk)
+		case InterASOptionC:
+			p.linkOptionC(lnk)
+		}
+	}
+}
+
+// linkOptionA creates a back-to-back link per VRF between the ASBRs, that
+// act as PEs and see each other as CEs
+func (p *Project) linkOptionA(lnk *ExternalLink) {
+	fromAS := p.AS[lnk.From.ASN]
+	toAS := p.AS[lnk.To.ASN]
+
+	for _, vrf := range lnk.VPN.VRFs {
+		fromVPN := fromAS.FindVPN(vrf)
+		toVPN := toAS.FindVPN(vrf)
+		if fromVPN == nil || toVPN == nil {
+			utils.Fatalf("Inter-AS VPN error: VRF %s must exist in AS%d and AS%d\n",
+				vrf, fromAS.ASN, toAS.ASN)
+		}
+
+		l := &ExternalLink{
+			From: NewExtLinkItem(lnk.From.ASN, lnk.From.Router),
+			To:   NewExtLinkItem(lnk.To.ASN, lnk.To.Router),
+		}
+		l.From.Relation = lnk.From.Relation
+		l.To.Relation = lnk.To.Relation
+		l.From.Interface.MTU = lnk.From.Interface.MTU
+		l.To.Interface.MTU = lnk.To.Interface.MTU
+		l.setupExternal(&fromAS.Network)
+		if len(l.From.Interface.IP.IP) == 0 {
+			utils.Fatalf("Inter-AS VPN error: option A needs automatic addressing in AS%d\n", fromAS.ASN)
+		}
+
+		for _, e := range []struct {
+			local, remote *ExternalLinkItem
+			vpn           *VPN
+			as            *AutonomousSystem
+		}{
+			{l.From, l.To, fromVPN, fromAS},
+			{l.To, l.From, toVPN, toAS},
+		} {
+			e.local.Interface.VRF = vrf
+			e.local.Interface.Description = fmt.Sprintf("linked to AS%d (%s) in VRF %s",
+				e.remote.ASN, e.remote.Router.Hostname, vrf)
+			e.local.Router.Links = append(e.local.Router.Links, e.local.Interface)
+			e.local.Router.addVRFNeighbor(vrf, e.remote.Interface.IP.IP.String(), &BGPNbr{
+				RemoteAS:  e.remote.ASN,
+				ConnCheck: true,
+				AF: AddressFamily{
+					IPv4: e.remote.Interface.IP.IP.To4() != nil,
+					IPv6: e.remote.Interface.IP.IP.To4() == nil,
+				},
+			})
+			e.as.joinVPN(e.vpn, e.local.Router, false)
+		}
+		lnk.VPN.Links = append(lnk.VPN.Links, l)
+	}
+}
+
+// linkOptionB adds the VPN address-families to the eBGP session between the
+// ASBRs, that also exchange VPN routes with all the PEs of their AS
+func (p *Project) linkOptionB(lnk *ExternalLink) {
+	fromAS := p.AS[lnk.From.ASN]
+	toAS := p.AS[lnk.To.ASN]
+
+	lnk.directSession()
+
+	af := fromAS.vpnAddressFamily()
+	toAF := toAS.vpnAddressFamily()
+	af.VPNv4 = af.VPNv4 || toAF.VPNv4
+	af.VPNv6 = af.VPNv6 || toAF.VPNv6
+
+	for _, e := range []struct {
+		local, remote *ExternalLinkItem
+		as            *AutonomousSystem
+	}{
+		{lnk.From, lnk.To, fromAS},
+		{lnk.To, lnk.From, toAS},
+	} {
+		nbr := e.local.Router.Neighbors[e.remote.Interface.IP.IP.String()]
+		nbr.AF.VPNv4 = af.VPNv4
+		nbr.AF.VPNv6 = af.VPNv6
+		for i := range e.as.VPN {
+			e.as.joinVPN(&e.as.VPN[i], e.local.Router, true)
+		}
+	}
+}
+
+// linkOptionC exchanges the PE loopbacks between the ASBRs using BGP
+// labeled-unicast, and creates a multihop eBGP session carrying the VPN
+// routes between the route reflectors (or PEs) of both AS
+func (p *Project) linkOptionC(lnk *ExternalLink) {
+	fromAS := p.AS[lnk.From.ASN]
+	toAS := p.AS[lnk.To.ASN]
+
+	lnk.directSession()
+	lnk.From.Router.Neighbors[lnk.To.Interface.IP.IP.String()].AF.LabeledUnicast = true
+	lnk.To.Router.Neighbors[lnk.From.Interface.IP.IP.String()].AF.LabeledUnicast = true
+	lnk.From.Router.InterASLoopbacks = append(lnk.From.Router.InterASLoopbacks, toAS.Loopbacks()...)
+	lnk.To.Router.InterASLoopbacks = append(lnk.To.Router.InterASLoopbacks, fromAS.Loopbacks()...)
+
+	fromRR := fromAS.getRouter(lnk.VPN.FromRR)
+	toRR := toAS.getRouter(lnk.VPN.ToRR)
+
+	af := fromAS.vpnAddressFamily()
+	toAF := toAS.vpnAddressFamily()
+	af.VPNv4 = af.VPNv4 || toAF.VPNv4
+	af.VPNv6 = af.VPNv6 || toAF.VPNv6
+
+	for _, e := range []struct {
+		local, remote *Router
+		as            *AutonomousSystem
+		remoteASN     int
+	}{
+		{fromRR, toRR, fromAS, toAS.ASN},
+		{toRR, fromRR, toAS, fromAS.ASN},
+	} {
+		id, mask := e.remote.LoInfo()
+		if id == "" {
+			utils.Fatalf("Inter-AS VPN error: %s of AS%d needs a loopback\n", e.remote.Hostname, e.remoteASN)
+		}
+		e.local.Neighbors[id] = &BGPNbr{
+			RemoteAS:         e.remoteASN,
+			UpdateSource:     "lo",
+			EBGPMultihop:     255,
+			NextHopUnchanged: true,
+			AF:               af,
+			Mask:             mask,
+		}
+		for i := range e.as.VPN {
+			e.as.joinVPN(&e.as.VPN[i], e.local, false)
+		}
+	}
+}
+
+// Loopbacks returns the loopback addresses of all the routers of the AS
+func (a *AutonomousSystem) Loopbacks() []net.IPNet {
+	res := make([]net.IPNet, 0, len(a.Routers))
+	for _, r := range a.Routers {
+		if len(r.Loopback) > 0 {
+			res = append(res, r.Loopback[0])
+		}
+	}
+	return res
+}
+
+func (r *Router) addVRFNeighbor(vrf, ip string, nbr *BGPNbr) {
+	if r.VRFNeighbors == nil {
+		r.VRFNeighbors = make(map[string]map[string]*BGPNbr, 1)
+	}
+	if _, ok := r.VRFNeighbors[vrf]; !ok {
+		r.VRFNeighbors[vrf] = make(map[string]*BGPNbr, 1)
+	}
+	r.VRFNeighbors[vrf][ip] = nbr
+}
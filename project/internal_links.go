@@ -20,6 +20,16 @@ type IGPSettings struct {
 		Passive bool
 	}
 	OSPFArea int
+	// Broadcast is set on multi-access segments, where Priority is used for
+	// the DR (OSPF) or DIS (IS-IS) election
+	Broadcast bool
+	Priority  int
+	// Passive interfaces are advertised but do not form adjacencies
+	Passive bool
+	// BFD profile used by the adjacencies, noBFD is set if BFD is disabled
+	// on the link
+	BFD   string
+	noBFD bool
 }
 
 type NetInterface struct {
@@ -29,7 +39,9 @@ type NetInterface struct {
 	Speed       int
 	External    bool
 	Cost        int
+	MTU         int
 	VRF         string
+	MPLSBGP     bool
 	IGP         IGPSettings
 }
 
@@ -98,6 +110,7 @@ func (a *AutonomousSystem) SetupManual(lm config.InternalLinks, noCost bool) []L
 			}
 			l.First.Interface.Description = fmt.Sprintf("linked to %s", s.Hostname)
 			l.Second.Interface.Description = fmt.Sprintf("linked to %s", f.Hostname)
+			a.setupLinkEnds(l, v)
 			links[idx] = l
 		}
 	}
@@ -3,6 +3,7 @@ package project
 import (
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -15,38 +16,116 @@ import (
 
 const separator = "."
 
+// Routing daemons of the route servers
+const (
+	RSDaemonFRR  = "frr"
+	RSDaemonBird = "bird"
+)
+
 type IXP struct {
-	ASN         int
-	Network     Net
-	RouteServer *Router
-	Links       []*ExternalLinkItem
+	ASN          int
+	Network      Net
+	Daemon       string
+	RouteServers []*Router
+	// Links of the route servers, followed by the ones of the members
+	Links []*ExternalLinkItem
+	// Hosts attached to the peering LAN (RTR servers)
+	Hosts       []*HostLinkItem
+	Filter      bool
+	Communities bool
+	RPKI        []string
+	// Prefixes accepted from each member AS if Filter is set (of both
+	// families, members can exchange IPv6 routes over an IPv4 peering LAN)
+	Prefixes map[int][]string
+	// Direct sessions between members
+	Bilateral []Bilateral
+}
+
+// Bilateral is a direct session between 2 members of an IXP, FromRelation
+// and ToRelation being the role of each member
+type Bilateral struct {
+	From         *ExternalLinkItem
+	To           *ExternalLinkItem
+	FromRelation int
+	ToRelation   int
+}
+
+// Members returns the links of the members of the IXP
+func (ixp *IXP) Members() []*ExternalLinkItem {
+	return ixp.Links[len(ixp.RouteServers):]
 }
 
 func (p *Project) parseIXPConfig(cfg config.IXPConfig) IXP {
 	name := "IXP-" + strconv.Itoa(cfg.ASN)
+	where := fmt.Sprintf("IXP %d", cfg.ASN)
 	ixp := IXP{
-		ASN: cfg.ASN,
-		RouteServer: &Router{
-			ID:            1,
-			Hostname:      name,
-			ContainerName: name,
-			NextInterface: 0,
-			CustomImage:   config.DockerRSImage,
-			Neighbors:     make(map[string]*BGPNbr, len(cfg.Peers)),
-		},
+		ASN:         cfg.ASN,
+		Communities: cfg.Communities,
+		RPKI:        cfg.RPKI,
+	}
+
+	switch strings.ToLower(cfg.Filter) {
+	case "", "none":
+		break
+	case "auto":
+		ixp.Filter = true
+		break
+	default:
+		utils.Fatalf("%s: unknown filter %s\n", where, cfg.Filter)
+	}
+
+	image := config.DockerRSImage
+	switch strings.ToLower(cfg.RSDaemon) {
+	case "", RSDaemonFRR:
+		ixp.Daemon = RSDaemonFRR
+		break
+	case RSDaemonBird:
+		ixp.Daemon = RSDaemonBird
+		image = config.DockerBirdImage
+		break
+	default:
+		utils.Fatalf("%s: unknown route server daemon %s\n", where, cfg.RSDaemon)
+	}
+	if ixp.Communities && ixp.ASN > 0xffff {
+		utils.Fatalf("%s: action communities need a 2 bytes AS number\n", where)
+	}
+
+	nbRS := cfg.RouteServers
+	if nbRS == 0 {
+		nbRS = 1
+	}
+	if nbRS < 1 || nbRS > 2 {
+		utils.Fatalf("%s: route_servers must be 1 or 2\n", where)
 	}
 
 	// Parse loopback
 
-	_, n, err := net.ParseCIDR(cfg.Loopback)
+	_, lo, err := net.ParseCIDR(cfg.Loopback)
 	if err != nil {
 		utils.Fatalln(err)
 	}
-	ixp.RouteServer.Loopback = append(ixp.RouteServer.Loopback, *n)
+
+	for i := 0; i < nbRS; i++ {
+		hostname := name
+		if i > 0 {
+			hostname = fmt.Sprintf("%s-%d", name, i+1)
+			lo = &net.IPNet{IP: cidr.Inc(lo.IP), Mask: lo.Mask}
+		}
+		ixp.RouteServers = append(ixp.RouteServers, &Router{
+			ID:            i + 1,
+			Hostname:      hostname,
+			ContainerName: hostname,
+			NextInterface: 0,
+			CustomImage:   image,
+			Daemon:        ixp.Daemon,
+			Neighbors:     make(map[string]*BGPNbr, len(cfg.Peers)),
+			Loopback:      []net.IPNet{*lo},
+		})
+	}
 
 	// Parse network CIDR
 
-	_, n, err = net.ParseCIDR(cfg.Prefix)
+	_, n, err := net.ParseCIDR(cfg.Prefix)
 	if err != nil {
 		utils.Fatalln(err)
 	}
@@ -57,10 +136,19 @@ func (p *Project) parseIXPConfig(cfg config.IXPConfig) IXP {
 		Mask: n.Mask,
 	}
 
-	ixp.Links = make([]*ExternalLinkItem, 0, len(cfg.Peers)+1) // peers + rs
+	ixp.Links = make([]*ExternalLinkItem, 0, len(cfg.Peers)+nbRS) // peers + rs
 
-	ixp.Links = append(ixp.Links, NewExtLinkItem(ixp.ASN, ixp.RouteServer))
-	ixp.Links[0].Interface.IP = ixp.Network.NextIP()
+	session := parseBGPSession(cfg.BGP, where)
+	peersSession := make(map[string]BGPSession, len(cfg.PeersBGP))
+	for k, v := range cfg.PeersBGP {
+		peersSession[k] = parseBGPSession(v, where+" ("+k+")")
+	}
+
+	for _, rs := range ixp.RouteServers {
+		l := NewExtLinkItem(ixp.ASN, rs)
+		l.Interface.IP = ixp.Network.NextIP()
+		ixp.Links = append(ixp.Links, l)
+	}
 
 	for _, peer := range cfg.Peers {
 		fields := strings.Fields(peer)
@@ -89,56 +177,274 @@ func (p *Project) parseIXPConfig(cfg config.IXPConfig) IXP {
 			l.Interface.SetSpeedAndCost(speed)
 		}
 
+		l.Session = session
+		if s, ok := peersSession[fields[0]]; ok {
+			l.Session.merge(s)
+			delete(peersSession, fields[0])
+		}
+
 		l.Interface.IP = ixp.Network.NextIP()
 		l.Interface.Description = fmt.Sprint("Linked to IXP ", ixp.ASN)
 		ixp.Links = append(ixp.Links, l)
+
+		if ixp.Communities && peerASN > 0xffff {
+			utils.PrintError("Warning:", fmt.Sprintf(
+				"%s: AS%d cannot be the target of action communities", where, peerASN))
+		}
+	}
+	for k := range peersSession {
+		utils.Fatalf("%s: %s is not a peer\n", where, k)
+	}
+
+	for _, b := range cfg.Bilateral {
+		ixp.parseBilateral(p, b)
 	}
 
 	return ixp
 }
 
-func (ixp *IXP) linkIXP() {
+// parseBilateral adds a session between 2 members, given as
+// "<ASN>.<Router_ID> <ASN>.<Router_ID> [relationship]"
+func (ixp *IXP) parseBilateral(p *Project, entry string) {
+	where := fmt.Sprintf("IXP %d: bilateral session %s", ixp.ASN, entry)
+	fields := strings.Fields(entry)
+	if len(fields) < 2 || len(fields) > 3 {
+		utils.Fatalf("%s malformed\n", where)
+	}
+	member := func(key string) *ExternalLinkItem {
+		_p := strings.SplitN(key, ".", 2)
+		asn, err := strconv.Atoi(_p[0])
+		if err != nil || len(_p) < 2 {
+			utils.Fatalf("%s: %s malformed (must be <ASN>.<Router_ID>)\n", where, key)
+		}
+		if _, ok := p.AS[asn]; !ok {
+			utils.Fatalf("%s: AS%d does not exist\n", where, asn)
+		}
+		r := p.AS[asn].getRouter(_p[1])
+		for _, lnk := range ixp.Members() {
+			if lnk.Router == r {
+				return lnk
+			}
+		}
+		utils.Fatalf("%s: %s is not a peer\n", where, key)
+		return nil
+	}
 
-	// rsID := ixp.RouteServer.LoID()
-	ixp.Links[0].Router.Links =
-		append(ixp.RouteServer.Links, ixp.Links[0].Interface)
-	rmIn, rmOut := getRouteMaps(Peer, nil, nil) // PEER route-maps
-	// For each peer, we create an iBGP session between it and the route-server
-	for i, lnk := range ixp.Links {
-		// Skip first link (RouteServer)
-		if i == 0 {
-			continue
+	b := Bilateral{
+		From:         member(fields[0]),
+		To:           member(fields[1]),
+		FromRelation: Peer,
+		ToRelation:   Peer,
+	}
+	if b.From.ASN == b.To.ASN {
+		utils.Fatalf("%s: both routers are in AS%d\n", where, b.From.ASN)
+	}
+	if len(fields) == 3 {
+		b.FromRelation, b.ToRelation = parseRelationship(fields[2])
+		if b.FromRelation == NoRel {
+			utils.Fatalf("%s: unknown relationship %s\n", where, fields[2])
 		}
+	}
+	for _, other := range ixp.Bilateral {
+		if (other.From == b.From && other.To == b.To) || (other.From == b.To && other.To == b.From) {
+			utils.Fatalf("%s: duplicate session\n", where)
+		}
+	}
+	ixp.Bilateral = append(ixp.Bilateral, b)
+}
 
-		// check which AF are in use
+// setupFilters computes the prefixes accepted from each member if the IXP
+// filters the routes of its members
+func (ixp *IXP) setupFilters(p *Project) {
+	if !ixp.Filter {
+		return
+	}
+	ixp.Prefixes = make(map[int][]string, len(ixp.Members()))
+	for _, lnk := range ixp.Members() {
+		if _, ok := ixp.Prefixes[lnk.ASN]; !ok {
+			ixp.Prefixes[lnk.ASN] = p.conePrefixes(lnk.ASN)
+		}
+	}
+}
+
+// MemberPrefixes returns the prefixes of a family accepted from a member
+func (ixp *IXP) MemberPrefixes(asn int, v4 bool) []string {
+	res := make([]string, 0, len(ixp.Prefixes[asn]))
+	for _, entry := range ixp.Prefixes[asn] {
+		ip, _, err := net.ParseCIDR(strings.Fields(entry)[0])
+		if err == nil && (ip.To4() != nil) == v4 {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+// customerCone returns the AS numbers of asn and of its direct and indirect
+// customers, sorted
+func (p *Project) customerCone(asn int) []int {
+	cone := map[int]bool{asn: true}
+	queue := []int{asn}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, rel := range p.asRelations() {
+			next := 0
+			if rel.FromASN == cur && rel.To == Customer {
+				next = rel.ToASN
+			} else if rel.ToASN == cur && rel.From == Customer {
+				next = rel.FromASN
+			}
+			if next != 0 && !cone[next] {
+				cone[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	res := make([]int, 0, len(cone))
+	for n := range cone {
+		res = append(res, n)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// conePrefixes returns the prefix-list entries (prefix and optional length
+// range) of the prefixes originated by the customer cone of asn
+func (p *Project) conePrefixes(asn int) []string {
+	res := make([]string, 0, 4)
+	seen := make(map[string]bool, 4)
+	add := func(n net.IPNet, le bool) {
+		entry := n.String()
+		if le {
+			_, bits := n.Mask.Size()
+			entry += " le " + strconv.Itoa(bits)
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			res = append(res, entry)
+		}
+	}
+	for _, n := range p.customerCone(asn) {
+		a := p.AS[n]
+		if a.Network.IPNet != nil {
+			add(*a.Network.IPNet, true)
+		}
+		for _, r := range a.Routers {
+			for _, prefix := range r.Originated {
+				add(prefix, false)
+			}
+		}
+	}
+	return res
+}
+
+func (ixp *IXP) linkIXP() {
+	for i, rs := range ixp.RouteServers {
+		rs.Links = append(rs.Links, ixp.Links[i].Interface)
+	}
+	rmIn, rmOut := getRouteMaps(Peer, nil, nil) // PEER route-maps
+	afs := make(map[*ExternalLinkItem]AddressFamily, len(ixp.Members()))
+	// For each peer, we create an eBGP session between it and the route-servers
+	for _, lnk := range ixp.Members() {
+		// check which AF are in use (VPN routes are not exchanged at the IXP)
 		af := lnk.Router.NeighborsAF()
+		af.VPNv4, af.VPNv6 = false, false
+		// routers without other sessions use the family of the peering LAN
+		if !af.IPv4 && !af.IPv6 {
+			af.IPv4 = ixp.Network.IPNet.IP.To4() != nil
+			af.IPv6 = !af.IPv4
+		}
+		afs[lnk] = af
 
-		// Peer
 		lnk.Router.Links = append(lnk.Router.Links, lnk.Interface)
-		m, _ := ixp.RouteServer.Links[0].IP.Mask.Size()
-		lnk.Router.Neighbors[ixp.RouteServer.Links[0].IP.IP.String()] = &BGPNbr{
-			RemoteAS: ixp.ASN,
-			// UpdateSource: "lo",
-			NextHopSelf:  true,
-			AF:           af,
-			IfName:       lnk.Interface.IfName,
-			RouteMapsIn:  rmIn,
-			RouteMapsOut: rmOut,
-			Mask:         m,
-		}
-
-		// RS
-		m, _ = lnk.Interface.IP.Mask.Size()
-		ixp.RouteServer.Neighbors[lnk.Interface.IP.IP.String()] = &BGPNbr{
-			RemoteAS: lnk.ASN,
-			// UpdateSource: "lo",
-			IfName:   ixp.Links[0].Interface.IfName,
-			AF:       af,
-			RSClient: true,
-			Mask:     m,
-			// Default route-map needed for BGP to process routes
-			RouteMapsIn:  []string{"ALLOW_ALL"},
-			RouteMapsOut: []string{"ALLOW_ALL"},
+
+		// Default route-map needed for BGP to process routes
+		rsIn, rsOut := "ALLOW_ALL", "ALLOW_ALL"
+		if ixp.Filter || len(ixp.RPKI) > 0 {
+			rsIn = fmt.Sprintf("RS_IN_%d", lnk.ASN)
+		}
+		if ixp.Communities {
+			rsOut = fmt.Sprintf("RS_OUT_%d", lnk.ASN)
+		}
+
+		for i, rs := range ixp.RouteServers {
+			rsItf := ixp.Links[i].Interface
+
+			// Peer
+			m, _ := rsItf.IP.Mask.Size()
+			lnk.Router.Neighbors[rsItf.IP.IP.String()] = &BGPNbr{
+				RemoteAS: ixp.ASN,
+				// UpdateSource: "lo",
+				NextHopSelf:  true,
+				AF:           af,
+				IfName:       lnk.Interface.IfName,
+				RouteMapsIn:  rmIn,
+				RouteMapsOut: rmOut,
+				Mask:         m,
+			}
+
+			// RS
+			m, _ = lnk.Interface.IP.Mask.Size()
+			rs.Neighbors[lnk.Interface.IP.IP.String()] = &BGPNbr{
+				RemoteAS: lnk.ASN,
+				// UpdateSource: "lo",
+				IfName:       rsItf.IfName,
+				AF:           af,
+				RSClient:     true,
+				Mask:         m,
+				RouteMapsIn:  []string{rsIn},
+				RouteMapsOut: []string{rsOut},
+			}
+		}
+	}
+
+	// Bilateral sessions over the peering LAN
+	for _, b := range ixp.Bilateral {
+		ends := []struct {
+			local, remote *ExternalLinkItem
+			relation      int
+		}{
+			{b.From, b.To, b.ToRelation},
+			{b.To, b.From, b.FromRelation},
+		}
+		for _, e := range ends {
+			in, out := getRouteMaps(e.relation, nil, nil)
+			m, _ := e.remote.Interface.IP.Mask.Size()
+			e.local.Router.Neighbors[e.remote.Interface.IP.IP.String()] = &BGPNbr{
+				RemoteAS:     e.remote.ASN,
+				AF:           afs[e.local],
+				IfName:       e.local.Interface.IfName,
+				RouteMapsIn:  in,
+				RouteMapsOut: out,
+				Mask:         m,
+			}
+		}
+	}
+}
+
+func (p *Project) getIXP(asn int) *IXP {
+	for i := range p.IXPs {
+		if p.IXPs[i].ASN == asn {
+			return &p.IXPs[i]
+		}
+	}
+	utils.Fatalf("IXP %d does not exist\n", asn)
+	return nil
+}
+
+// attachHost connects a host to the peering LAN of the IXP
+func (ixp *IXP) attachHost(host *Host) *HostLinkItem {
+	item := NewHostLinkItem(host)
+	item.Interface.IP = ixp.Network.NextIP()
+	ixp.Hosts = append(ixp.Hosts, item)
+	return item
+}
+
+// checkRPKI checks that the RTR servers used by the route servers exist
+func (ixp *IXP) checkRPKI(servers map[string]RPKIServer) {
+	for _, name := range ixp.RPKI {
+		if _, ok := servers[name]; !ok {
+			utils.Fatalf("IXP %d: RPKI server %s does not exist\n", ixp.ASN, name)
 		}
 	}
 }
@@ -163,6 +469,20 @@ func (p *Project) ApplyIXPLinks() {
 			p.AllLinks[lnk.Router.ContainerName] = append(p.AllLinks[lnk.Router.ContainerName], hostIf)
 		}
 
+		for _, item := range ixp.Hosts {
+			settings := ovsdocker.DefaultParams()
+			hostIf := ovsdocker.OVSInterface{}
+
+			settings.Speed = item.Interface.Speed
+			settings.Host = true
+			settings.IP = item.Interface.IP.String()
+			link.AddPortToContainer(brName,
+				item.Interface.IfName,
+				item.Host.ContainerName,
+				settings, &hostIf, true)
+			p.AllLinks[item.Host.ContainerName] = append(p.AllLinks[item.Host.ContainerName], hostIf)
+		}
+
 	}
 }
 
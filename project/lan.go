@@ -0,0 +1,257 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/internal/link"
+	"github.com/rahveiz/topomate/internal/ovsdocker"
+	"github.com/rahveiz/topomate/utils"
+)
+
+const (
+	defaultLANLength4 = 24
+	defaultLANLength6 = 64
+	drPriority        = 255
+)
+
+// LAN represents a broadcast segment shared by several routers and hosts,
+// using a dedicated bridge
+type LAN struct {
+	Name         string
+	Subnet       net.IPNet
+	PrefixLength int
+	Routers      []*LinkItem
+	Hosts        []*HostLinkItem
+	MTU          int
+	// Default gateway of the hosts
+	Gateway  net.IP
+	nextHost net.IP
+}
+
+func (a *AutonomousSystem) newLAN(cfg config.LANConfig, noCost bool) *LAN {
+	if cfg.Name == "" {
+		utils.Fatalf("AS%d: LAN without name\n", a.ASN)
+	}
+	for _, l := range a.LANs {
+		if l.Name == cfg.Name {
+			utils.Fatalf("AS%d: duplicate LAN %s\n", a.ASN, cfg.Name)
+		}
+	}
+
+	lan := &LAN{
+		Name:         cfg.Name,
+		PrefixLength: cfg.PrefixLength,
+	}
+	if cfg.Prefix != "" {
+		_, n, err := net.ParseCIDR(cfg.Prefix)
+		if err != nil {
+			utils.Fatalln("LAN error:", err)
+		}
+		lan.Subnet = *n
+	} else if !a.Network.AutoAddress {
+		utils.Fatalf("AS%d: LAN %s needs a prefix\n", a.ASN, cfg.Name)
+	}
+	if lan.PrefixLength == 0 {
+		lan.PrefixLength = defaultLANLength4
+		if !a.Network.Is4() {
+			lan.PrefixLength = defaultLANLength6
+		}
+	}
+
+	// all the routers by default
+	routers := a.Routers
+	if len(cfg.Routers) > 0 {
+		routers = make([]*Router, len(cfg.Routers))
+		for i, name := range cfg.Routers {
+			routers[i] = a.getRouterByName(name)
+		}
+	}
+	var dr *Router
+	if cfg.DR != "" {
+		dr = a.getRouterByName(cfg.DR)
+	}
+
+	checkMTU(cfg.MTU, fmt.Sprintf("AS%d: LAN %s", a.ASN, cfg.Name))
+	lan.MTU = cfg.MTU
+
+	lan.Routers = make([]*LinkItem, len(routers))
+	for i, r := range routers {
+		item := NewLinkItem(r)
+		item.Interface.Description = "LAN " + cfg.Name
+		item.Interface.IGP.Broadcast = true
+		if r == dr {
+			item.Interface.IGP.Priority = drPriority
+		}
+		if cfg.Speed > 0 {
+			if noCost {
+				item.Interface.Speed = cfg.Speed
+			} else {
+				item.Interface.SetSpeedAndCost(cfg.Speed)
+			}
+		}
+		if noCost {
+			item.Interface.Cost = 0
+		}
+		if cfg.Cost > 0 {
+			item.Interface.Cost = cfg.Cost
+		}
+		lan.Routers[i] = item
+	}
+	return lan
+}
+
+// getLAN returns the LAN of the AS called name
+func (a *AutonomousSystem) getLAN(name string) *LAN {
+	for _, l := range a.LANs {
+		if l.Name == name {
+			return l
+		}
+	}
+	utils.Fatalf("AS%d: unknown LAN %s\n", a.ASN, name)
+	return nil
+}
+
+// reserveLANs addresses the routers of the LANs, in the order they are
+// listed. The first router is the default gateway of the hosts.
+func (a *AutonomousSystem) reserveLANs() {
+	for _, lan := range a.LANs {
+		if len(lan.Subnet.IP) == 0 {
+			lan.Subnet = a.Network.NextLargeSubnet(lan.PrefixLength)
+		}
+		lan.nextHost = lan.Subnet.IP
+		for _, item := range lan.Routers {
+			item.Interface.IP = lan.NextIP()
+		}
+		if len(lan.Routers) > 0 {
+			lan.Gateway = lan.Routers[0].Interface.IP.IP
+		}
+	}
+}
+
+// NextIP returns the next free address of the LAN
+func (lan *LAN) NextIP() net.IPNet {
+	lan.nextHost = cidr.Inc(lan.nextHost)
+	_, last := cidr.AddressRange(&lan.Subnet)
+	if !lan.Subnet.Contains(lan.nextHost) || (lan.Subnet.IP.To4() != nil && lan.nextHost.Equal(last)) {
+		utils.Fatalf("LAN %s: no more addresses available\n", lan.Name)
+	}
+	return net.IPNet{IP: lan.nextHost, Mask: lan.Subnet.Mask}
+}
+
+// linkLANs adds the LANs interfaces to the routers and, if ibgp is set,
+// iBGP sessions between all the routers of each LAN
+func (a *AutonomousSystem) linkLANs(ibgp bool, af AddressFamily) {
+	for _, lan := range a.LANs {
+		for _, item := range lan.Routers {
+			r := item.Router
+			if a.IGPType() == IGPISIS {
+				item.Interface.IGP.ISIS.Circuit = r.IGP.ISIS.Level
+			}
+			r.Links = append(r.Links, item.Interface)
+			if !ibgp {
+				continue
+			}
+			for _, other := range lan.Routers {
+				if other.Router == r {
+					continue
+				}
+				id := other.Interface.IP.IP.String()
+				if len(other.Router.Loopback) > 0 {
+					id = other.Router.Loopback[0].IP.String()
+				}
+				r.Neighbors[id] = &BGPNbr{
+					RemoteAS:     a.ASN,
+					UpdateSource: "lo",
+					ConnCheck:    false,
+					NextHopSelf:  true,
+					AF:           af,
+				}
+			}
+		}
+	}
+}
+
+func lanBridgeName(asn int, lan *LAN) string {
+	return fmt.Sprintf("lan-%d-%s", asn, strings.ReplaceAll(lan.Name, " ", "_"))
+}
+
+// ApplyLANs creates a bridge for each LAN, and attaches its routers and hosts
+func (p *Project) ApplyLANs() {
+	for n, as := range p.AS {
+		for _, lan := range as.LANs {
+			brName := lanBridgeName(n, lan)
+			link.CreateBridge(brName)
+			for _, item := range lan.Routers {
+				settings := ovsdocker.DefaultParams()
+				settings.Speed = item.Interface.Speed
+				settings.MTU = item.Interface.EffectiveMTU()
+				p.addLANPort(brName, item.Interface.IfName, item.Router.ContainerName, settings)
+			}
+			for _, item := range lan.Hosts {
+				settings := ovsdocker.DefaultParams()
+				settings.Speed = item.Interface.Speed
+				settings.MTU = item.Interface.EffectiveMTU()
+				settings.Host = true
+				settings.IP = item.Interface.IP.String()
+				if lan.Gateway != nil {
+					defaultRoute := "0.0.0.0/0"
+					if lan.Gateway.To4() == nil {
+						defaultRoute = "::/0"
+					}
+					settings.Routes = []ovsdocker.IPRoute{{
+						IP:     defaultRoute,
+						Via:    lan.Gateway.String(),
+						IfName: item.Interface.IfName,
+					}}
+				}
+				p.addLANPort(brName, item.Interface.IfName, item.Host.ContainerName, settings)
+			}
+		}
+	}
+}
+
+func (p *Project) addLANPort(brName, ifName, containerName string, settings ovsdocker.PortSettings) {
+	hostIf := ovsdocker.OVSInterface{}
+	link.AddPortToContainer(brName, ifName, containerName, settings, &hostIf, true)
+	if _, ok := p.AllLinks[containerName]; !ok {
+		p.AllLinks[containerName] = make([]ovsdocker.OVSInterface, 0, 4)
+	}
+	p.AllLinks[containerName] = append(p.AllLinks[containerName], hostIf)
+}
+
+// RemoveLANs removes the bridges of the LANs
+func (p *Project) RemoveLANs() {
+	for n, as := range p.AS {
+		for _, lan := range as.LANs {
+			link.DeleteBridge(lanBridgeName(n, lan))
+		}
+	}
+}
+
+// ExtraSubnets returns the subnets of the hosts and LANs connected to r that
+// are not part of the AS prefix
+func (a *AutonomousSystem) ExtraSubnets(r *Router) []net.IPNet {
+	res := make([]net.IPNet, 0, 2)
+	for _, lnk := range a.HostLinks {
+		subnet := lnk.Subnet()
+		if lnk.Router.Router == r && !a.Network.IPNet.Contains(subnet.IP) {
+			res = append(res, subnet)
+		}
+	}
+	for _, lan := range a.LANs {
+		if a.Network.IPNet.Contains(lan.Subnet.IP) {
+			continue
+		}
+		for _, item := range lan.Routers {
+			if item.Router == r {
+				res = append(res, lan.Subnet)
+				break
+			}
+		}
+	}
+	return res
+}
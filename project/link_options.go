@@ -0,0 +1,158 @@
+package project
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Names of the automatically generated interfaces, that cannot be used as
+// explicit interface names
+var autoIfName = regexp.MustCompile(`^eth[0-9]+$`)
+
+// setupLinkEnds applies the per-end options of a manual link. Options are
+// prefixed by first_ or second_ (e.g. first_ip), cost, mtu, passive and bfd
+// can also be set for both ends at once.
+func (a *AutonomousSystem) setupLinkEnds(l Link, opts map[string]string) {
+	for key := range opts {
+		switch strings.TrimPrefix(strings.TrimPrefix(key, "first_"), "second_") {
+		case "first", "second", "ip", "ifname", "description", "cost", "mtu", "passive", "bfd":
+		default:
+			utils.Fatalf("AS%d: unknown link option %s\n", a.ASN, key)
+		}
+	}
+
+	for _, end := range []struct {
+		prefix string
+		item   *LinkItem
+	}{
+		{"first_", l.First},
+		{"second_", l.Second},
+	} {
+		get := func(key string, shared bool) (string, bool) {
+			if v, ok := opts[end.prefix+key]; ok {
+				return v, true
+			}
+			if shared {
+				v, ok := opts[key]
+				return v, ok
+			}
+			return "", false
+		}
+		iface := end.item.Interface
+		hostname := end.item.Router.Hostname
+
+		if v, ok := get("ip", false); ok {
+			ip, n, err := net.ParseCIDR(v)
+			if err != nil {
+				utils.Fatalf("AS%d: invalid address %s for %s: %v\n", a.ASN, v, hostname, err)
+			}
+			iface.IP = net.IPNet{IP: ip, Mask: n.Mask}
+		}
+		if v, ok := get("ifname", false); ok {
+			a.checkIfName(end.item.Router, v)
+			iface.IfName = v
+		}
+		if v, ok := get("description", false); ok {
+			iface.Description = v
+		}
+		if v, ok := get("cost", true); ok {
+			cost, err := strconv.Atoi(v)
+			if err != nil {
+				utils.Fatalf("AS%d: invalid cost %s for %s\n", a.ASN, v, hostname)
+			}
+			iface.Cost = cost
+		}
+		if v, ok := get("mtu", true); ok {
+			mtu, err := strconv.Atoi(v)
+			if err != nil || mtu < 68 || mtu > 65535 {
+				utils.Fatalf("AS%d: invalid MTU %s for %s\n", a.ASN, v, hostname)
+			}
+			iface.MTU = mtu
+		}
+		if v, ok := get("passive", true); ok {
+			passive, err := strconv.ParseBool(v)
+			if err != nil {
+				utils.Fatalf("AS%d: invalid passive value %s for %s\n", a.ASN, v, hostname)
+			}
+			iface.IGP.Passive = passive
+			iface.IGP.ISIS.Passive = passive
+		}
+		if v, ok := get("bfd", true); ok {
+			bfd, err := strconv.ParseBool(v)
+			if err != nil {
+				utils.Fatalf("AS%d: invalid bfd value %s for %s\n", a.ASN, v, hostname)
+			}
+			if bfd {
+				iface.IGP.BFD = end.item.Router.useBFD(a.BFD)
+			} else {
+				iface.IGP.noBFD = true
+			}
+		}
+	}
+
+	// Explicit addresses are needed on both ends, in the same subnet
+	ip1, ip2 := l.First.Interface.IP, l.Second.Interface.IP
+	if len(ip1.IP) == 0 && len(ip2.IP) == 0 {
+		return
+	}
+	if len(ip1.IP) == 0 || len(ip2.IP) == 0 {
+		utils.Fatalf("AS%d: link %s-%s needs an address on both ends\n",
+			a.ASN, l.First.Router.Hostname, l.Second.Router.Hostname)
+	}
+	if !ip1.Contains(ip2.IP) || ip1.IP.Equal(ip2.IP) || ip1.Mask.String() != ip2.Mask.String() {
+		utils.Fatalf("AS%d: link %s-%s: %s and %s are not in the same subnet\n",
+			a.ASN, l.First.Router.Hostname, l.Second.Router.Hostname, ip1.String(), ip2.String())
+	}
+}
+
+// checkIfName checks that name is a valid Linux interface name that is not
+// already used on r
+func (a *AutonomousSystem) checkIfName(r *Router, name string) {
+	if len(name) == 0 || len(name) > 15 || strings.ContainsAny(name, "/: \t") {
+		utils.Fatalf("AS%d: invalid interface name %q for %s\n", a.ASN, name, r.Hostname)
+	}
+	if autoIfName.MatchString(name) || name == "lo" {
+		utils.Fatalf("AS%d: interface name %s of %s is reserved\n", a.ASN, name, r.Hostname)
+	}
+	if a.ifNames == nil {
+		a.ifNames = make(map[*Router]map[string]bool, len(a.Routers))
+	}
+	if a.ifNames[r] == nil {
+		a.ifNames[r] = make(map[string]bool, 1)
+	}
+	if a.ifNames[r][name] {
+		utils.Fatalf("AS%d: interface name %s is used twice on %s\n", a.ASN, name, r.Hostname)
+	}
+	a.ifNames[r][name] = true
+}
+
+// splitFields splits a line on spaces, keeping double-quoted values together
+func splitFields(line string) []string {
+	res := make([]string, 0, 8)
+	var cur strings.Builder
+	quoted, inField := false, false
+	for _, c := range line {
+		switch {
+		case c == '"':
+			quoted = !quoted
+			inField = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inField {
+				res = append(res, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(c)
+			inField = true
+		}
+	}
+	if inField {
+		res = append(res, cur.String())
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+package project
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rahveiz/topomate/utils"
+)
+
+// DefaultMTU is used on the interfaces without explicit MTU
+const DefaultMTU = 1500
+
+func checkMTU(mtu int, where string) {
+	if mtu != 0 && (mtu < 68 || mtu > 65535) {
+		utils.Fatalf("%s: invalid MTU %d\n", where, mtu)
+	}
+}
+
+// EffectiveMTU returns the MTU of the interface, or DefaultMTU if not set
+func (l *NetInterface) EffectiveMTU() int {
+	if l.MTU > 0 {
+		return l.MTU
+	}
+	return DefaultMTU
+}
+
+// setLinksMTU sets the MTU of the internal links interfaces without explicit
+// MTU, using the links MTU or the AS one
+func (a *AutonomousSystem) setLinksMTU(mtu int) {
+	if mtu == 0 {
+		mtu = a.MTU
+	}
+	if mtu == 0 {
+		return
+	}
+	for _, lnk := range a.Links {
+		for _, item := range []*LinkItem{lnk.First, lnk.Second} {
+			if item.Interface.MTU == 0 {
+				item.Interface.MTU = mtu
+			}
+		}
+	}
+	for _, lan := range a.LANs {
+		if lan.MTU == 0 {
+			lan.MTU = mtu
+		}
+		for _, item := range lan.Routers {
+			item.Interface.MTU = lan.MTU
+		}
+	}
+}
+
+// MTUMismatches returns a description of the OSPF adjacencies whose ends do
+// not use the same MTU (they would be stuck in ExStart state)
+func (p *Project) MTUMismatches() []string {
+	res := make([]string, 0)
+	for n, as := range p.AS {
+		if as.IGPType() != IGPOSPF {
+			continue
+		}
+		for _, lnk := range as.Links {
+			if lnk.First.Interface.External || lnk.Second.Interface.External {
+				continue
+			}
+			m1 := lnk.First.Interface.EffectiveMTU()
+			m2 := lnk.Second.Interface.EffectiveMTU()
+			if m1 != m2 {
+				res = append(res, fmt.Sprintf("AS%d: MTU mismatch between %s (%s, %d) and %s (%s, %d)",
+					n,
+					lnk.First.Router.Hostname, lnk.First.Interface.IfName, m1,
+					lnk.Second.Router.Hostname, lnk.Second.Interface.IfName, m2,
+				))
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"math"
+	"math/big"
 	"net"
 
 	"github.com/apparentlymart/go-cidr/cidr"
@@ -149,3 +150,38 @@ func (n Net) CheckPrefix(prefixLen int) (int, bool) {
 	m, max := n.IPNet.Mask.Size()
 	return m, !(prefixLen < m || prefixLen > max)
 }
+
+// NextLargeSubnet returns the next available subnet of length prefixLen,
+// that must be shorter than the links ones. The link subnets skipped to
+// align the result are lost.
+func (n *Net) NextLargeSubnet(prefixLen int) net.IPNet {
+	linkLen, max := n.NextAvailable.Mask.Size()
+	if prefixLen > linkLen {
+		utils.Fatalf("Network %s: subnet length %d longer than links ones\n", n.IPNet.String(), prefixLen)
+	}
+	if n.AvailableSubnets < 1 {
+		utils.Fatalf("Network %s: no more subnets of size %d available\n", n.IPNet.String(), prefixLen)
+	}
+
+	mask := net.CIDRMask(prefixLen, max)
+	res := net.IPNet{IP: n.NextAvailable.IP.Mask(mask), Mask: mask}
+	if !res.IP.Equal(n.NextAvailable.IP) {
+		next, full := cidr.NextSubnet(&res, prefixLen)
+		if full {
+			utils.Fatalf("Network %s: no more subnets of size %d available\n", n.IPNet.String(), prefixLen)
+		}
+		res = *next
+	}
+	_, last := cidr.AddressRange(&res)
+	if !n.IPNet.Contains(res.IP) || !n.IPNet.Contains(last) {
+		utils.Fatalf("Network %s: no more subnets of size %d available\n", n.IPNet.String(), prefixLen)
+	}
+
+	// count the link subnets consumed
+	start := new(big.Int).SetBytes(n.NextAvailable.IP.To16())
+	end := new(big.Int).SetBytes(cidr.Inc(last).To16())
+	used := new(big.Int).Rsh(new(big.Int).Sub(end, start), uint(max-linkLen))
+	n.AvailableSubnets -= int(used.Int64())
+	n.NextAvailable = &net.IPNet{IP: cidr.Inc(last), Mask: n.NextAvailable.Mask}
+	return res
+}
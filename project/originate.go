@@ -0,0 +1,119 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// Methods used to originate additional prefixes
+const (
+	OriginateNetwork      = "network"
+	OriginateRedistribute = "redistribute"
+)
+
+// maxOriginated is the maximum number of prefixes originated by an AS
+const maxOriginated = 100000
+
+var communityRegex = regexp.MustCompile(`^(\d+:\d+|no-export|no-advertise|local-AS|no-peer|blackhole|graceful-shutdown)$`)
+
+// Originate contains the attributes of the additional prefixes originated
+// by an AS
+type Originate struct {
+	Redistribute bool
+	Communities  []string
+	MED          int
+	HasMED       bool
+}
+
+// parseOriginate sets the additional prefixes originated by the routers of
+// the AS
+func (a *AutonomousSystem) parseOriginate(cfg *config.OriginateConfig) {
+	if cfg == nil {
+		return
+	}
+	where := fmt.Sprintf("AS%d: originate", a.ASN)
+
+	prefixes := make([]net.IPNet, 0, len(cfg.Prefixes))
+	for _, p := range cfg.Prefixes {
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			utils.Fatalln(where+":", err)
+		}
+		prefixes = append(prefixes, *n)
+	}
+	if gen := cfg.Generate; gen != nil {
+		// The AS prefix cannot be used, the generated prefixes would
+		// overlap the subnets of the links, LANs and hosts
+		if gen.Parent == "" {
+			utils.Fatalf("%s: no parent prefix\n", where)
+		}
+		_, parent, err := net.ParseCIDR(gen.Parent)
+		if err != nil {
+			utils.Fatalln(where+":", err)
+		}
+		if n := a.Network.IPNet; n != nil && (n.Contains(parent.IP) || parent.Contains(n.IP)) {
+			utils.Fatalf("%s: parent %s overlaps the AS prefix %s\n", where, parent, n)
+		}
+		ones, bits := parent.Mask.Size()
+		if gen.Length < ones || gen.Length > bits {
+			utils.Fatalf("%s: invalid length %d for %s\n", where, gen.Length, parent)
+		}
+		if gen.Count <= 0 || gen.Count > maxOriginated ||
+			(gen.Length-ones < 20 && gen.Count > 1<<uint(gen.Length-ones)) {
+			utils.Fatalf("%s: cannot generate %d /%d in %s\n", where, gen.Count, gen.Length, parent)
+		}
+		for i := 0; i < gen.Count; i++ {
+			n, err := cidr.Subnet(parent, gen.Length-ones, i)
+			if err != nil {
+				utils.Fatalln(where+":", err)
+			}
+			prefixes = append(prefixes, *n)
+		}
+	}
+	if len(prefixes) == 0 {
+		utils.Fatalf("%s: no prefix\n", where)
+	}
+	if len(prefixes) > maxOriginated {
+		utils.Fatalf("%s: too many prefixes (%d)\n", where, len(prefixes))
+	}
+
+	switch strings.ToLower(cfg.Method) {
+	case "", OriginateNetwork:
+		break
+	case OriginateRedistribute:
+		a.BGP.Originate.Redistribute = true
+		break
+	default:
+		utils.Fatalf("%s: unknown method %s\n", where, cfg.Method)
+	}
+	for _, c := range cfg.Communities {
+		if !communityRegex.MatchString(c) {
+			utils.Fatalf("%s: invalid community %s\n", where, c)
+		}
+	}
+	a.BGP.Originate.Communities = cfg.Communities
+	if cfg.MED != nil {
+		if *cfg.MED < 0 {
+			utils.Fatalf("%s: invalid MED %d\n", where, *cfg.MED)
+		}
+		a.BGP.Originate.MED = *cfg.MED
+		a.BGP.Originate.HasMED = true
+	}
+
+	routers := a.Routers
+	if len(cfg.Routers) > 0 {
+		routers = make([]*Router, len(cfg.Routers))
+		for i, id := range cfg.Routers {
+			routers[i] = a.getRouter(id)
+		}
+	}
+	for _, r := range routers {
+		r.Originated = prefixes
+	}
+}
@@ -18,10 +18,12 @@ import (
 )
 
 type AddressFamily struct {
-	IPv4  bool
-	IPv6  bool
-	VPNv4 bool
-	VPNv6 bool
+	IPv4           bool
+	IPv6           bool
+	VPNv4          bool
+	VPNv6          bool
+	LabeledUnicast bool
+	EVPN           bool
 }
 
 // BGPNbr represents a neighbor configuration for a given router
@@ -36,7 +38,29 @@ type BGPNbr struct {
 	AF           AddressFamily
 	RRClient     bool
 	RSClient     bool
-	Mask         int
+	ASOverride   bool
+	AllowASIn    int
+	EBGPMultihop int
+	// VPN address-families settings
+	NextHopSelfVPN   bool
+	NextHopUnchanged bool
+	Mask             int
+	// BFD profile used by the session, if any
+	BFD string
+	// Optional session settings
+	Keepalive       int
+	Hold            int
+	MaxPrefix       int
+	Password        string
+	LocalAS         int
+	RemovePrivateAS bool
+	SendCommunity   string
+	// ConfedAS is the sub-AS of the neighbor if it is in another member of
+	// the confederation
+	ConfedAS int
+	// LeakFrom lists the AS whose routes are leaked to the neighbor, 0
+	// meaning all the routes
+	LeakFrom []int
 }
 
 type OSPFNet struct {
@@ -51,11 +75,27 @@ type Router struct {
 	Hostname      string
 	ContainerName string
 	CustomImage   string
+	// Daemon is the routing daemon of the router (FRR by default)
+	Daemon        string
 	Loopback      []net.IPNet
 	Links         []*NetInterface
 	Neighbors     map[string]*BGPNbr
+	VRFNeighbors  map[string]map[string]*BGPNbr
 	NextInterface int
-	IGP           struct {
+	// Loopbacks of other AS reachable using BGP labeled-unicast, that need
+	// to be redistributed in the IGP
+	InterASLoopbacks []net.IPNet
+	// ClusterID is set on route reflectors of redundant clusters
+	ClusterID string
+	// SubAS is the confederation member the router belongs to, if any
+	SubAS       int
+	BFDProfiles map[string]*BFD
+	BFDPeers    []BFDPeer
+	// Prefixes of other AS originated by the router
+	Hijacked []net.IPNet
+	// Additional prefixes of the AS originated by the router
+	Originated []net.IPNet
+	IGP        struct {
 		ISIS struct {
 			Level int
 			Area  int
@@ -72,6 +112,17 @@ func (r *Router) LoID() string {
 	return r.Loopback[0].IP.String()
 }
 
+// RouterID returns the first IPv4 loopback of the router, or an ID built
+// from the AS number and the router ID
+func (r *Router) RouterID(asn int) net.IP {
+	for _, lo := range r.Loopback {
+		if lo.IP.To4() != nil {
+			return lo.IP
+		}
+	}
+	return net.IPv4(byte(asn>>16), byte(asn>>8), byte(asn), byte(r.ID))
+}
+
 func (r *Router) LoInfo() (string, int) {
 	if len(r.Loopback) == 0 {
 		return "", 0
@@ -88,12 +139,12 @@ func (r *Router) NeighborsAF() (af AddressFamily) {
 		if !af.IPv6 && nbr.AF.IPv6 {
 			af.IPv6 = true
 		}
-		// if !af.VPNv4 && nbr.AF.VPNv4 {
-		// 	af.VPNv4 = true
-		// }
-		// if !af.VPNv6 && nbr.AF.VPNv6 {
-		// 	af.VPNv6 = true
-		// }
+		if !af.VPNv4 && nbr.AF.VPNv4 {
+			af.VPNv4 = true
+		}
+		if !af.VPNv6 && nbr.AF.VPNv6 {
+			af.VPNv6 = true
+		}
 	}
 	return
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,6 +23,34 @@ type rpkiSource struct {
 	Roas []roaEntry `json:"roas"`
 }
 
+// RPKI origin validation policies
+const (
+	RPKIOff         = "off"
+	RPKITag         = "tag"
+	RPKIPreferValid = "prefer-valid"
+	RPKIDropInvalid = "drop-invalid"
+)
+
+// setRPKIPolicy sets the origin validation policy applied on the eBGP
+// sessions of the AS. The tag policy only adds the validation communities.
+func (a *AutonomousSystem) setRPKIPolicy(policy string, tag bool) {
+	switch policy {
+	case "":
+		policy = RPKIOff
+	case RPKIOff, RPKITag, RPKIPreferValid, RPKIDropInvalid:
+	default:
+		utils.Fatalf("AS%d: unknown RPKI policy %s\n", a.ASN, policy)
+	}
+	if policy != RPKIOff && len(a.RPKI.Servers) == 0 {
+		utils.Fatalf("AS%d: RPKI policy %s needs RPKI servers\n", a.ASN, policy)
+	}
+	if tag && policy == RPKIOff {
+		utils.Fatalf("AS%d: RPKI tagging needs an RPKI policy\n", a.ASN)
+	}
+	a.RPKI.Policy = policy
+	a.RPKI.Tag = tag || policy == RPKITag
+}
+
 func (p *Project) parseRPKIConfig(rpkiConfig map[string]config.RPKIConfig) {
 	p.RPKI = make(map[string]RPKIServer, len(rpkiConfig))
 	for hostname, cfg := range rpkiConfig {
@@ -32,31 +61,47 @@ func (p *Project) parseRPKIConfig(rpkiConfig map[string]config.RPKIConfig) {
 			DockerImage:   config.DockerRTRImage,
 		}
 
-		currentAS := p.AS[cfg.RouterLink.ASN]
-		router := currentAS.getRouter(cfg.RouterLink.RouterID)
+		var rtrIP net.IP
+		if cfg.RouterLink.IXP != 0 {
+			// RTR server on the peering LAN of an IXP
+			ixp := p.getIXP(cfg.RouterLink.IXP)
+			rtr.ContainerName = "IXP-" + strconv.Itoa(ixp.ASN) + "-" + hostname
+			rtrIP = ixp.attachHost(rtr).Interface.IP.IP
+		} else {
+			currentAS := p.AS[cfg.RouterLink.ASN]
+			router := currentAS.getRouter(cfg.RouterLink.RouterID)
 
-		// Create a link between the router and the RTR
+			// Create a link between the router and the RTR
 
-		linkRouter := NewLinkItem(router)
-		linkRouter.Interface.Description = "linked to " + hostname
-		linkRouter.Interface.External = true // no iBGP
+			linkRouter := NewLinkItem(router)
+			linkRouter.Interface.Description = "linked to " + hostname
+			linkRouter.Interface.External = true // no iBGP
 
-		linkRTR := NewHostLinkItem(rtr)
+			linkRTR := NewHostLinkItem(rtr)
 
-		linkRTR.Interface.IP, linkRouter.Interface.IP = currentAS.Network.NextLinkIPs()
+			linkRTR.Interface.IP, linkRouter.Interface.IP = currentAS.Network.NextLinkIPs()
 
-		currentAS.HostLinks = append(currentAS.HostLinks, HostLink{
-			Router: linkRouter,
-			Host:   linkRTR,
-		})
+			currentAS.HostLinks = append(currentAS.HostLinks, HostLink{
+				Router: linkRouter,
+				Host:   linkRTR,
+			})
+			currentAS.Hosts = append(currentAS.Hosts, rtr)
+			router.Links = append(router.Links, linkRouter.Interface)
+			rtrIP = linkRTR.Interface.IP.IP
+		}
 
 		var cachePath string
 		// generate ROA
-		if cfg.ROAs != nil {
-
+		if cfg.ROAs.Auto || cfg.ROAs.Entries != nil {
+			roas := cfg.ROAs.Entries
+			if cfg.ROAs.Auto {
+				roas = p.autoROAs(cfg)
+			} else if len(cfg.Overrides) > 0 || cfg.MaxLength > 0 {
+				utils.Fatalf("RPKI Server %s: max_length and overrides need roas: auto\n", hostname)
+			}
 			filename := fmt.Sprintf("%s/rpki_%s.json",
 				utils.GetDirectoryFromKey("ConfigDir", ""), hostname)
-			generateRPKICache(cfg.ROAs, filename)
+			generateRPKICache(roas, filename)
 			cachePath = filename
 		} else {
 			// no roa entry, search for file
@@ -71,17 +116,63 @@ func (p *Project) parseRPKIConfig(rpkiConfig map[string]config.RPKIConfig) {
 			ContainerPath: "/rpki.json",
 		}}
 
-		currentAS.Hosts = append(currentAS.Hosts, rtr)
-
-		router.Links = append(router.Links, linkRouter.Interface)
 		// p.addRPKIentry(hostname, linkRTR.Interface.IP.IP)
 		p.RPKI[hostname] = RPKIServer{
-			IP:   linkRTR.Interface.IP.IP.String(),
+			IP:   rtrIP.String(),
 			Port: 8083,
 		}
 	}
 }
 
+// autoROAs returns one ROA per AS prefix, modified by the overrides of cfg
+func (p *Project) autoROAs(cfg config.RPKIConfig) []config.ROA {
+	overrides := make(map[int]config.ROAOverride, len(cfg.Overrides))
+	for _, o := range cfg.Overrides {
+		if _, ok := p.AS[o.ASN]; !ok {
+			utils.Fatalf("ROA override error: AS%d does not exist\n", o.ASN)
+		}
+		if _, ok := overrides[o.ASN]; ok {
+			utils.Fatalf("ROA override error: AS%d is overridden twice\n", o.ASN)
+		}
+		overrides[o.ASN] = o
+	}
+
+	asns := make([]int, 0, len(p.AS))
+	for n := range p.AS {
+		asns = append(asns, n)
+	}
+	sort.Ints(asns)
+
+	res := make([]config.ROA, 0, len(asns))
+	for _, n := range asns {
+		a := p.AS[n]
+		if a.Network.IPNet == nil {
+			continue
+		}
+		roa := config.ROA{
+			Prefix:    a.Network.IPNet.String(),
+			MaxLength: cfg.MaxLength,
+			ASN:       n,
+		}
+		if o, ok := overrides[n]; ok {
+			if o.Missing {
+				continue
+			}
+			if o.Origin > 0 {
+				roa.ASN = o.Origin
+			}
+			if o.MaxLength > 0 {
+				roa.MaxLength = o.MaxLength
+			}
+		}
+		if length, _ := a.Network.IPNet.Mask.Size(); roa.MaxLength < length {
+			roa.MaxLength = length
+		}
+		res = append(res, roa)
+	}
+	return res
+}
+
 func generateRPKICache(src []config.ROA, path string) {
 	cache := rpkiSource{
 		Roas: make([]roaEntry, 0, len(src)),
@@ -0,0 +1,214 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rahveiz/topomate/utils"
+)
+
+// setClusterID sets the cluster-id of a route reflector. It can be an IPv4
+// address or a 32 bits integer.
+func (a *AutonomousSystem) setClusterID(r *Router, id string) {
+	if id == "" {
+		return
+	}
+	if ip := net.ParseIP(id); ip == nil || ip.To4() == nil {
+		if _, err := strconv.ParseUint(id, 10, 32); err != nil {
+			utils.Fatalf("AS%d: invalid cluster-id %s for %s\n", a.ASN, id, r.Hostname)
+		}
+	}
+	if r.ClusterID != "" && r.ClusterID != id {
+		utils.Fatalf("AS%d: %s has several cluster-ids (%s, %s)\n", a.ASN, r.Hostname, r.ClusterID, id)
+	}
+	r.ClusterID = id
+}
+
+// clusterID returns the cluster-id used by r when reflecting routes (its
+// router-id if not set)
+func (r *Router) clusterID() string {
+	if r.ClusterID != "" {
+		return r.ClusterID
+	}
+	return r.LoID()
+}
+
+// isRR returns true if r has route reflector clients
+func (r *Router) isRR() bool {
+	for _, nbr := range r.Neighbors {
+		if nbr.RRClient {
+			return true
+		}
+	}
+	return false
+}
+
+// meshRouteReflectors connects the top-level route reflectors (the ones that
+// are not clients of another reflector) in a full mesh
+func (a *AutonomousSystem) meshRouteReflectors(af AddressFamily) {
+	top := make([]*Router, 0, 4)
+	for _, r := range a.Routers {
+		if !r.isRR() {
+			continue
+		}
+		client := false
+		for _, other := range a.Routers {
+			if nbr, ok := other.Neighbors[r.LoID()]; ok && nbr.RRClient {
+				client = true
+				break
+			}
+		}
+		if !client {
+			top = append(top, r)
+		}
+	}
+	for _, r := range top {
+		for _, n := range top {
+			if r == n {
+				continue
+			}
+			id, mask := n.LoInfo()
+			if _, ok := r.Neighbors[id]; ok {
+				continue
+			}
+			r.Neighbors[id] = &BGPNbr{
+				RemoteAS:     a.ASN,
+				UpdateSource: "lo",
+				NextHopSelf:  true,
+				AF:           af,
+				Mask:         mask,
+			}
+		}
+	}
+}
+
+// ibgpPeers returns the unicast iBGP neighbors of r, with a flag set if the
+// neighbor is a route reflector client of r
+func (a *AutonomousSystem) ibgpPeers(r *Router) map[*Router]bool {
+	res := make(map[*Router]bool, len(r.Neighbors))
+	for ip, nbr := range r.Neighbors {
+		if nbr.RemoteAS != a.ASN || !(nbr.AF.IPv4 || nbr.AF.IPv6) {
+			continue
+		}
+		for _, n := range a.Routers {
+			if n.hasAddress(ip) {
+				res[n] = nbr.RRClient
+				break
+			}
+		}
+	}
+	return res
+}
+
+// IBGPIssues checks the iBGP sessions of the AS, and returns a description
+// of the routers without iBGP session, of the sessions configured on one
+// side only and of the routers that cannot learn the routes of another
+// router (following the route reflection rules and cluster-ids).
+func (a *AutonomousSystem) IBGPIssues() []string {
+	res := make([]string, 0)
+	if a.BGP.Disabled || len(a.Routers) < 2 {
+		return res
+	}
+
+	peers := make(map[*Router]map[*Router]bool, len(a.Routers))
+	for _, r := range a.Routers {
+		peers[r] = a.ibgpPeers(r)
+		if len(peers[r]) == 0 {
+			res = append(res, fmt.Sprintf("AS%d: %s has no iBGP session", a.ASN, r.Hostname))
+		}
+	}
+	for _, r := range a.Routers {
+		for n := range peers[r] {
+			if _, ok := peers[n][r]; !ok {
+				res = append(res, fmt.Sprintf("AS%d: iBGP session %s -> %s is not configured on %s",
+					a.ASN, r.Hostname, n.Hostname, n.Hostname))
+			}
+		}
+	}
+
+	for _, origin := range a.Routers {
+		seen := a.propagate(origin, peers)
+		missing := make([]string, 0)
+		for _, r := range a.Routers {
+			if r != origin && !seen[r] {
+				missing = append(missing, r.Hostname)
+			}
+		}
+		if len(missing) > 0 {
+			res = append(res, fmt.Sprintf("AS%d: routes of %s are not received by %s",
+				a.ASN, origin.Hostname, strings.Join(missing, ", ")))
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+const (
+	learnedOrigin = iota
+	learnedClient
+	learnedNonClient
+	// learned from another confederation member
+	learnedConfed
+)
+
+// propagate returns the routers receiving a route originated by origin
+func (a *AutonomousSystem) propagate(origin *Router, peers map[*Router]map[*Router]bool) map[*Router]bool {
+	type state struct {
+		router   *Router
+		learned  int
+		clusters string
+	}
+	seen := make(map[*Router]bool, len(a.Routers))
+	visited := make(map[state]bool)
+	queue := []state{{origin, learnedOrigin, ""}}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		if visited[cur] {
+			continue
+		}
+		visited[cur] = true
+
+		clusters := cur.clusters
+		external := cur.learned == learnedOrigin || cur.learned == learnedConfed
+		if !external {
+			// the route is reflected
+			clusters += "|" + cur.router.clusterID() + "|"
+		}
+		for n, client := range peers[cur.router] {
+			// originator-id (or AS path) loop check
+			if n == origin {
+				continue
+			}
+			// confederation eBGP sessions receive all the best routes
+			if n.SubAS != cur.router.SubAS {
+				seen[n] = true
+				queue = append(queue, state{n, learnedConfed, ""})
+				continue
+			}
+			// routes from non-clients are only reflected to clients
+			if cur.learned == learnedNonClient && !client {
+				continue
+			}
+			// cluster-list loop check
+			if strings.Contains(clusters, "|"+n.clusterID()+"|") {
+				continue
+			}
+			// only reflectors can send routes learned using iBGP
+			if !external && !cur.router.isRR() {
+				continue
+			}
+			seen[n] = true
+			learned := learnedNonClient
+			if peers[n][cur.router] {
+				learned = learnedClient
+			}
+			queue = append(queue, state{n, learned, clusters})
+		}
+	}
+	return seen
+}
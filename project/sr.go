@@ -0,0 +1,144 @@
+package project
+
+import (
+	"fmt"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+const (
+	defaultSRGBLower = 16000
+	defaultSRGBUpper = 23999
+)
+
+// SRSegmentList is an explicit path, described as an ordered list of routers
+// whose node SIDs are pushed by the headend
+type SRSegmentList struct {
+	Name       string
+	Preference int
+	Hops       []*Router
+}
+
+// SRPolicy represents a SR-TE policy configured on its headend router
+type SRPolicy struct {
+	Name         string
+	Color        int
+	BindingSID   int
+	ColorRoutes  bool
+	Headend      *Router
+	Endpoint     *Router
+	SegmentLists []SRSegmentList
+}
+
+// SegmentRouting contains the segment routing settings of an AS
+type SegmentRouting struct {
+	Enabled  bool
+	SRGB     [2]int
+	Policies []SRPolicy
+}
+
+// NodeIndex returns the node SID index of a router (its ID by default)
+func (sr *SegmentRouting) NodeIndex(r *Router) int {
+	return r.ID
+}
+
+// NodeLabel returns the MPLS label matching the node SID of a router
+func (sr *SegmentRouting) NodeLabel(r *Router) int {
+	return sr.SRGB[0] + sr.NodeIndex(r)
+}
+
+// PoliciesFor returns the SR-TE policies having r as headend
+func (sr *SegmentRouting) PoliciesFor(r *Router) []SRPolicy {
+	res := make([]SRPolicy, 0, len(sr.Policies))
+	for _, p := range sr.Policies {
+		if p.Headend == r {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// getRouterByName returns the router matching the hostname name. If no router
+// is found, name is interpreted as a router number.
+func (a *AutonomousSystem) getRouterByName(name string) *Router {
+	for _, r := range a.Routers {
+		if r.Hostname == name {
+			return r
+		}
+	}
+	return a.getRouter(name)
+}
+
+func (a *AutonomousSystem) parseSR(cfg config.SRConfig) {
+	if !cfg.Enabled && len(cfg.Policies) == 0 {
+		return
+	}
+	if a.IGPType() == IGPUndef {
+		utils.Fatalf("AS%d: segment routing requires OSPF or IS-IS\n", a.ASN)
+	}
+
+	a.SR.Enabled = true
+	a.SR.SRGB = [2]int{defaultSRGBLower, defaultSRGBUpper}
+	if cfg.GlobalBlock != nil {
+		if len(cfg.GlobalBlock) != 2 || cfg.GlobalBlock[0] >= cfg.GlobalBlock[1] {
+			utils.Fatalf("AS%d: invalid segment routing global block %v\n", a.ASN, cfg.GlobalBlock)
+		}
+		a.SR.SRGB = [2]int{cfg.GlobalBlock[0], cfg.GlobalBlock[1]}
+	}
+	if a.SR.SRGB[0]+len(a.Routers) > a.SR.SRGB[1] {
+		utils.Fatalf("AS%d: segment routing global block too small for %d routers\n", a.ASN, len(a.Routers))
+	}
+
+	for _, r := range a.Routers {
+		if r.LoID() == "" {
+			utils.Fatalf("AS%d: segment routing requires a loopback on %s\n", a.ASN, r.Hostname)
+		}
+	}
+
+	a.SR.Policies = make([]SRPolicy, len(cfg.Policies))
+	for i, p := range cfg.Policies {
+		if p.Color < 1 {
+			utils.Fatalf("AS%d: SR-TE policy %d must have a positive color\n", a.ASN, i+1)
+		}
+		policy := SRPolicy{
+			Name:         p.Name,
+			Color:        p.Color,
+			BindingSID:   p.BindingSID,
+			ColorRoutes:  p.ColorRoutes,
+			Headend:      a.getRouterByName(p.Headend),
+			Endpoint:     a.getRouterByName(p.Endpoint),
+			SegmentLists: make([]SRSegmentList, len(p.SegmentLists)),
+		}
+		if policy.Name == "" {
+			policy.Name = fmt.Sprintf("%s-%s-%d",
+				policy.Headend.Hostname, policy.Endpoint.Hostname, policy.Color)
+		}
+		if policy.Headend == policy.Endpoint {
+			utils.Fatalf("AS%d: SR-TE policy %s has the same headend and endpoint\n", a.ASN, policy.Name)
+		}
+
+		for j, sl := range p.SegmentLists {
+			if len(sl.Hops) == 0 {
+				utils.Fatalf("AS%d: SR-TE policy %s: empty segment list\n", a.ASN, policy.Name)
+			}
+			segments := SRSegmentList{
+				Name:       sl.Name,
+				Preference: sl.Preference,
+				Hops:       make([]*Router, len(sl.Hops)),
+			}
+			if segments.Name == "" {
+				segments.Name = fmt.Sprintf("%s-SL%d", policy.Name, j+1)
+			}
+			// Higher preference wins, so the first list is preferred by default
+			if segments.Preference == 0 {
+				segments.Preference = 100 * (len(p.SegmentLists) - j)
+			}
+			for k, hop := range sl.Hops {
+				segments.Hops[k] = a.getRouterByName(hop)
+			}
+			policy.SegmentLists[j] = segments
+		}
+		a.SR.Policies[i] = policy
+	}
+}
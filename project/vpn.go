@@ -0,0 +1,134 @@
+package project
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rahveiz/topomate/config"
+	"github.com/rahveiz/topomate/utils"
+)
+
+// checkVPNIdentifier checks that s is a valid route distinguisher or route
+// target, in the ASN:NN or IP:NN form
+func checkVPNIdentifier(s string) error {
+	idx := strings.LastIndex(s, ":")
+	if idx < 1 || idx == len(s)-1 {
+		return fmt.Errorf("%s: must be in the ASN:NN or IP:NN form", s)
+	}
+	admin, assigned := s[:idx], s[idx+1:]
+
+	// 2-bytes ASNs allow a 4-bytes assigned number, IPs and 4-bytes ASNs
+	// only 2 bytes
+	bits := 16
+	if ip := net.ParseIP(admin); ip != nil {
+		if ip.To4() == nil {
+			return fmt.Errorf("%s: administrator must be an IPv4 address", s)
+		}
+	} else {
+		asn, err := strconv.ParseUint(admin, 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s: invalid administrator %s", s, admin)
+		}
+		if asn <= 65535 {
+			bits = 32
+		}
+	}
+	if _, err := strconv.ParseUint(assigned, 10, bits); err != nil {
+		return fmt.Errorf("%s: invalid assigned number %s", s, assigned)
+	}
+	return nil
+}
+
+// setupVPNIdentifiers sets the route distinguishers and route targets of the
+// VPNs of the AS. Values that are not provided in the configuration are
+// allocated automatically in the <ASN>:<n> form.
+func (a *AutonomousSystem) setupVPNIdentifiers(cfgs []config.VPNConfig) {
+	usedRD := make(map[string]bool, len(cfgs))
+	usedRT := make(map[string]bool, len(cfgs))
+	for _, c := range cfgs {
+		usedRD[c.RD] = true
+		for _, rt := range append(c.ImportRT, c.ExportRT...) {
+			usedRT[rt] = true
+		}
+	}
+
+	nextRD, nextRT := 1, 1
+	allocate := func(used map[string]bool, next *int) string {
+		for {
+			v := fmt.Sprintf("%d:%d", a.ASN, *next)
+			*next++
+			if !used[v] {
+				used[v] = true
+				return v
+			}
+		}
+	}
+
+	for idx, c := range cfgs {
+		vpn := &a.VPN[idx]
+		for _, v := range append([]string{c.RD}, append(c.ImportRT, c.ExportRT...)...) {
+			if v == "" {
+				continue
+			}
+			if err := checkVPNIdentifier(v); err != nil {
+				utils.Fatalf("AS%d: VRF %s: %v\n", a.ASN, c.VRF, err)
+			}
+		}
+
+		if c.RD != "" {
+			vpn.RD = c.RD
+		} else {
+			vpn.RD = allocate(usedRD, &nextRD)
+		}
+		if vpn.IsHubAndSpoke() {
+			vpn.DownRD = allocate(usedRD, &nextRD)
+		}
+
+		// Route targets are given from the spokes point of view in
+		// hub-and-spoke VPNs, so they must be different
+		switch {
+		case c.ImportRT == nil && c.ExportRT == nil:
+			rt := allocate(usedRT, &nextRT)
+			vpn.ImportRT = []string{rt}
+			if vpn.IsHubAndSpoke() {
+				vpn.ExportRT = []string{allocate(usedRT, &nextRT)}
+			} else {
+				vpn.ExportRT = []string{rt}
+			}
+		case vpn.IsHubAndSpoke() && (c.ImportRT == nil || c.ExportRT == nil):
+			utils.Fatalf("AS%d: VRF %s: hub-and-spoke VPNs need both import and export route-targets\n",
+				a.ASN, c.VRF)
+		case c.ImportRT == nil:
+			vpn.ImportRT = c.ExportRT
+			vpn.ExportRT = c.ExportRT
+		case c.ExportRT == nil:
+			vpn.ImportRT = c.ImportRT
+			vpn.ExportRT = c.ImportRT
+		default:
+			vpn.ImportRT = c.ImportRT
+			vpn.ExportRT = c.ExportRT
+		}
+	}
+}
+
+// checkRouteDistinguishers checks that the route distinguishers are unique
+// among all the VPNs of the project
+func (p *Project) checkRouteDistinguishers() {
+	seen := make(map[string]string, 16)
+	for _, a := range p.AS {
+		for _, vpn := range a.VPN {
+			for _, rd := range []string{vpn.RD, vpn.DownRD} {
+				if rd == "" {
+					continue
+				}
+				owner := fmt.Sprintf("AS%d (VRF %s)", a.ASN, vpn.VRF)
+				if prev, ok := seen[rd]; ok {
+					utils.Fatalf("Route distinguisher %s used by both %s and %s\n", rd, prev, owner)
+				}
+				seen[rd] = owner
+			}
+		}
+	}
+}
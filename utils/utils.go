@@ -161,6 +161,25 @@ func StartFrr(cName string) {
 	}
 }
 
+// ReloadFrr runs the reload action of the init script of a container, which
+// reloads the configuration of its routing daemon
+func ReloadFrr(cName string) error {
+	cmd := exec.Command(
+		"docker",
+		"exec",
+		cName,
+		"/usr/lib/frr/frrinit.sh",
+		"reload",
+	)
+	if config.VFlag {
+		fmt.Println(cmd)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s %v", cName, string(out), err)
+	}
+	return nil
+}
+
 func ResolveFilePath(path string) string {
 	if filepath.IsAbs(path) {
 		return path